@@ -3,6 +3,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli"
 
@@ -49,6 +53,24 @@ func CertificateCommand() cli.Command {
 					},
 				},
 			},
+			cli.Command{
+				Name:   "info",
+				Usage:  "Show YKE cluster certificates and their expiration",
+				Action: showKECertificatesFromCli,
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "config",
+						Usage:  "Specify an alternate cluster YAML file",
+						Value:  pki.ClusterConfig,
+						EnvVar: "YKE_CONFIG",
+					},
+					cli.IntFlag{
+						Name:  "warn-days",
+						Usage: "Exit with error if any certificate expires within the specified days",
+						Value: 30,
+					},
+				}, commonFlags...),
+			},
 		},
 	}
 }
@@ -74,10 +96,82 @@ func rotateKECertificatesFromCli(ctx *cli.Context) error {
 	return RotateKECertificates(context.Background(), keConfig, nil, nil, nil, false, "", k8sComponent, rotateCACert)
 }
 
-func showRKECertificatesFromCli(ctx *cli.Context) error {
+func showKECertificatesFromCli(ctx *cli.Context) error {
+	warnDays := ctx.Int("warn-days")
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	keConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	keConfig, err = setOptionsFromCLI(ctx, keConfig)
+	if err != nil {
+		return err
+	}
+
+	certInfos, err := GetKECertificatesInfo(context.Background(), keConfig, nil, nil, "")
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCN\tO\tSANS\tISSUER\tSERIAL\tNOT BEFORE\tNOT AFTER\tDAYS LEFT")
+	expiring := []string{}
+	for _, info := range certInfos {
+		sans := append(append([]string{}, info.DNSNames...), info.IPAddresses...)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			info.Name,
+			info.CommonName,
+			strings.Join(info.Organization, ","),
+			strings.Join(sans, ","),
+			info.Issuer,
+			info.SerialNumber,
+			info.NotBefore.Format(time.RFC3339),
+			info.NotAfter.Format(time.RFC3339),
+			info.DaysLeft)
+		if info.DaysLeft < warnDays {
+			expiring = append(expiring, info.Name)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(expiring) > 0 {
+		return fmt.Errorf("Certificate(s) [%s] expire in less than %d days", strings.Join(expiring, ","), warnDays)
+	}
 	return nil
 }
 
+func GetKECertificatesInfo(
+	ctx context.Context,
+	keConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory hosts.DialerFactory,
+	k8sWrapTransport k8s.WrapTransport,
+	configDir string) ([]pki.CertificateInfo, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, keConfig, clusterFilePath, configDir, dockerDialerFactory, nil, k8sWrapTransport)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := kubeCluster.GetClusterCertificates(ctx)
+	if err != nil {
+		log.Warningf("Failed to get certificates from Kubernetes, trying backups on cluster hosts: %v", err)
+		if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+			return nil, err
+		}
+		certs, err = kubeCluster.GetBackupCertificates(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pki.GetCertificatesInfo(certs, time.Now()), nil
+}
+
 func RotateKECertificates(
 	ctx context.Context,
 	keConfig *types.KubernetesEngineConfig,
@@ -20,6 +20,15 @@ var commonFlags = []cli.Flag{
 		Name:  "ignore-docker-version",
 		Usage: "Disable Docker version check",
 	},
+	cli.StringFlag{
+		Name:   "ssh-key-passphrase",
+		Usage:  "Passphrase of encrypted SSH private keys without ssh_key_passphrase set in the cluster file",
+		EnvVar: "YKE_SSH_KEY_PASSPHRASE",
+	},
+	cli.BoolFlag{
+		Name:  "ssh-trust-on-first-use",
+		Usage: "Trust unknown SSH host keys on first use and record them in the cluster state file",
+	},
 }
 
 func setOptionsFromCLI(c *cli.Context, config *types.KubernetesEngineConfig) (*types.KubernetesEngineConfig, error) {
@@ -27,6 +36,13 @@ func setOptionsFromCLI(c *cli.Context, config *types.KubernetesEngineConfig) (*t
 	if c.Bool("ssh-agent-auth") {
 		config.SSHAgentAuth = c.Bool("ssh-agent-auth")
 	}
+	if passphrase := c.String("ssh-key-passphrase"); len(passphrase) > 0 {
+		// not set as ssh_key_passphrase so it isn't saved in the cluster state
+		config.FallbackSSHKeyPassphrase = passphrase
+	}
+	if c.Bool("ssh-trust-on-first-use") {
+		config.SSHTrustOnFirstUse = c.Bool("ssh-trust-on-first-use")
+	}
 	return config, nil
 }
 
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -36,6 +38,26 @@ func ConfigCommand() cli.Command {
 		Name:   "config",
 		Usage:  "Setup cluster configuration",
 		Action: clusterConfig,
+		Subcommands: []cli.Command{
+			{
+				Name:   "validate",
+				Usage:  "Validate cluster configuration without connecting to any host",
+				Action: validateConfigFromCli,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "config",
+						Usage:  "Specify an alternate cluster YAML file",
+						Value:  pki.ClusterConfig,
+						EnvVar: "YKE_CONFIG",
+					},
+				},
+			},
+			{
+				Name:   "schema",
+				Usage:  "Print the JSON Schema of the cluster configuration file",
+				Action: printConfigSchema,
+			},
+		},
 		Flags: []cli.Flag{
 			cli.StringFlag{
 				Name:  "name,n",
@@ -122,6 +144,31 @@ func ConfigCommand() cli.Command {
 	}
 }
 
+func validateConfigFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	errs := cluster.ValidateClusterFile(context.Background(), clusterFile)
+	if len(errs) == 0 {
+		log.Infof("Cluster file [%s] is valid", filePath)
+		return nil
+	}
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", filePath, err)
+	}
+	return fmt.Errorf("Cluster file [%s] has %d problem(s)", filePath, len(errs))
+}
+
+func printConfigSchema(ctx *cli.Context) error {
+	bs, err := json.MarshalIndent(types.GetConfigJSONSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
 func getConfig(reader *bufio.Reader, text, def string) (string, error) {
 	for {
 		if def == "" {
@@ -312,6 +359,9 @@ func directlyTopoConfig(ctx *cli.Context, configFile string, print bool) error {
 func setTopoConfigDefaults(ctx *cli.Context, c *types.KubernetesEngineConfig, yunionWebhookAuth *YunionWebhookAuthConfig) {
 	c.Network = types.NetworkConfig{Plugin: cluster.DefaultNetworkPlugin}
 	c.Authorization = types.AuthzConfig{Mode: cluster.DefaultAuthorizationMode}
+	c.Authentication = types.AuthnConfig{
+		Strategy: types.AuthnStrategies{cluster.DefaultAuthStrategy, cluster.WebhookAuthenticationProvider},
+	}
 
 	servicesConfig := types.ConfigServices{}
 	imageDefaults := types.K8sVersionToSystemImages[cluster.DefaultK8sVersion]
@@ -344,9 +394,6 @@ func setTopoConfigDefaults(ctx *cli.Context, c *types.KubernetesEngineConfig, yu
 		},
 	}
 	c.WebhookAuth.URL = yunionWebhookAuth.URL
-	servicesConfig.KubeAPI.ExtraArgs = map[string]string{
-		"authentication-token-webhook-config-file": "/etc/kubernetes/webhook.kubeconfig",
-	}
 	servicesConfig.Kubelet.ClusterDomain = cluster.DefaultClusterDomain
 	servicesConfig.KubeAPI.ServiceClusterIPRange = cluster.DefaultServiceClusterIPRange
 	servicesConfig.KubeController.ServiceClusterIPRange = cluster.DefaultServiceClusterIPRange
@@ -614,28 +661,39 @@ func getServiceConfig(reader *bufio.Reader) (*types.ConfigServices, error) {
 func getAuthnConfig(reader *bufio.Reader) (*types.AuthnConfig, error) {
 	authnConfig := types.AuthnConfig{}
 
-	authnType, err := getConfig(reader, "Authentication Strategy", cluster.DefaultAuthStrategy)
+	authnTypes, err := getConfig(reader, "Authentication Strategies (x509, webhook, oidc), comma separated", cluster.DefaultAuthStrategy)
 	if err != nil {
 		return nil, err
 	}
-	authnConfig.Strategy = authnType
+	for _, authnType := range strings.Split(authnTypes, ",") {
+		if authnType = strings.TrimSpace(authnType); len(authnType) > 0 {
+			authnConfig.Strategy = append(authnConfig.Strategy, authnType)
+		}
+	}
 	return &authnConfig, nil
 }
 
 func getAuthzConfig(reader *bufio.Reader) (*types.AuthzConfig, error) {
 	authzConfig := types.AuthzConfig{}
-	authzMode, err := getConfig(reader, "Authorization Mode (rbac, none)", cluster.DefaultAuthorizationMode)
+	authzMode, err := getConfig(reader, "Authorization Mode (rbac, rbac,webhook, none)", cluster.DefaultAuthorizationMode)
 	if err != nil {
 		return nil, err
 	}
 	authzConfig.Mode = authzMode
+	if strings.Contains(authzMode, cluster.WebhookAuthorizationMode) {
+		webhookURL, err := getConfig(reader, "Authorization Webhook URL", "")
+		if err != nil {
+			return nil, err
+		}
+		authzConfig.Options = map[string]string{cluster.AuthzWebhookURLOption: webhookURL}
+	}
 	return &authzConfig, nil
 }
 
 func getNetworkConfig(reader *bufio.Reader) (*types.NetworkConfig, error) {
 	networkConfig := types.NetworkConfig{}
 
-	networkPlugin, err := getConfig(reader, "Network Plugin Type (yunion)", cluster.DefaultNetworkPlugin)
+	networkPlugin, err := getConfig(reader, fmt.Sprintf("Network Plugin Type (%s)", strings.Join(cluster.GetNetworkPluginNames(), ", ")), cluster.DefaultNetworkPlugin)
 	if err != nil {
 		return nil, err
 	}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli"
@@ -31,9 +34,20 @@ func EtcdCommand() cli.Command {
 
 	snapshotFlags = append(snapshotFlags, commonFlags...)
 
+	snapshotListFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+	}
+
+	snapshotListFlags = append(snapshotListFlags, commonFlags...)
+
 	return cli.Command{
 		Name:  "etcd",
-		Usage: "etcd snapshot save/restore operations in k8s cluster",
+		Usage: "etcd snapshot save/restore/list/remove/inspect operations in k8s cluster",
 		Subcommands: []cli.Command{
 			{
 				Name:   "snapshot-save",
@@ -43,10 +57,28 @@ func EtcdCommand() cli.Command {
 			},
 			{
 				Name:   "snapshot-restore",
-				Usage:  "Restore existing snapshot",
+				Usage:  "Restore existing snapshot, downloaded from S3 on the etcd hosts without a local copy",
 				Flags:  snapshotFlags,
 				Action: RestoreEtcdSnapshotFromCli,
 			},
+			{
+				Name:   "snapshot-ls",
+				Usage:  "List snapshots existing on etcd hosts",
+				Flags:  snapshotListFlags,
+				Action: ListEtcdSnapshotsFromCli,
+			},
+			{
+				Name:   "snapshot-rm",
+				Usage:  "Remove existing snapshot from all etcd hosts",
+				Flags:  snapshotFlags,
+				Action: RemoveEtcdSnapshotFromCli,
+			},
+			{
+				Name:   "snapshot-inspect",
+				Usage:  "Show revision, key count and hash of existing snapshot",
+				Flags:  snapshotFlags,
+				Action: InspectEtcdSnapshotFromCli,
+			},
 		},
 	}
 }
@@ -103,6 +135,62 @@ func RestoreEtcdSnapshot(
 	return nil
 }
 
+func ListEtcdSnapshots(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory hosts.DialerFactory,
+	configDir string) ([]cluster.EtcdSnapshotInfo, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, configDir, dockerDialerFactory, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return nil, err
+	}
+	return kubeCluster.ListEtcdSnapshots(ctx)
+}
+
+func RemoveEtcdSnapshot(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory hosts.DialerFactory,
+	configDir, snapshotName string) error {
+
+	log.Infof("Starting removing snapshot on etcd hosts")
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, configDir, dockerDialerFactory, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return err
+	}
+	if err := kubeCluster.RemoveEtcdSnapshot(ctx, snapshotName); err != nil {
+		return err
+	}
+	log.Infof("Finished removing snapshot [%s] on all etcd hosts", snapshotName)
+	return nil
+}
+
+func InspectEtcdSnapshot(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory hosts.DialerFactory,
+	configDir, snapshotName string) ([]cluster.EtcdSnapshotHostStatus, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, configDir, dockerDialerFactory, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return nil, err
+	}
+	return kubeCluster.InspectEtcdSnapshot(ctx, snapshotName)
+}
+
 func SnapshotSaveEtcdHostsFromCli(ctx *cli.Context) error {
 	clusterFile, filePath, err := resolveClusterFile(ctx)
 	if err != nil {
@@ -150,3 +238,68 @@ func RestoreEtcdSnapshotFromCli(ctx *cli.Context) error {
 	}
 	return RestoreEtcdSnapshot(context.Background(), ykeConfig, nil, "", etcdSnapshotName)
 }
+
+func ListEtcdSnapshotsFromCli(ctx *cli.Context) error {
+	ykeConfig, err := etcdConfigFromCli(ctx)
+	if err != nil {
+		return err
+	}
+	snapshots, err := ListEtcdSnapshots(context.Background(), ykeConfig, nil, "")
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tTIMESTAMP\tHOSTS")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", snapshot.Name, snapshot.Size, snapshot.Timestamp.Format(time.RFC3339), strings.Join(snapshot.Hosts, ","))
+	}
+	return w.Flush()
+}
+
+func RemoveEtcdSnapshotFromCli(ctx *cli.Context) error {
+	ykeConfig, err := etcdConfigFromCli(ctx)
+	if err != nil {
+		return err
+	}
+	etcdSnapshotName := ctx.String("name")
+	if etcdSnapshotName == "" {
+		return fmt.Errorf("You must specify the snapshot name to remove")
+	}
+	return RemoveEtcdSnapshot(context.Background(), ykeConfig, nil, "", etcdSnapshotName)
+}
+
+func InspectEtcdSnapshotFromCli(ctx *cli.Context) error {
+	ykeConfig, err := etcdConfigFromCli(ctx)
+	if err != nil {
+		return err
+	}
+	etcdSnapshotName := ctx.String("name")
+	if etcdSnapshotName == "" {
+		return fmt.Errorf("You must specify the snapshot name to inspect")
+	}
+	statuses, err := InspectEtcdSnapshot(context.Background(), ykeConfig, nil, "", etcdSnapshotName)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tREVISION\tKEYS\tHASH\tSIZE")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%x\t%d\n", status.Address, status.Revision, status.TotalKey, status.Hash, status.TotalSize)
+	}
+	return w.Flush()
+}
+
+func etcdConfigFromCli(ctx *cli.Context) (*types.KubernetesEngineConfig, error) {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	return setOptionsFromCLI(ctx, ykeConfig)
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func LogsCommand() cli.Command {
+	logsCollectFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output-dir",
+			Usage: "Directory to write the logs bundle to",
+			Value: ".",
+		},
+		cli.StringFlag{
+			Name:  "tail",
+			Usage: "Number of lines to collect from the end of each container log, or all",
+			Value: "5000",
+		},
+		cli.StringFlag{
+			Name:   "run-log",
+			Usage:  "yke run log file to include in the bundle",
+			EnvVar: "YKE_LOG_FILE",
+		},
+	}
+
+	logsCollectFlags = append(logsCollectFlags, commonFlags...)
+
+	return cli.Command{
+		Name:  "logs",
+		Usage: "Cluster logs operations",
+		Subcommands: []cli.Command{
+			{
+				Name:   "collect",
+				Usage:  "Collect container logs, docker info and plans of all hosts into a tar.gz bundle",
+				Flags:  logsCollectFlags,
+				Action: collectLogsFromCli,
+			},
+		},
+	}
+}
+
+func CollectLogs(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dialerFactory hosts.DialerFactory,
+	tail, runLogPath string) ([]cluster.LogFile, error) {
+
+	redactedConfig, err := yaml.Marshal(cluster.GetRedactedConfig(*ykeConfig))
+	if err != nil {
+		return nil, err
+	}
+	files := []cluster.LogFile{{Name: "cluster.yml", Data: redactedConfig}}
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, "", dialerFactory, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// unreachable hosts are recorded in the bundle instead of failing the command
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil && len(kubeCluster.InactiveHosts) == 0 {
+		return nil, err
+	}
+	redactor := cluster.NewSecretsRedactor(ykeConfig)
+	if len(runLogPath) > 0 {
+		runLog, err := ioutil.ReadFile(runLogPath)
+		if err != nil {
+			log.Warningf("Failed to read run log [%s]: %v", runLogPath, err)
+		} else {
+			files = append(files, cluster.LogFile{Name: "yke.log", Data: redactor.Redact(runLog)})
+		}
+	}
+	return append(files, kubeCluster.CollectLogs(ctx, tail)...), nil
+}
+
+func collectLogsFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+
+	files, err := CollectLogs(context.Background(), ykeConfig, nil, ctx.String("tail"), ctx.String("run-log"))
+	if err != nil {
+		return err
+	}
+	bundleName := fmt.Sprintf("yke-logs-%s", time.Now().Format("20060102-150405"))
+	bundlePath := filepath.Join(ctx.String("output-dir"), bundleName+".tar.gz")
+	if err := writeLogsBundle(bundlePath, bundleName, files); err != nil {
+		return fmt.Errorf("Failed to write logs bundle: %v", err)
+	}
+	log.Infof("Logs bundle written to [%s]", bundlePath)
+	return nil
+}
+
+func writeLogsBundle(bundlePath, rootDir string, files []cluster.LogFile) error {
+	f, err := os.OpenFile(bundlePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:    path.Join(rootDir, file.Name),
+			Mode:    0600,
+			Size:    int64(len(file.Data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func NodeCommand() cli.Command {
+	nodeAddFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "address",
+			Usage: "IP or FQDN of the node used for SSH communication",
+		},
+		cli.StringFlag{
+			Name:  "internal-address",
+			Usage: "Internal address of the node used for components communication",
+		},
+		cli.StringSliceFlag{
+			Name:  "role",
+			Usage: "Node role, one of controlplane|etcd|worker, can be repeated",
+		},
+		cli.StringFlag{
+			Name:  "hostname-override",
+			Usage: "Hostname of the node",
+		},
+		cli.StringFlag{
+			Name:  "user",
+			Usage: "SSH user of the node",
+		},
+		cli.StringFlag{
+			Name:  "port",
+			Usage: "SSH port of the node",
+		},
+		cli.StringFlag{
+			Name:  "ssh-key-path",
+			Usage: "SSH private key path of the node",
+		},
+		cli.StringFlag{
+			Name:  "ssh-cert-path",
+			Usage: "SSH certificate path of the node",
+		},
+		cli.StringFlag{
+			Name:  "docker-socket",
+			Usage: "Docker socket on the node",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "Node label in key=value format, can be repeated",
+		},
+	}
+
+	nodeAddFlags = append(nodeAddFlags, commonFlags...)
+
+	nodeRemoveFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+	}
+
+	nodeRemoveFlags = append(nodeRemoveFlags, commonFlags...)
+
+	return cli.Command{
+		Name:  "node",
+		Usage: "Add or remove a single node without running a full up",
+		Subcommands: []cli.Command{
+			{
+				Name:   "add",
+				Usage:  "Deploy a node and add it to the cluster file",
+				Flags:  nodeAddFlags,
+				Action: clusterNodeAddFromCli,
+			},
+			{
+				Name:      "remove",
+				Usage:     "Drain a node, remove it from the cluster and then from the cluster file",
+				ArgsUsage: "<address|hostname>",
+				Flags:     nodeRemoveFlags,
+				Action:    clusterNodeRemoveFromCli,
+			},
+		},
+	}
+}
+
+func ClusterAddNode(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	address string,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	k8sWrapTransport k8s.WrapTransport,
+	configDir string) error {
+
+	log.Infof("Adding node [%s] to the Kubernetes cluster", address)
+	kubeCluster, currentCluster, err := nodeClusterFromConfig(ctx, ykeConfig, dockerDialerFactory, localConnDialerFactory, k8sWrapTransport, configDir)
+	if err != nil {
+		return err
+	}
+	if err := cluster.AddNode(ctx, kubeCluster, currentCluster, address); err != nil {
+		return err
+	}
+	if err := kubeCluster.SaveClusterState(ctx, ykeConfig); err != nil {
+		return err
+	}
+	log.Infof("Finished adding node [%s] successfully", address)
+	return nil
+}
+
+func ClusterRemoveNode(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	address string,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	k8sWrapTransport k8s.WrapTransport,
+	configDir string) error {
+
+	log.Infof("Removing node [%s] from the Kubernetes cluster", address)
+	kubeCluster, currentCluster, err := nodeClusterFromConfig(ctx, ykeConfig, dockerDialerFactory, localConnDialerFactory, k8sWrapTransport, configDir)
+	if err != nil {
+		return err
+	}
+	if err := cluster.RemoveNode(ctx, kubeCluster, currentCluster, address); err != nil {
+		return err
+	}
+	if err := kubeCluster.SaveClusterState(ctx, ykeConfig); err != nil {
+		return err
+	}
+	log.Infof("Finished removing node [%s] successfully", address)
+	return nil
+}
+
+func nodeClusterFromConfig(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	k8sWrapTransport k8s.WrapTransport,
+	configDir string) (*cluster.Cluster, *cluster.Cluster, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, k8sWrapTransport)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return nil, nil, err
+	}
+	currentCluster, err := kubeCluster.GetClusterState(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if currentCluster == nil {
+		return nil, nil, fmt.Errorf("Failed to get current cluster state, run up to provision the cluster first")
+	}
+	if err := cluster.SetUpAuthentication(ctx, kubeCluster, currentCluster); err != nil {
+		return nil, nil, err
+	}
+	return kubeCluster, currentCluster, nil
+}
+
+func clusterNodeAddFromCli(ctx *cli.Context) error {
+	node, err := nodeFromCli(ctx)
+	if err != nil {
+		return err
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	for _, n := range ykeConfig.Nodes {
+		if n.Address == node.Address {
+			return fmt.Errorf("Node [%s] already exists in cluster file", node.Address)
+		}
+	}
+	ykeConfig.Nodes = append(ykeConfig.Nodes, node)
+	// parsed again so the defaults and the cli options set while deploying
+	// are not written to the cluster file
+	fileConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	fileConfig.Nodes = append(fileConfig.Nodes, node)
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+	if err := ClusterAddNode(context.Background(), ykeConfig, node.Address, nil, nil, nil, ""); err != nil {
+		return err
+	}
+	return updateClusterFile(fileConfig, filePath)
+}
+
+func clusterNodeRemoveFromCli(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Node address or hostname is required")
+	}
+	name := ctx.Args().First()
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	address := ""
+	nodes := []types.ConfigNode{}
+	for _, n := range ykeConfig.Nodes {
+		if address == "" && (n.Address == name || strings.EqualFold(n.HostnameOverride, name)) {
+			address = n.Address
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	if address == "" {
+		return fmt.Errorf("Node [%s] not found in cluster file", name)
+	}
+	ykeConfig.Nodes = nodes
+	// parsed again so the defaults and the cli options set while deploying
+	// are not written to the cluster file
+	fileConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	fileNodes := []types.ConfigNode{}
+	for _, n := range fileConfig.Nodes {
+		if n.Address != address {
+			fileNodes = append(fileNodes, n)
+		}
+	}
+	fileConfig.Nodes = fileNodes
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+	if err := ClusterRemoveNode(context.Background(), ykeConfig, address, nil, nil, nil, ""); err != nil {
+		return err
+	}
+	return updateClusterFile(fileConfig, filePath)
+}
+
+// updateClusterFile replaces the cluster file once the node change is
+// deployed, a failed deploy leaves it untouched. The new file is written next
+// to it and renamed so it's never left half written.
+func updateClusterFile(ykeConfig *types.KubernetesEngineConfig, filePath string) error {
+	log.Warningf("Rewriting cluster file [%s], its comments and formatting are not kept", filePath)
+	tmpPath := filePath + ".tmp"
+	if err := writeConfig(ykeConfig, tmpPath, false); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to update cluster file: %v", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Failed to update cluster file: %v", err)
+	}
+	return nil
+}
+
+func nodeFromCli(ctx *cli.Context) (types.ConfigNode, error) {
+	node := types.ConfigNode{
+		Address:          ctx.String("address"),
+		InternalAddress:  ctx.String("internal-address"),
+		HostnameOverride: ctx.String("hostname-override"),
+		User:             ctx.String("user"),
+		Port:             ctx.String("port"),
+		SSHKeyPath:       ctx.String("ssh-key-path"),
+		SSHCertPath:      ctx.String("ssh-cert-path"),
+		DockerSocket:     ctx.String("docker-socket"),
+	}
+	if len(node.Address) == 0 {
+		return node, fmt.Errorf("Node address is required")
+	}
+	roles := ctx.StringSlice("role")
+	if len(roles) == 0 {
+		return node, fmt.Errorf("At least one node role is required")
+	}
+	for _, role := range roles {
+		if !roleSets.Has(role) {
+			return node, fmt.Errorf("Invalid role: %q", role)
+		}
+		node.Role = append(node.Role, role)
+	}
+	for _, label := range ctx.StringSlice("label") {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 {
+			return node, fmt.Errorf("Invalid label [%s], must be in key=value format", label)
+		}
+		if node.Labels == nil {
+			node.Labels = map[string]string{}
+		}
+		node.Labels[parts[0]] = parts[1]
+	}
+	return node, nil
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	dtypes "github.com/docker/docker/api/types"
+	"github.com/ghodss/yaml"
+	"github.com/urfave/cli"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+type clusterPlanOutput struct {
+	Plan    types.Plan              `json:"plan"`
+	Changes []cluster.ProcessChange `json:"changes"`
+}
+
+func PlanCommand() cli.Command {
+	planFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "Output format, one of json|yaml",
+		},
+	}
+
+	planFlags = append(planFlags, commonFlags...)
+
+	return cli.Command{
+		Name:   "plan",
+		Usage:  "Show the cluster plan and the containers that up will change",
+		Action: clusterPlanFromCli,
+		Flags:  planFlags,
+	}
+}
+
+func ClusterPlan(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dialerFactory hosts.DialerFactory) (types.Plan, []cluster.ProcessChange, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, "", dialerFactory, nil, nil)
+	if err != nil {
+		return types.Plan{}, nil, err
+	}
+
+	reachable := true
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		log.Warningf("Failed to connect to cluster hosts, skipping running containers comparison: %v", err)
+		reachable = false
+	}
+
+	hostsInfoMap := map[string]dtypes.Info{}
+	for _, host := range hosts.GetUniqueHostList(kubeCluster.EtcdHosts, kubeCluster.ControlPlaneHosts, kubeCluster.WorkerHosts) {
+		hostsInfoMap[host.Address] = host.DockerInfo
+	}
+	clusterPlan, err := cluster.GeneratePlan(ctx, ykeConfig, hostsInfoMap)
+	if err != nil {
+		return clusterPlan, nil, err
+	}
+	if !reachable {
+		return clusterPlan, nil, nil
+	}
+	for _, host := range kubeCluster.InactiveHosts {
+		log.Warningf("Host [%s] is not reachable, skipping running containers comparison", host.Address)
+	}
+	changes, err := kubeCluster.DiffPlan(ctx, clusterPlan)
+	if err != nil {
+		return clusterPlan, nil, err
+	}
+	return clusterPlan, changes, nil
+}
+
+func clusterPlanFromCli(ctx *cli.Context) error {
+	output := ctx.String("output")
+	if output != "" && output != "json" && output != "yaml" {
+		return fmt.Errorf("Unsupported output format [%s], must be json or yaml", output)
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+
+	clusterPlan, changes, err := ClusterPlan(context.Background(), ykeConfig, nil)
+	if err != nil {
+		return err
+	}
+	return printClusterPlan(clusterPlanOutput{Plan: clusterPlan, Changes: changes}, output)
+}
+
+func printClusterPlan(out clusterPlanOutput, output string) error {
+	switch output {
+	case "json":
+		bs, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	case "yaml":
+		bs, err := yaml.Marshal(out)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(bs))
+		return nil
+	}
+	bs, err := yaml.Marshal(out.Plan)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(bs))
+	if out.Changes == nil {
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tCONTAINER\tACTION")
+	for _, change := range out.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.Address, change.Container, change.Action)
+	}
+	return w.Flush()
+}
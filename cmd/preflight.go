@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func PreflightCommand() cli.Command {
+	preflightFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "Output format, one of table|json",
+			Value: "table",
+		},
+		cli.BoolFlag{
+			Name:  "disable-port-check",
+			Usage: "Disable port check validation between nodes",
+		},
+		cli.BoolFlag{
+			Name:  "network-matrix",
+			Usage: "Print every source, destination and port tried by the port checks",
+		},
+	}
+
+	preflightFlags = append(preflightFlags, commonFlags...)
+
+	return cli.Command{
+		Name:   "preflight",
+		Usage:  "Check that the cluster hosts are ready to be deployed",
+		Action: preflightFromCli,
+		Flags:  preflightFlags,
+	}
+}
+
+func ClusterPreflight(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dialerFactory hosts.DialerFactory,
+	disablePortCheck bool) (*cluster.PreflightReport, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, "", dialerFactory, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return nil, err
+	}
+	currentCluster, err := kubeCluster.GetClusterState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the ports of the running hosts are checked too when asked explicitly
+	return kubeCluster.RunPreflightChecks(ctx, currentCluster, !disablePortCheck, true)
+}
+
+func preflightFromCli(ctx *cli.Context) error {
+	output := ctx.String("output")
+	if output != "table" && output != "json" {
+		return fmt.Errorf("Unsupported output format [%s], must be table or json", output)
+	}
+	if ctx.Bool("network-matrix") && ctx.Bool("disable-port-check") {
+		return fmt.Errorf("The network matrix is built by the port checks, it can't be used with --disable-port-check")
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+
+	report, err := ClusterPreflight(context.Background(), ykeConfig, nil, ctx.Bool("disable-port-check"))
+	if err != nil {
+		return err
+	}
+	if !ctx.Bool("network-matrix") {
+		report.NetworkMatrix = nil
+	}
+	if err := printPreflightReport(report, output); err != nil {
+		return err
+	}
+	if report.HasFailures() {
+		return fmt.Errorf("Preflight checks failed on cluster hosts")
+	}
+	return nil
+}
+
+func printPreflightReport(report *cluster.PreflightReport, output string) error {
+	if output == "json" {
+		bs, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tCHECK\tSTATUS\tMESSAGE")
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Host, result.Check, result.Status, result.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(report.NetworkMatrix) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tDESTINATION\tPORT\tSTATUS")
+	for _, result := range report.NetworkMatrix {
+		status := "open"
+		if !result.Reachable {
+			status = "blocked"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\n", result.Source, result.Destination, result.Port, strings.ToLower(result.Protocol), status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func SecretsCommand() cli.Command {
+	return cli.Command{
+		Name:  "secrets",
+		Usage: "Secrets encryption management for YKE cluster",
+		Subcommands: cli.Commands{
+			cli.Command{
+				Name:   "rotate-key",
+				Usage:  "Rotate the key encrypting Secrets at rest and rewrite all Secrets with it",
+				Action: rotateSecretsEncryptionKeyFromCli,
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "config",
+						Usage:  "Specify an alternate cluster YAML file",
+						Value:  pki.ClusterConfig,
+						EnvVar: "YKE_CONFIG",
+					},
+				}, commonFlags...),
+			},
+		},
+	}
+}
+
+func rotateSecretsEncryptionKeyFromCli(ctx *cli.Context) error {
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+
+	keConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+	keConfig, err = setOptionsFromCLI(ctx, keConfig)
+	if err != nil {
+		return err
+	}
+
+	return RotateSecretsEncryptionKey(context.Background(), keConfig, nil, nil, nil, false, "")
+}
+
+func RotateSecretsEncryptionKey(
+	ctx context.Context,
+	keConfig *types.KubernetesEngineConfig,
+	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
+	k8sWrapTransport k8s.WrapTransport,
+	local bool, configDir string) error {
+
+	log.Infof("Rotating Kubernetes secrets encryption key")
+	kubeCluster, err := cluster.ParseCluster(ctx, keConfig, clusterFilePath, configDir, dockerDialerFactory, localConnDialerFactory, k8sWrapTransport)
+	if err != nil {
+		return err
+	}
+
+	if err := kubeCluster.TunnelHosts(ctx, local); err != nil {
+		return err
+	}
+
+	currentCluster, err := kubeCluster.GetClusterState(ctx)
+	if err != nil {
+		return err
+	}
+	if currentCluster == nil {
+		return fmt.Errorf("Failed to get the cluster state, the cluster has to be brought up first")
+	}
+
+	if err := cluster.SetUpAuthentication(ctx, kubeCluster, currentCluster); err != nil {
+		return err
+	}
+
+	if err := cluster.SetUpSecretsEncryption(ctx, kubeCluster, currentCluster); err != nil {
+		return err
+	}
+
+	return cluster.RotateSecretsEncryptionKey(ctx, kubeCluster)
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+
+	"yunion.io/x/yke/pkg/cluster"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func StatusCommand() cli.Command {
+	statusFlags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "Specify an alternate cluster YAML file",
+			Value:  pki.ClusterConfig,
+			EnvVar: "YKE_CONFIG",
+		},
+		cli.StringFlag{
+			Name:  "output,o",
+			Usage: "Output format, one of table|json",
+			Value: "table",
+		},
+	}
+
+	statusFlags = append(statusFlags, commonFlags...)
+
+	return cli.Command{
+		Name:   "status",
+		Usage:  "Show the health of cluster hosts, containers and addons",
+		Action: clusterStatusFromCli,
+		Flags:  statusFlags,
+	}
+}
+
+func ClusterStatus(
+	ctx context.Context,
+	ykeConfig *types.KubernetesEngineConfig,
+	dialerFactory hosts.DialerFactory) (*cluster.ClusterStatus, error) {
+
+	kubeCluster, err := cluster.ParseCluster(ctx, ykeConfig, clusterFilePath, "", dialerFactory, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// unreachable hosts don't fail the tunnel, they are reported as inactive
+	if err := kubeCluster.TunnelHosts(ctx, false); err != nil {
+		return nil, err
+	}
+	currentCluster, err := kubeCluster.GetClusterState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if currentCluster == nil {
+		return nil, fmt.Errorf("Failed to get current cluster state, run up to provision the cluster first")
+	}
+	kubeCluster.Certificates = currentCluster.Certificates
+	return kubeCluster.GetClusterStatus(ctx)
+}
+
+func clusterStatusFromCli(ctx *cli.Context) error {
+	output := ctx.String("output")
+	if output != "table" && output != "json" {
+		return fmt.Errorf("Unsupported output format [%s], must be table or json", output)
+	}
+	clusterFile, filePath, err := resolveClusterFile(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve cluster file: %v", err)
+	}
+	clusterFilePath = filePath
+	ykeConfig, err := cluster.ParseConfig(clusterFile)
+	if err != nil {
+		return fmt.Errorf("Failed to parse cluster file: %v", err)
+	}
+
+	ykeConfig, err = setOptionsFromCLI(ctx, ykeConfig)
+	if err != nil {
+		return err
+	}
+
+	status, err := ClusterStatus(context.Background(), ykeConfig, nil)
+	if err != nil {
+		return err
+	}
+	if err := printClusterStatus(status, output); err != nil {
+		return err
+	}
+	if !status.IsHealthy() {
+		return fmt.Errorf("Cluster is not healthy")
+	}
+	return nil
+}
+
+func printClusterStatus(status *cluster.ClusterStatus, output string) error {
+	if output == "json" {
+		bs, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bs))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tHOSTNAME\tROLES\tDOCKER\tREADY\tETCD\tCONTAINERS")
+	for _, node := range status.Nodes {
+		docker := "unreachable"
+		if node.DockerReachable {
+			docker = "ok"
+		}
+		etcd := "-"
+		if node.EtcdHealthy != nil {
+			etcd = formatHealthy(*node.EtcdHealthy)
+		}
+		containers := []string{}
+		for _, container := range node.Containers {
+			state := container.State
+			if container.Healthy != nil {
+				state = fmt.Sprintf("%s/%s", state, formatHealthy(*container.Healthy))
+			}
+			containers = append(containers, fmt.Sprintf("%s(%s)", container.Name, state))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.Address, node.Hostname, strings.Join(node.Roles, ","), docker, node.Ready, etcd, strings.Join(containers, " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(status.Addons) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDON\tJOB\tCOMPLETED")
+	for _, addon := range status.Addons {
+		fmt.Fprintf(w, "%s\t%s\t%t\n", addon.Name, addon.Job, addon.Completed)
+	}
+	return w.Flush()
+}
+
+func formatHealthy(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
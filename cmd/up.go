@@ -39,6 +39,10 @@ func UpCommand() cli.Command {
 			Name:  "disable-port-check",
 			Usage: "Disable port check validation between nodes",
 		},
+		cli.BoolFlag{
+			Name:  "disable-preflight",
+			Usage: "Disable host preflight checks before deploying",
+		},
 		cli.BoolFlag{
 			Name:  "disable-kube-dns",
 			Usage: "Disable deploy kube-dns",
@@ -64,7 +68,7 @@ func ClusterUp(
 	config *types.KubernetesEngineConfig,
 	dockerDialerFactory, localConnDialerFactory hosts.DialerFactory,
 	k8sWrapTransport k8s.WrapTransport,
-	local bool, configDir string, updateOnly, disablePortCheck bool) (string, string, string, string, map[string]pki.CertificatePKI, error) {
+	local bool, configDir string, updateOnly, disablePortCheck, disablePreflight bool) (string, string, string, string, map[string]pki.CertificatePKI, error) {
 
 	log.Infof("Building Kubernetes cluster")
 	var APIURL, caCrt, clientCert, clientKey string
@@ -81,7 +85,21 @@ func ClusterUp(
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
-	if !disablePortCheck {
+	if !disablePreflight {
+		// port checks are part of the preflight report
+		report, err := kubeCluster.RunPreflightChecks(ctx, currentCluster, !disablePortCheck, false)
+		if err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+		// the network matrix is only printed by yke preflight --network-matrix
+		report.NetworkMatrix = nil
+		if err := printPreflightReport(report, "table"); err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+		if report.HasFailures() {
+			return APIURL, caCrt, clientCert, clientKey, nil, fmt.Errorf("Preflight checks failed on cluster hosts, fix them or run up with --disable-preflight")
+		}
+	} else if !disablePortCheck {
 		if err = kubeCluster.CheckClusterPorts(ctx, currentCluster); err != nil {
 			return APIURL, caCrt, clientCert, clientKey, nil, err
 		}
@@ -91,8 +109,15 @@ func ClusterUp(
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
+	if err := cluster.SetUpSecretsEncryption(ctx, kubeCluster, currentCluster); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+	renewedCerts, err := cluster.RenewExpiringCertificates(ctx, kubeCluster, clusterFilePath, configDir)
+	if err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
 	if len(kubeCluster.ControlPlaneHosts) > 0 {
-		APIURL = fmt.Sprintf("https://" + kubeCluster.ControlPlaneHosts[0].Address + ":6443")
+		APIURL = pki.GetKubeAPIURL(kubeCluster.ControlPlaneEndpoint, kubeCluster.ControlPlaneHosts)
 	}
 	clientCert = string(cert.EncodeCertPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Certificate))
 	clientKey = string(cert.EncodePrivateKeyPEM(kubeCluster.Certificates[pki.KubeAdminCertName].Key))
@@ -104,10 +129,10 @@ func ClusterUp(
 	}
 	// update APIURL after reconcile
 	if len(kubeCluster.ControlPlaneHosts) > 0 {
-		APIURL = fmt.Sprintf("https://" + kubeCluster.ControlPlaneHosts[0].Address + ":6443")
+		APIURL = pki.GetKubeAPIURL(kubeCluster.ControlPlaneEndpoint, kubeCluster.ControlPlaneHosts)
 	}
 
-	err = kubeCluster.SetUpHosts(ctx, false)
+	err = kubeCluster.SetUpHosts(ctx, len(renewedCerts) > 0)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -127,16 +152,34 @@ func ClusterUp(
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	if err := kubeCluster.DeployKubeletBootstrapToken(ctx); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+
 	err = kubeCluster.SaveClusterState(ctx, config)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	if err := kubeCluster.RewriteSecrets(ctx); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+
 	err = kubeCluster.DeployWorkerPlane(ctx)
 	if err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
 
+	if len(renewedCerts) > 0 {
+		if err = cluster.RestartRenewedCertsServices(ctx, kubeCluster, renewedCerts); err != nil {
+			return APIURL, caCrt, clientCert, clientKey, nil, err
+		}
+	}
+
+	if err := kubeCluster.CleanKubeletBootstrapToken(ctx); err != nil {
+		return APIURL, caCrt, clientCert, clientKey, nil, err
+	}
+
 	if err = kubeCluster.CleanDeadLogs(ctx); err != nil {
 		return APIURL, caCrt, clientCert, clientKey, nil, err
 	}
@@ -200,8 +243,9 @@ func clusterUpFromCli(ctx *cli.Context) error {
 	}
 	updateOnly := ctx.Bool("update-only")
 	disablePortCheck := ctx.Bool("disable-port-check")
+	disablePreflight := ctx.Bool("disable-preflight")
 
-	_, _, _, _, _, err = ClusterUp(backgroudContext(ctx), config, nil, nil, nil, false, "", updateOnly, disablePortCheck)
+	_, _, _, _, _, err = ClusterUp(backgroudContext(ctx), config, nil, nil, nil, false, "", updateOnly, disablePortCheck, disablePreflight)
 	return err
 }
 
@@ -222,6 +266,6 @@ func clusterUpLocal(ctx *cli.Context) error {
 
 	config.IgnoreDockerVersion = ctx.Bool("ignore-docker-version")
 
-	_, _, _, _, _, err = ClusterUp(backgroudContext(ctx), config, nil, hosts.LocalHealthcheckFactory, nil, true, "", false, false)
+	_, _, _, _, _, err = ClusterUp(backgroudContext(ctx), config, nil, hosts.LocalHealthcheckFactory, nil, true, "", false, false, false)
 	return err
 }
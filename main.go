@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/urfave/cli"
@@ -8,6 +10,7 @@ import (
 	"yunion.io/x/log"
 
 	"yunion.io/x/yke/cmd"
+	"yunion.io/x/yke/pkg/hosts"
 )
 
 func main() {
@@ -25,6 +28,18 @@ func mainErr() error {
 		if ctx.GlobalBool("debug") {
 			log.SetLogLevelByString(log.Logger(), "debug")
 		}
+		// keep a copy of the run log for the logs bundle
+		if logFile := ctx.GlobalString("log-file"); len(logFile) > 0 {
+			f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("Failed to open log file: %v", err)
+			}
+			log.Logger().Out = io.MultiWriter(log.Logger().Out, f)
+		}
+		return nil
+	}
+	app.After = func(ctx *cli.Context) error {
+		hosts.CloseSSHClients()
 		return nil
 	}
 	app.Author = "Yunion Technology @ 2018"
@@ -34,14 +49,25 @@ func mainErr() error {
 		cmd.RemoveCommand(),
 		cmd.VersionCommand(),
 		cmd.ConfigCommand(),
-		//cmd.EtcdCommand(),
+		cmd.PlanCommand(),
+		cmd.EtcdCommand(),
 		cmd.CertificateCommand(),
+		cmd.SecretsCommand(),
+		cmd.NodeCommand(),
+		cmd.StatusCommand(),
+		cmd.PreflightCommand(),
+		cmd.LogsCommand(),
 	}
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "debug,d",
 			Usage: "Debug logging",
 		},
+		cli.StringFlag{
+			Name:   "log-file",
+			Usage:  "Append the run log to this file as well",
+			EnvVar: "YKE_LOG_FILE",
+		},
 	}
 	return app.Run(os.Args)
 }
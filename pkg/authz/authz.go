@@ -37,3 +37,22 @@ func ApplySystemNodeClusterRoleBinding(ctx context.Context, kubeConfigPath strin
 	log.Infof("[authz] system:node ClusterRoleBinding created successfully")
 	return nil
 }
+
+func ApplyKubeletBootstrapClusterRoleBindings(ctx context.Context, kubeConfigPath string, k8sWrapTransport k8s.WrapTransport) error {
+	log.Infof("[authz] Creating kubelet bootstrap ClusterRoleBindings")
+	k8sClient, err := k8s.NewClient(kubeConfigPath, k8sWrapTransport)
+	if err != nil {
+		return err
+	}
+	for _, clusterRoleBinding := range []string{
+		templates.KubeletBootstrapClusterRoleBinding,
+		templates.KubeletBootstrapApproveClusterRoleBinding,
+		templates.KubeletRenewalApproveClusterRoleBinding,
+	} {
+		if err := k8s.UpdateClusterRoleBindingFromYaml(k8sClient, clusterRoleBinding); err != nil {
+			return err
+		}
+	}
+	log.Infof("[authz] kubelet bootstrap ClusterRoleBindings created successfully")
+	return nil
+}
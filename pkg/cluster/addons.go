@@ -281,7 +281,7 @@ func (c *Cluster) deployKubeDNS(ctx context.Context) error {
 		KubeDNSSidecarImage:    c.SystemImages.KubeDNSSidecar,
 		KubeDNSAutoScalerImage: c.SystemImages.KubeDNSAutoscaler,
 		DNSMasqImage:           c.SystemImages.DNSmasq,
-		RBACConfig:             c.Authorization.Mode,
+		RBACConfig:             c.getRBACConfig(),
 		ClusterDomain:          c.ClusterDomain,
 		ClusterDNSServer:       c.ClusterDNSServer,
 		UpstreamNameservers:    c.DNS.UpstreamNameservers,
@@ -308,7 +308,7 @@ func (c *Cluster) deployCoreDNS(ctx context.Context) error {
 		CoreDNSImage: c.SystemImages.CoreDNS,
 		//CoreDNSAutoScalerImage: c.SystemImages.CoreDNSAutoscaler,
 		CoreDNSAutoScalerImage: c.SystemImages.KubeDNSAutoscaler,
-		RBACConfig:             c.Authorization.Mode,
+		RBACConfig:             c.getRBACConfig(),
 		ClusterDomain:          c.ClusterDomain,
 		ClusterDNSServer:       c.ClusterDNSServer,
 		UpstreamNameservers:    c.DNS.UpstreamNameservers,
@@ -331,7 +331,7 @@ func (c *Cluster) deployMetricServer(ctx context.Context) error {
 	versionTag := s[len(s)-1]
 	MetricsServerConfig := MetricsServerOptions{
 		MetricsServerImage: c.SystemImages.MetricsServer,
-		RBACConfig:         c.Authorization.Mode,
+		RBACConfig:         c.getRBACConfig(),
 		Options:            c.Monitoring.Options,
 		Version:            getTagMajorVersion(versionTag),
 	}
@@ -488,7 +488,7 @@ func (c *Cluster) deployIngress(ctx context.Context) error {
 	}
 	log.Infof("[ingress] Setting up %s ingress controller", c.Ingress.Provider)
 	ingressConfig := ingressOptions{
-		RBACConfig:     c.Authorization.Mode,
+		RBACConfig:     c.getRBACConfig(),
 		Options:        c.Ingress.Options,
 		NodeSelector:   c.Ingress.NodeSelector,
 		ExtraArgs:      c.Ingress.ExtraArgs,
@@ -0,0 +1,127 @@
+package cluster
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/templates"
+	"yunion.io/x/yke/pkg/types"
+)
+
+const (
+	AuditPolicyWriter   = "audit-policy-writer"
+	AuditPolicyPath     = "/etc/kubernetes/audit-policy.yaml"
+	AuditPolicySumEnv   = "YKE_AUDIT_POLICY_CHECKSUM"
+	AuditLogServiceName = "audit-log"
+	AuditPolicyAPIGroup = "audit.k8s.io/"
+	AuditPolicyKind     = "Policy"
+
+	AuditLogFormatJSON   = "json"
+	AuditLogFormatLegacy = "legacy"
+)
+
+const (
+	DefaultAuditLogPath      = "/var/log/kube-audit/audit-log.json"
+	DefaultAuditLogMaxAge    = 30
+	DefaultAuditLogMaxBackup = 10
+	DefaultAuditLogMaxSize   = 100
+)
+
+func (c *Cluster) setAuditLogDefaults() {
+	auditLog := &c.Services.KubeAPI.AuditLog
+	if !auditLog.Enabled {
+		return
+	}
+	setDefaultIfEmpty(&auditLog.Path, DefaultAuditLogPath)
+	setDefaultIfEmpty(&auditLog.Format, AuditLogFormatJSON)
+	if auditLog.MaxAge == 0 {
+		auditLog.MaxAge = DefaultAuditLogMaxAge
+	}
+	if auditLog.MaxBackup == 0 {
+		auditLog.MaxBackup = DefaultAuditLogMaxBackup
+	}
+	if auditLog.MaxSize == 0 {
+		auditLog.MaxSize = DefaultAuditLogMaxSize
+	}
+}
+
+// parseAuditPolicy loads the audit policy written to the control plane
+// hosts, from the cluster file or from the referenced policy file.
+func (c *Cluster) parseAuditPolicy(ctx context.Context) error {
+	auditLog := c.Services.KubeAPI.AuditLog
+	if !auditLog.Enabled {
+		return nil
+	}
+	policy := auditLog.Policy
+	if len(policy) == 0 && len(auditLog.PolicyFile) > 0 {
+		buff, err := ioutil.ReadFile(auditLog.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read audit policy file [%s]: %v", auditLog.PolicyFile, err)
+		}
+		policy = string(buff)
+	}
+	if len(policy) == 0 {
+		policy = templates.DefaultAuditPolicy
+	}
+	c.AuditPolicyConfig = policy
+	return nil
+}
+
+func validateAuditLog(c *Cluster) error {
+	auditLog := c.Services.KubeAPI.AuditLog
+	if !auditLog.Enabled {
+		return nil
+	}
+	if len(auditLog.Policy) > 0 && len(auditLog.PolicyFile) > 0 {
+		return fmt.Errorf("Audit log policy and policy_file can't be both set")
+	}
+	if !path.IsAbs(auditLog.Path) {
+		return fmt.Errorf("Audit log path [%s] must be an absolute path", auditLog.Path)
+	}
+	if auditLog.Format != AuditLogFormatJSON && auditLog.Format != AuditLogFormatLegacy {
+		return fmt.Errorf("Audit log format [%s] is not supported, must be %s or %s", auditLog.Format, AuditLogFormatJSON, AuditLogFormatLegacy)
+	}
+	if auditLog.MaxAge < 0 || auditLog.MaxBackup < 0 || auditLog.MaxSize < 0 {
+		return fmt.Errorf("Audit log max_age, max_backup and max_size can't be negative")
+	}
+	if len(c.AuditPolicyConfig) == 0 {
+		// the policy file could not be read, reported when parsing it
+		return nil
+	}
+	policy := struct {
+		APIVersion string `yaml:"apiVersion"`
+		Kind       string `yaml:"kind"`
+	}{}
+	if err := yaml.Unmarshal([]byte(c.AuditPolicyConfig), &policy); err != nil {
+		return fmt.Errorf("Audit policy is not valid YAML: %v", err)
+	}
+	if policy.Kind != AuditPolicyKind || !strings.HasPrefix(policy.APIVersion, AuditPolicyAPIGroup) {
+		return fmt.Errorf("Audit policy must be a %s of %s, got kind [%s] of [%s]", AuditPolicyKind, AuditPolicyAPIGroup, policy.Kind, policy.APIVersion)
+	}
+	return nil
+}
+
+// getAuditPolicyChecksum is set in the kube-apiserver environment so that a
+// policy change restarts it.
+func getAuditPolicyChecksum(policy string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(policy)))
+}
+
+func deployAuditPolicy(ctx context.Context, controlHosts []*hosts.Host, alpineImage string, policy string, prsMap map[string]types.PrivateRegistry) error {
+	for _, host := range controlHosts {
+		log.Infof("[%s] Deploying audit policy file to node [%s]", AuditLogServiceName, host.Address)
+		if err := host.WriteHostFile(ctx, AuditPolicyWriter, path.Join(host.PrefixPath, AuditPolicyPath), policy, alpineImage, prsMap); err != nil {
+			return fmt.Errorf("Failed to deploy audit policy file on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/util/cert"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/templates"
+	"yunion.io/x/yke/pkg/types"
+)
+
+const (
+	WebhookAuthenticationProvider = "webhook"
+	OIDCAuthenticationProvider    = "oidc"
+
+	OIDCCACertWriter         = "oidc-ca-cert-writer"
+	OIDCServiceName          = "oidc"
+	AuthnConfigSumEnv        = "YKE_AUTHN_CONFIG_CHECKSUM"
+	DefaultOIDCUsernameClaim = "sub"
+)
+
+var OIDCCACertPath = path.Join(pki.CertPathPrefix, "kube-oidc-ca.pem")
+
+func (c *Cluster) hasAuthnStrategy(strategy string) bool {
+	return c.Authentication.Strategy.Has(strategy)
+}
+
+func (c *Cluster) setAuthnDefaults() {
+	if len(c.Authentication.Strategy) == 0 {
+		c.Authentication.Strategy = types.AuthnStrategies{DefaultAuthStrategy}
+	}
+	// webhook_auth.url predates the webhook strategy
+	setDefaultIfEmpty(&c.Authentication.Webhook.URL, c.WebhookAuth.URL)
+	if c.hasAuthnStrategy(OIDCAuthenticationProvider) {
+		setDefaultIfEmpty(&c.Authentication.OIDC.UsernameClaim, DefaultOIDCUsernameClaim)
+	}
+}
+
+func validateAuthOptions(c *Cluster) error {
+	seen := map[string]bool{}
+	for _, strategy := range c.Authentication.Strategy {
+		switch strategy {
+		case X509AuthenticationProvider, WebhookAuthenticationProvider, OIDCAuthenticationProvider:
+		default:
+			return fmt.Errorf("Authentication strategy [%s] is not supported, must be %s, %s or %s", strategy, X509AuthenticationProvider, WebhookAuthenticationProvider, OIDCAuthenticationProvider)
+		}
+		if seen[strategy] {
+			return fmt.Errorf("Authentication strategy [%s] is listed twice", strategy)
+		}
+		seen[strategy] = true
+	}
+	if !seen[X509AuthenticationProvider] {
+		// the cluster components authenticate with their certificates
+		return fmt.Errorf("Authentication strategy %s can't be left out", X509AuthenticationProvider)
+	}
+	if seen[WebhookAuthenticationProvider] {
+		if err := validateAuthnWebhook(c.Authentication.Webhook); err != nil {
+			return err
+		}
+	}
+	if seen[OIDCAuthenticationProvider] {
+		if err := validateOIDC(c.Authentication.OIDC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAuthnWebhook(webhook types.AuthnWebhookConfig) error {
+	if len(webhook.URL) == 0 {
+		return fmt.Errorf("Authentication webhook url can't be empty")
+	}
+	if _, err := url.Parse(webhook.URL); err != nil {
+		return fmt.Errorf("Authentication webhook url [%s] is not valid: %v", webhook.URL, err)
+	}
+	if len(webhook.CacheTTL) > 0 {
+		if _, err := time.ParseDuration(webhook.CacheTTL); err != nil {
+			return fmt.Errorf("Authentication webhook cache_ttl [%s] is not valid: %v", webhook.CacheTTL, err)
+		}
+	}
+	if len(webhook.CACert) > 0 {
+		if _, err := cert.ParseCertsPEM([]byte(webhook.CACert)); err != nil {
+			return fmt.Errorf("Authentication webhook ca_cert is not valid: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateOIDC(oidc types.OIDCConfig) error {
+	issuer, err := url.Parse(oidc.IssuerURL)
+	if err != nil || len(oidc.IssuerURL) == 0 {
+		return fmt.Errorf("Authentication oidc issuer_url [%s] is not valid", oidc.IssuerURL)
+	}
+	if issuer.Scheme != "https" {
+		return fmt.Errorf("Authentication oidc issuer_url [%s] must be an https URL", oidc.IssuerURL)
+	}
+	if len(oidc.ClientID) == 0 {
+		return fmt.Errorf("Authentication oidc client_id can't be empty")
+	}
+	if len(oidc.CACert) > 0 {
+		if _, err := cert.ParseCertsPEM([]byte(oidc.CACert)); err != nil {
+			return fmt.Errorf("Authentication oidc ca_cert is not valid: %v", err)
+		}
+	}
+	return nil
+}
+
+// setAuthnArgs sets the kube-apiserver flags of the webhook and oidc
+// strategies and returns the environment restarting it when the files they
+// read change.
+func (c *Cluster) setAuthnArgs(commandArgs map[string]string) []string {
+	checksums := []string{}
+	if c.hasAuthnStrategy(WebhookAuthenticationProvider) {
+		webhook := c.Authentication.Webhook
+		commandArgs["authentication-token-webhook-config-file"] = WebhookConfigPath
+		if len(webhook.CacheTTL) > 0 {
+			commandArgs["authentication-token-webhook-cache-ttl"] = webhook.CacheTTL
+		}
+		checksums = append(checksums, c.WebhookConfig)
+	}
+	if c.hasAuthnStrategy(OIDCAuthenticationProvider) {
+		oidc := c.Authentication.OIDC
+		commandArgs["oidc-issuer-url"] = oidc.IssuerURL
+		commandArgs["oidc-client-id"] = oidc.ClientID
+		commandArgs["oidc-username-claim"] = oidc.UsernameClaim
+		oidcArgs := map[string]string{
+			"oidc-username-prefix": oidc.UsernamePrefix,
+			"oidc-groups-claim":    oidc.GroupsClaim,
+			"oidc-groups-prefix":   oidc.GroupsPrefix,
+		}
+		for arg, value := range oidcArgs {
+			if len(value) > 0 {
+				commandArgs[arg] = value
+			}
+		}
+		if len(oidc.CACert) > 0 {
+			commandArgs["oidc-ca-file"] = OIDCCACertPath
+			checksums = append(checksums, oidc.CACert)
+		}
+	}
+	if len(checksums) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s=%x", AuthnConfigSumEnv, md5.Sum([]byte(strings.Join(checksums, "\n"))))}
+}
+
+func (c *Cluster) parseWebhookConfig(ctx context.Context) error {
+	webhook := c.Authentication.Webhook
+	if webhook.URL == "" {
+		return nil
+	}
+	caData := ""
+	if len(webhook.CACert) > 0 {
+		caData = base64.StdEncoding.EncodeToString([]byte(webhook.CACert))
+	}
+	config, err := templates.CompileTemplateFromMap(templates.WebhookAuthTemplate, map[string]string{
+		"URL":    webhook.URL,
+		"CAData": caData,
+	})
+	if err != nil {
+		return fmt.Errorf("Generate webhook auth config error: %v", err)
+	}
+	c.WebhookConfig = config
+	return nil
+}
+
+func deployOIDCCACert(ctx context.Context, controlHosts []*hosts.Host, alpineImage string, caCert string, prsMap map[string]types.PrivateRegistry) error {
+	for _, host := range controlHosts {
+		log.Infof("[%s] Deploying oidc CA certificate to node [%s]", OIDCServiceName, host.Address)
+		if err := host.WriteHostFile(ctx, OIDCCACertWriter, path.Join(host.PrefixPath, OIDCCACertPath), caCert, alpineImage, prsMap); err != nil {
+			return fmt.Errorf("Failed to deploy oidc CA certificate on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
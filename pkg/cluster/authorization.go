@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/util/cert"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/templates"
+	"yunion.io/x/yke/pkg/types"
+)
+
+const (
+	WebhookAuthorizationMode = "webhook"
+
+	AuthzWebhookURLOption                  = "webhook_url"
+	AuthzWebhookCACertOption               = "webhook_ca_cert"
+	AuthzWebhookCacheAuthorizedTTLOption   = "webhook_cache_authorized_ttl"
+	AuthzWebhookCacheUnauthorizedTTLOption = "webhook_cache_unauthorized_ttl"
+
+	AuthzWebhookConfigWriter = "authz-webhook-config-writer"
+	AuthzWebhookConfigPath   = "/etc/kubernetes/authz-webhook.kubeconfig"
+	AuthzWebhookServiceName  = "authz-webhook"
+	AuthzConfigSumEnv        = "YKE_AUTHZ_CONFIG_CHECKSUM"
+)
+
+// getAuthzModes splits authorization.mode, webhook only comes along rbac as
+// rbac,webhook and they are tried in order.
+func (c *Cluster) getAuthzModes() []string {
+	modes := []string{}
+	for _, mode := range strings.Split(c.Authorization.Mode, ",") {
+		if mode = strings.TrimSpace(mode); len(mode) > 0 {
+			modes = append(modes, mode)
+		}
+	}
+	return modes
+}
+
+func (c *Cluster) hasAuthzMode(mode string) bool {
+	for _, m := range c.getAuthzModes() {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// getRBACConfig is passed to the addon templates, their RBAC resources are
+// only deployed when it's rbac.
+func (c *Cluster) getRBACConfig() string {
+	if c.hasAuthzMode(services.RBACAuthorizationMode) {
+		return services.RBACAuthorizationMode
+	}
+	return c.Authorization.Mode
+}
+
+// getAuthzWebhookURL returns the SubjectAccessReview endpoint, it has to be
+// set explicitly, the authentication webhook only answers TokenReviews.
+func (c *Cluster) getAuthzWebhookURL() string {
+	return c.Authorization.Options[AuthzWebhookURLOption]
+}
+
+func validateAuthzOptions(c *Cluster) error {
+	modes := c.getAuthzModes()
+	if len(modes) == 1 && modes[0] == NoneAuthorizationMode {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, mode := range modes {
+		if mode != services.RBACAuthorizationMode && mode != WebhookAuthorizationMode {
+			return fmt.Errorf("Authorization mode [%s] is not supported, must be %s, %s,%s or %s", c.Authorization.Mode, services.RBACAuthorizationMode, services.RBACAuthorizationMode, WebhookAuthorizationMode, NoneAuthorizationMode)
+		}
+		if seen[mode] {
+			return fmt.Errorf("Authorization mode [%s] is listed twice", mode)
+		}
+		seen[mode] = true
+	}
+	for key := range c.Authorization.Options {
+		switch key {
+		case AuthzWebhookURLOption, AuthzWebhookCACertOption, AuthzWebhookCacheAuthorizedTTLOption, AuthzWebhookCacheUnauthorizedTTLOption:
+		default:
+			return fmt.Errorf("Authorization option [%s] is not supported", key)
+		}
+	}
+	if !seen[WebhookAuthorizationMode] {
+		return nil
+	}
+	// the cluster components and the addons are only granted access by the
+	// RBAC resources deployed by yke
+	if !seen[services.RBACAuthorizationMode] {
+		return fmt.Errorf("Authorization mode %s requires %s, use %s,%s", WebhookAuthorizationMode, services.RBACAuthorizationMode, services.RBACAuthorizationMode, WebhookAuthorizationMode)
+	}
+	webhookURL := c.getAuthzWebhookURL()
+	if len(webhookURL) == 0 {
+		return fmt.Errorf("Authorization option [%s] can't be empty in %s mode, the authentication webhook can't authorize requests", AuthzWebhookURLOption, WebhookAuthorizationMode)
+	}
+	if _, err := url.Parse(webhookURL); err != nil {
+		return fmt.Errorf("Authorization option [%s] is not valid: %v", AuthzWebhookURLOption, err)
+	}
+	for _, key := range []string{AuthzWebhookCacheAuthorizedTTLOption, AuthzWebhookCacheUnauthorizedTTLOption} {
+		if ttl, ok := c.Authorization.Options[key]; ok {
+			if _, err := time.ParseDuration(ttl); err != nil {
+				return fmt.Errorf("Authorization option [%s] is not valid: %v", key, err)
+			}
+		}
+	}
+	if caCert := c.Authorization.Options[AuthzWebhookCACertOption]; len(caCert) > 0 {
+		if _, err := cert.ParseCertsPEM([]byte(caCert)); err != nil {
+			return fmt.Errorf("Authorization option [%s] is not valid: %v", AuthzWebhookCACertOption, err)
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) parseAuthzWebhookConfig(ctx context.Context) error {
+	if !c.hasAuthzMode(WebhookAuthorizationMode) {
+		return nil
+	}
+	webhookURL := c.getAuthzWebhookURL()
+	if len(webhookURL) == 0 {
+		// reported by the validation
+		return nil
+	}
+	caData := ""
+	if caCert := c.Authorization.Options[AuthzWebhookCACertOption]; len(caCert) > 0 {
+		caData = base64.StdEncoding.EncodeToString([]byte(caCert))
+	}
+	config, err := templates.CompileTemplateFromMap(templates.WebhookAuthTemplate, map[string]string{
+		"URL":    webhookURL,
+		"CAData": caData,
+	})
+	if err != nil {
+		return fmt.Errorf("Generate authorization webhook config error: %v", err)
+	}
+	c.AuthzWebhookConfig = config
+	return nil
+}
+
+// getAuthorizationModeArg returns the --authorization-mode of kube-apiserver,
+// the Node authorizer always comes first.
+func (c *Cluster) getAuthorizationModeArg() string {
+	authorizers := []string{"Node"}
+	for _, mode := range c.getAuthzModes() {
+		switch mode {
+		case services.RBACAuthorizationMode:
+			authorizers = append(authorizers, "RBAC")
+		case WebhookAuthorizationMode:
+			authorizers = append(authorizers, "Webhook")
+		}
+	}
+	if len(authorizers) == 1 {
+		return ""
+	}
+	return strings.Join(authorizers, ",")
+}
+
+// setAuthzWebhookArgs sets the kube-apiserver flags of the webhook
+// authorizer and returns the environment restarting it when its kubeconfig
+// changes.
+func (c *Cluster) setAuthzWebhookArgs(commandArgs map[string]string) []string {
+	if !c.hasAuthzMode(WebhookAuthorizationMode) {
+		return nil
+	}
+	commandArgs["authorization-webhook-config-file"] = AuthzWebhookConfigPath
+	if ttl := c.Authorization.Options[AuthzWebhookCacheAuthorizedTTLOption]; len(ttl) > 0 {
+		commandArgs["authorization-webhook-cache-authorized-ttl"] = ttl
+	}
+	if ttl := c.Authorization.Options[AuthzWebhookCacheUnauthorizedTTLOption]; len(ttl) > 0 {
+		commandArgs["authorization-webhook-cache-unauthorized-ttl"] = ttl
+	}
+	return []string{fmt.Sprintf("%s=%x", AuthzConfigSumEnv, md5.Sum([]byte(c.AuthzWebhookConfig)))}
+}
+
+func deployAuthzWebhookConfig(ctx context.Context, controlHosts []*hosts.Host, alpineImage string, config string, prsMap map[string]types.PrivateRegistry) error {
+	for _, host := range controlHosts {
+		log.Infof("[%s] Deploying authorization webhook config file to node [%s]", AuthzWebhookServiceName, host.Address)
+		if err := host.WriteHostFile(ctx, AuthzWebhookConfigWriter, path.Join(host.PrefixPath, AuthzWebhookConfigPath), config, alpineImage, prsMap); err != nil {
+			return fmt.Errorf("Failed to deploy authorization webhook config file on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
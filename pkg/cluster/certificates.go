@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/rsa"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -29,7 +31,7 @@ const (
 )
 
 func SetUpAuthentication(ctx context.Context, kubeCluster, currentCluster *Cluster) error {
-	if kubeCluster.Authentication.Strategy == X509AuthenticationProvider {
+	if kubeCluster.hasAuthnStrategy(X509AuthenticationProvider) {
 		var err error
 		if currentCluster != nil {
 			kubeCluster.Certificates = currentCluster.Certificates
@@ -90,7 +92,7 @@ func SetUpAuthentication(ctx context.Context, kubeCluster, currentCluster *Clust
 						return fmt.Errorf("Failed to regenerate Aggregation layer certificates %v", err)
 					}
 				}
-				return nil
+				return setUpKubeletCertificates(ctx, kubeCluster)
 			}
 
 			log.Infof("[certificates] No Certificate backup found on [%s] hosts", backupPlane)
@@ -106,13 +108,14 @@ func SetUpAuthentication(ctx context.Context, kubeCluster, currentCluster *Clust
 			}
 			log.Infof("[certificates] Saved certs to [%s] hosts", backupPlane)
 		}
+		return setUpKubeletCertificates(ctx, kubeCluster)
 	}
 	return nil
 }
 
 func regenerateAPICertificate(c *Cluster, certificates map[string]pki.CertificatePKI) (map[string]pki.CertificatePKI, error) {
 	log.Debugf("[certificates] Regenerating kubeAPI certificate")
-	kubeAPIAltNames := pki.GetAltNames(c.ControlPlaneHosts, c.ClusterDomain, c.KubernetesServiceIP, c.Authentication.SANs)
+	kubeAPIAltNames := pki.GetAltNames(c.ControlPlaneHosts, c.ClusterDomain, c.KubernetesServiceIP, pki.GetKubeAPISANs(c.KubernetesEngineConfig))
 	caCrt := certificates[pki.CACertName].Certificate
 	caKey := certificates[pki.CACertName].Key
 	kubeAPIKey := certificates[pki.KubeAPICertName].Key
@@ -124,7 +127,7 @@ func regenerateAPICertificate(c *Cluster, certificates map[string]pki.Certificat
 	return certificates, nil
 }
 
-func getClusterCerts(ctx context.Context, kubeClient *kubernetes.Clientset, etcdHosts []*hosts.Host) (map[string]pki.CertificatePKI, error) {
+func getClusterCerts(ctx context.Context, kubeClient *kubernetes.Clientset, etcdHosts, kubeletHosts []*hosts.Host) (map[string]pki.CertificatePKI, error) {
 	log.Infof("[certificates] Getting Cluster certificates from Kubernetes")
 	certificatesNames := []string{
 		pki.CACertName,
@@ -144,18 +147,27 @@ func getClusterCerts(ctx context.Context, kubeClient *kubernetes.Clientset, etcd
 		certificatesNames = append(certificatesNames, etcdName)
 	}
 
+	for _, kubeletHost := range kubeletHosts {
+		certificatesNames = append(certificatesNames, pki.GetKubeletCrtName(pki.GetNodeName(kubeletHost.ConfigNode)))
+		certificatesNames = append(certificatesNames, pki.GetKubeletServingCrtName(pki.GetNodeName(kubeletHost.ConfigNode)))
+	}
+
 	certMap := make(map[string]pki.CertificatePKI)
 	for _, certName := range certificatesNames {
 		secret, err := k8s.GetSecret(kubeClient, certName)
 		if err != nil && !strings.HasPrefix(certName, "kube-etcd") &&
+			!pki.IsKubeletCrtName(certName) &&
+			!pki.IsKubeletServingCrtName(certName) &&
 			!strings.Contains(certName, pki.RequestHeaderCACertName) &&
 			!strings.Contains(certName, pki.APIProxyClientCertName) &&
 			!strings.Contains(certName, pki.ServiceAccountTokenKeyName) {
 			return nil, err
 		}
-		// If I can't find an etcd, requestheader, or proxy client cert, I will not fail and will create it later
+		// If I can't find an etcd, kubelet, requestheader, or proxy client cert, I will not fail and will create it later
 		if (secret == nil || secret.Data == nil) &&
 			(strings.HasPrefix(certName, "kube-etcd") ||
+				pki.IsKubeletCrtName(certName) ||
+				pki.IsKubeletServingCrtName(certName) ||
 				strings.Contains(certName, pki.RequestHeaderCACertName) ||
 				strings.Contains(certName, pki.APIProxyClientCertName) ||
 				strings.Contains(certName, pki.ServiceAccountTokenKeyName)) {
@@ -272,7 +284,7 @@ func fetchBackupCertificates(ctx context.Context, backupHosts []*hosts.Host, kub
 	var err error
 	certificates := map[string]pki.CertificatePKI{}
 	for _, host := range backupHosts {
-		certificates, err = pki.FetchCertificatesFromHost(ctx, kubeCluster.EtcdHosts, host, kubeCluster.SystemImages.Alpine, kubeCluster.LocalKubeConfigPath, kubeCluster.PrivateRegistriesMap)
+		certificates, err = pki.FetchCertificatesFromHost(ctx, kubeCluster.EtcdHosts, kubeCluster.getKubeletHosts(), host, kubeCluster.SystemImages.Alpine, kubeCluster.LocalKubeConfigPath, kubeCluster.PrivateRegistriesMap)
 		if certificates != nil {
 			return certificates, nil
 		}
@@ -281,12 +293,33 @@ func fetchBackupCertificates(ctx context.Context, backupHosts []*hosts.Host, kub
 	return nil, err
 }
 
+// GetClusterCertificates loads the certificates bundle saved as secrets in kubernetes
+func (c *Cluster) GetClusterCertificates(ctx context.Context) (map[string]pki.CertificatePKI, error) {
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create Kubernetes Client: %v", err)
+	}
+	return getClusterCerts(ctx, kubeClient, c.EtcdHosts, c.getKubeletHosts())
+}
+
+// GetBackupCertificates loads the certificates bundle from the backups on the etcd and controlplane hosts
+func (c *Cluster) GetBackupCertificates(ctx context.Context) (map[string]pki.CertificatePKI, error) {
+	certificates, err := fetchBackupCertificates(ctx, c.getBackupHosts(), c)
+	if err != nil {
+		return nil, err
+	}
+	if certificates == nil {
+		return nil, fmt.Errorf("No certificate backup found on cluster hosts")
+	}
+	return certificates, nil
+}
+
 func fetchCertificatesFromEtcd(ctx context.Context, kubeCluster *Cluster) ([]byte, []byte, error) {
 	// Get kubernetes certificates from the etcd hosts
 	certificates := map[string]pki.CertificatePKI{}
 	var err error
 	for _, host := range kubeCluster.EtcdHosts {
-		certificates, err = pki.FetchCertificatesFromHost(ctx, kubeCluster.EtcdHosts, host, kubeCluster.SystemImages.Alpine, kubeCluster.LocalKubeConfigPath, kubeCluster.PrivateRegistriesMap)
+		certificates, err = pki.FetchCertificatesFromHost(ctx, kubeCluster.EtcdHosts, kubeCluster.getKubeletHosts(), host, kubeCluster.SystemImages.Alpine, kubeCluster.LocalKubeConfigPath, kubeCluster.PrivateRegistriesMap)
 		if certificates != nil {
 			break
 		}
@@ -393,13 +426,13 @@ func RotateKECertificates(ctx context.Context, c *Cluster, configPath, configDir
 	var (
 		serviceAccountTokenKey string
 	)
-	componentsCertsFuncMap := map[string]pki.GenFunc{
-		services.KubeAPIContainerName:        pki.GenerateKubeAPICertificate,
-		services.KubeControllerContainerName: pki.GenerateKubeControllerCertificate,
-		services.SchedulerContainerName:      pki.GenerateKubeSchedulerCertificate,
-		services.KubeproxyContainerName:      pki.GenerateKubeProxyCertificate,
-		services.KubeletContainerName:        pki.GenerateKubeNodeCertificate,
-		services.EtcdContainerName:           pki.GenerateEtcdCertificates,
+	componentsCertsFuncMap := map[string][]pki.GenFunc{
+		services.KubeAPIContainerName:        {pki.GenerateKubeAPICertificate},
+		services.KubeControllerContainerName: {pki.GenerateKubeControllerCertificate},
+		services.SchedulerContainerName:      {pki.GenerateKubeSchedulerCertificate},
+		services.KubeproxyContainerName:      {pki.GenerateKubeProxyCertificate},
+		services.KubeletContainerName:        {pki.GenerateKubeNodeCertificate, pki.GenerateKubeletCertificates, pki.GenerateKubeletServingCertificates},
+		services.EtcdContainerName:           {pki.GenerateEtcdCertificates},
 	}
 	if rotateCACerts {
 		// rotate CA cert and RequestHeader CA cert
@@ -409,8 +442,7 @@ func RotateKECertificates(ctx context.Context, c *Cluster, configPath, configDir
 		components = nil
 	}
 	for _, k8sComponent := range components {
-		genFunc := componentsCertsFuncMap[k8sComponent]
-		if genFunc != nil {
+		for _, genFunc := range componentsCertsFuncMap[k8sComponent] {
 			if err := genFunc(ctx, c.Certificates, c.KubernetesEngineConfig, configPath, configDir); err != nil {
 				return err
 			}
@@ -439,3 +471,172 @@ func RotateKECertificates(ctx context.Context, c *Cluster, configPath, configDir
 	}
 	return nil
 }
+
+// RenewExpiringCertificates reissues the leaf certificates that expire within
+// the configured auto_renew_before period and returns the renewed names, along
+// with the kubelet serving certificates reissued for changed node addresses.
+func RenewExpiringCertificates(ctx context.Context, c *Cluster, configPath, configDir string) ([]string, error) {
+	renewed := append([]string{}, c.ReissuedCerts...)
+	if len(c.CertificatesConfig.AutoRenewBefore) == 0 || !c.hasAuthnStrategy(X509AuthenticationProvider) {
+		sort.Strings(renewed)
+		return renewed, nil
+	}
+	renewBefore, err := parseCertRenewBefore(c.CertificatesConfig.AutoRenewBefore)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(renewBefore)
+	isExpiring := func(name string) bool {
+		crt := c.Certificates[name].Certificate
+		return crt != nil && crt.NotAfter.Before(deadline)
+	}
+	for _, caName := range []string{pki.CACertName, pki.RequestHeaderCACertName} {
+		if isExpiring(caName) {
+			log.Warningf("[certificates] CA certificate [%s] expires at %s, it can only be renewed with cert rotate --rotate-ca", caName, c.Certificates[caName].Certificate.NotAfter)
+		}
+	}
+
+	certsGenFuncMap := map[string]pki.GenFunc{
+		pki.KubeAPICertName:        pki.GenerateKubeAPICertificate,
+		pki.KubeControllerCertName: pki.GenerateKubeControllerCertificate,
+		pki.KubeSchedulerCertName:  pki.GenerateKubeSchedulerCertificate,
+		pki.KubeProxyCertName:      pki.GenerateKubeProxyCertificate,
+		pki.KubeNodeCertName:       pki.GenerateKubeNodeCertificate,
+		pki.KubeAdminCertName:      pki.GenerateKubeAdminCertificate,
+		pki.APIProxyClientCertName: pki.GenerateAPIProxyClientCertificate,
+	}
+	for certName, genFunc := range certsGenFuncMap {
+		if !isExpiring(certName) {
+			continue
+		}
+		log.Infof("[certificates] Certificate [%s] expires at %s, renewing it", certName, c.Certificates[certName].Certificate.NotAfter)
+		if certName == pki.KubeAPICertName {
+			// the kube-apiserver certificate is kept while its SANs don't change, drop it to get a new one
+			// but keep the key which signs the service account tokens of old clusters
+			c.Certificates[certName] = pki.CertificatePKI{Key: c.Certificates[certName].Key}
+		}
+		if err := genFunc(ctx, c.Certificates, c.KubernetesEngineConfig, configPath, configDir); err != nil {
+			return nil, fmt.Errorf("Failed to renew certificate [%s]: %v", certName, err)
+		}
+		renewed = append(renewed, certName)
+	}
+
+	for _, node := range c.Nodes {
+		certName := pki.GetKubeletCrtName(pki.GetNodeName(node))
+		if !isExpiring(certName) {
+			continue
+		}
+		log.Infof("[certificates] Certificate [%s] expires at %s, renewing it", certName, c.Certificates[certName].Certificate.NotAfter)
+		if err := pki.GenerateKubeletCertificate(c.Certificates, pki.GetNodeName(node)); err != nil {
+			return nil, fmt.Errorf("Failed to renew certificate [%s]: %v", certName, err)
+		}
+		renewed = append(renewed, certName)
+	}
+	for _, node := range c.Nodes {
+		certName := pki.GetKubeletServingCrtName(pki.GetNodeName(node))
+		if !isExpiring(certName) {
+			continue
+		}
+		log.Infof("[certificates] Certificate [%s] expires at %s, renewing it", certName, c.Certificates[certName].Certificate.NotAfter)
+		if err := pki.GenerateKubeletServingCertificate(c.Certificates, node); err != nil {
+			return nil, fmt.Errorf("Failed to renew certificate [%s]: %v", certName, err)
+		}
+		renewed = append(renewed, certName)
+	}
+
+	if len(c.Services.Etcd.ExternalURLs) == 0 {
+		etcdExpiring := false
+		for _, host := range c.EtcdHosts {
+			if isExpiring(pki.GetEtcdCrtName(host.InternalAddress)) {
+				etcdExpiring = true
+				break
+			}
+		}
+		if etcdExpiring {
+			log.Infof("[certificates] Etcd certificates are about to expire, renewing them")
+			if err := pki.GenerateEtcdCertificates(ctx, c.Certificates, c.KubernetesEngineConfig, configPath, configDir); err != nil {
+				return nil, fmt.Errorf("Failed to renew etcd certificates: %v", err)
+			}
+			for _, host := range c.EtcdHosts {
+				renewed = append(renewed, pki.GetEtcdCrtName(host.InternalAddress))
+			}
+		}
+	}
+	sort.Strings(renewed)
+	return renewed, nil
+}
+
+// RestartRenewedCertsServices restarts the containers using any of the renewed
+// certificates, the per node kubelet certificates only restart their own host.
+func RestartRenewedCertsServices(ctx context.Context, c *Cluster, renewedCerts []string) error {
+	restartEtcd, restartControl, workerHosts := getRenewedCertsRestarts(c, renewedCerts)
+	if restartEtcd {
+		if err := services.RestartEtcdPlane(ctx, c.EtcdHosts); err != nil {
+			return err
+		}
+	}
+	if restartControl {
+		if err := services.RestartControlPlane(ctx, c.ControlPlaneHosts); err != nil {
+			return err
+		}
+	}
+	if len(workerHosts) > 0 {
+		if err := services.RestartWorkerPlane(ctx, workerHosts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRenewedCertsRestarts tells whether the etcd and control planes use any of
+// the renewed certificates, and returns the hosts whose worker components do.
+func getRenewedCertsRestarts(c *Cluster, renewedCerts []string) (bool, bool, []*hosts.Host) {
+	var restartEtcd, restartControl, restartWorker bool
+	kubeletHosts := c.getKubeletHosts()
+	kubeletCrtHosts := map[string]*hosts.Host{}
+	for _, host := range kubeletHosts {
+		nodeName := pki.GetNodeName(host.ConfigNode)
+		kubeletCrtHosts[pki.GetKubeletCrtName(nodeName)] = host
+		kubeletCrtHosts[pki.GetKubeletServingCrtName(nodeName)] = host
+	}
+	workerHosts := []*hosts.Host{}
+	for _, certName := range renewedCerts {
+		switch {
+		case strings.HasPrefix(certName, pki.EtcdCertName):
+			restartEtcd = true
+		case certName == pki.KubeNodeCertName:
+			// kube-apiserver uses the node certificate as etcd client
+			restartControl = true
+		case certName == pki.KubeProxyCertName:
+			restartWorker = true
+		case pki.IsKubeletCrtName(certName), pki.IsKubeletServingCrtName(certName):
+			if host, ok := kubeletCrtHosts[certName]; ok {
+				workerHosts = append(workerHosts, host)
+			}
+		case certName == pki.KubeAPICertName,
+			certName == pki.KubeControllerCertName,
+			certName == pki.KubeSchedulerCertName,
+			certName == pki.APIProxyClientCertName:
+			restartControl = true
+		}
+	}
+	if restartWorker {
+		return restartEtcd, restartControl, kubeletHosts
+	}
+	return restartEtcd, restartControl, hosts.GetUniqueHostList(workerHosts, nil, nil)
+}
+
+func parseCertRenewBefore(renewBefore string) (time.Duration, error) {
+	if strings.HasSuffix(renewBefore, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(renewBefore, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("Invalid certificates auto_renew_before [%s]", renewBefore)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(renewBefore)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("Invalid certificates auto_renew_before [%s]", renewBefore)
+	}
+	return duration, nil
+}
@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func TestGetRenewedCertsRestarts(t *testing.T) {
+	etcd := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.1", HostnameOverride: "etcd"}}
+	control := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.2", HostnameOverride: "control"}}
+	worker1 := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.3", HostnameOverride: "worker.1"}}
+	worker2 := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.4", HostnameOverride: "worker.2"}}
+	c := &Cluster{
+		EtcdHosts:         []*hosts.Host{etcd},
+		ControlPlaneHosts: []*hosts.Host{control},
+		WorkerHosts:       []*hosts.Host{worker1, worker2},
+	}
+	tests := []struct {
+		name        string
+		certs       []string
+		etcd        bool
+		control     bool
+		workerHosts []string
+	}{
+		{
+			name: "nothing renewed",
+		},
+		{
+			name:  "etcd",
+			certs: []string{pki.GetEtcdCrtName(etcd.InternalAddress)},
+			etcd:  true,
+		},
+		{
+			name:    "node certificate",
+			certs:   []string{pki.KubeNodeCertName},
+			control: true,
+		},
+		{
+			name:        "kube-proxy",
+			certs:       []string{pki.KubeProxyCertName},
+			workerHosts: []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4"},
+		},
+		{
+			name:        "one kubelet",
+			certs:       []string{pki.GetKubeletCrtName("worker.1")},
+			workerHosts: []string{"1.1.1.3"},
+		},
+		{
+			name:        "client and serving certificates of one kubelet",
+			certs:       []string{pki.GetKubeletCrtName("worker.1"), pki.GetKubeletServingCrtName("worker.1")},
+			workerHosts: []string{"1.1.1.3"},
+		},
+		{
+			name:        "serving certificates of two kubelets",
+			certs:       []string{pki.GetKubeletServingCrtName("control"), pki.GetKubeletServingCrtName("worker.2")},
+			workerHosts: []string{"1.1.1.2", "1.1.1.4"},
+		},
+		{
+			name:        "removed node",
+			certs:       []string{pki.GetKubeletServingCrtName("gone")},
+			workerHosts: []string{},
+		},
+		{
+			name:    "control plane",
+			certs:   []string{pki.KubeAPICertName, pki.KubeSchedulerCertName},
+			control: true,
+		},
+	}
+	for _, test := range tests {
+		restartEtcd, restartControl, workerHosts := getRenewedCertsRestarts(c, test.certs)
+		addresses := []string{}
+		for _, host := range workerHosts {
+			addresses = append(addresses, host.Address)
+		}
+		sort.Strings(addresses)
+		if restartEtcd != test.etcd || restartControl != test.control || len(addresses) != len(test.workerHosts) {
+			t.Errorf("%s: getRenewedCertsRestarts() = %v, %v, %v, want %v, %v, %v", test.name, restartEtcd, restartControl, addresses, test.etcd, test.control, test.workerHosts)
+			continue
+		}
+		for i := range addresses {
+			if addresses[i] != test.workerHosts[i] {
+				t.Errorf("%s: restarted worker hosts %v, want %v", test.name, addresses, test.workerHosts)
+				break
+			}
+		}
+	}
+}
+
+func TestReissuedServingCertsRestarts(t *testing.T) {
+	c := &Cluster{}
+	c.Nodes = []types.ConfigNode{
+		{Address: "1.1.1.1", InternalAddress: "1.1.1.1", HostnameOverride: "node1", Role: []string{"controlplane", "etcd", "worker"}},
+		{Address: "1.1.1.2", InternalAddress: "1.1.1.2", HostnameOverride: "node2", Role: []string{"worker"}},
+	}
+	c.Services.KubeAPI.ServiceClusterIPRange = "10.43.0.0/16"
+	var err error
+	c.Certificates, err = pki.GenerateKECerts(context.Background(), c.KubernetesEngineConfig, "", "")
+	if err != nil {
+		t.Fatalf("Failed to generate certificates: %v", err)
+	}
+	// the address of node2 changed and node3 is added
+	c.Nodes[1].InternalAddress = "192.168.1.2"
+	c.Nodes = append(c.Nodes, types.ConfigNode{Address: "1.1.1.3", InternalAddress: "1.1.1.3", HostnameOverride: "node3", Role: []string{"worker"}})
+	if err := c.InvertIndexHosts(); err != nil {
+		t.Fatalf("Failed to classify hosts: %v", err)
+	}
+	if err := setUpKubeletCertificates(context.Background(), c); err != nil {
+		t.Fatalf("setUpKubeletCertificates: %v", err)
+	}
+	if len(c.ReissuedCerts) != 1 || c.ReissuedCerts[0] != pki.GetKubeletServingCrtName("node2") {
+		t.Fatalf("Reissued certificates %v, want only the serving certificate of node2", c.ReissuedCerts)
+	}
+	_, _, workerHosts := getRenewedCertsRestarts(c, c.ReissuedCerts)
+	if len(workerHosts) != 1 || workerHosts[0].Address != "1.1.1.2" {
+		t.Errorf("Restarted worker hosts %v, want only node2", workerHosts)
+	}
+}
@@ -53,24 +53,33 @@ type Cluster struct {
 	UpdateWorkersOnly            bool
 	CloudConfigFile              string
 	WebhookConfig                string
+	AuthzWebhookConfig           string
 	SchedulerPolicyConfig        string
+	AuditPolicyConfig            string
+	SecretsEncryptionConfig      string
+	SecretsEncryptionChanged     bool
+	StateFilePath                string
+	HostKeyVerifier              *hosts.HostKeyVerifier
+	ReissuedCerts                []string
+	KubeletBootstrapToken        string
 }
 
 const (
-	X509AuthenticationProvider = "x509"
-	StateConfigMapName         = "cluster-state"
-	UpdateStateTimeout         = 30
-	GetStateTimeout            = 30
-	KubernetesClientTimeOut    = 30
-	SyncWorkers                = 10
-	NoneAuthorizationMode      = "none"
-	LocalNodeAddress           = "127.0.0.1"
-	LocalNodeHostname          = "localhost"
-	LocalNodeUser              = "root"
-	CloudProvider              = "CloudProvider"
-	ControlPlane               = "controlPlane"
-	WorkerPlane                = "workerPlan"
-	EtcdPlane                  = "etcd"
+	X509AuthenticationProvider  = "x509"
+	StateConfigMapName          = "cluster-state"
+	UpdateStateTimeout          = 30
+	GetStateTimeout             = 30
+	KubernetesClientTimeOut     = 30
+	SyncWorkers                 = 10
+	NoneAuthorizationMode       = "none"
+	LocalNodeAddress            = "127.0.0.1"
+	LocalNodeHostname           = "localhost"
+	LocalNodeUser               = "root"
+	CloudProvider               = "CloudProvider"
+	ControlPlane                = "controlPlane"
+	WorkerPlane                 = "workerPlan"
+	EtcdPlane                   = "etcd"
+	SSHHostKeyFingerprintPrefix = "SHA256:"
 
 	KubeAppLabel = "k8s-app"
 	AppLabel     = "app"
@@ -91,9 +100,10 @@ func (c *Cluster) DeployControlPlane(ctx context.Context) error {
 		log.Infof("[etcd] External etcd connection string has been specified, skipping etcd plane")
 	} else {
 		etcdRollingSnapshot := services.EtcdSnapshot{
-			Snapshot:  c.Services.Etcd.Snapshot,
-			Creation:  c.Services.Etcd.Creation,
-			Retention: c.Services.Etcd.Retention,
+			Snapshot:       c.Services.Etcd.Snapshot,
+			Creation:       c.Services.Etcd.Creation,
+			Retention:      c.Services.Etcd.Retention,
+			S3BackupConfig: c.Services.Etcd.S3BackupConfig,
 		}
 		if err := services.RunEtcdPlane(ctx, c.EtcdHosts, etcdNodePlanMap, c.LocalConnDialerFactory, c.PrivateRegistriesMap, c.UpdateWorkersOnly, c.SystemImages.Alpine, etcdRollingSnapshot); err != nil {
 			return fmt.Errorf("[etcd] Failed to bring up Etcd Plane: %v", err)
@@ -106,7 +116,23 @@ func (c *Cluster) DeployControlPlane(ctx context.Context) error {
 	for _, cpHost := range c.ControlPlaneHosts {
 		cpNodePlanMap[cpHost.Address] = BuildKEConfigNodePlan(ctx, c, cpHost, cpHost.DockerInfo)
 	}
-	if err := services.RunControlPlane(ctx, c.ControlPlaneHosts,
+	upgradeHosts, otherHosts, err := splitUpgradeHosts(ctx, c.ControlPlaneHosts, cpNodePlanMap, controlPlaneUpgradeContainers...)
+	if err != nil {
+		return fmt.Errorf("[controlPlane] Failed to check Control Plane for upgrade: %v", err)
+	}
+	// upgrade running control plane hosts one by one before the rest
+	if len(upgradeHosts) > 0 {
+		if err := services.UpgradeControlPlane(ctx, upgradeHosts,
+			c.LocalConnDialerFactory,
+			c.PrivateRegistriesMap,
+			cpNodePlanMap,
+			c.UpdateWorkersOnly,
+			c.SystemImages.Alpine,
+			c.Certificates); err != nil {
+			return fmt.Errorf("[controlPlane] Failed to upgrade Control Plane: %v", err)
+		}
+	}
+	if err := services.RunControlPlane(ctx, otherHosts,
 		c.LocalConnDialerFactory,
 		c.PrivateRegistriesMap,
 		cpNodePlanMap,
@@ -127,7 +153,41 @@ func (c *Cluster) DeployWorkerPlane(ctx context.Context) error {
 	for _, workerHost := range allHosts {
 		workerNodePlanMap[workerHost.Address] = BuildKEConfigNodePlan(ctx, c, workerHost, workerHost.DockerInfo)
 	}
-	if err := services.RunWorkerPlane(ctx, allHosts,
+	upgradeHosts, otherHosts, err := splitUpgradeHosts(ctx, allHosts, workerNodePlanMap, workerPlaneUpgradeContainers...)
+	if err != nil {
+		return fmt.Errorf("[workerPlane] Failed to check Worker Plane for upgrade: %v", err)
+	}
+	if c.UpdateWorkersOnly {
+		toUpgrade := []*hosts.Host{}
+		for _, host := range upgradeHosts {
+			if host.UpdateWorker {
+				toUpgrade = append(toUpgrade, host)
+			}
+		}
+		upgradeHosts = toUpgrade
+	}
+	if len(upgradeHosts) > 0 {
+		maxUnavailable, err := getMaxUnavailable(c.UpgradeStrategy.MaxUnavailable, len(c.WorkerHosts))
+		if err != nil {
+			return err
+		}
+		kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+		if err != nil {
+			return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+		}
+		if err := services.UpgradeWorkerPlane(ctx, upgradeHosts,
+			kubeClient,
+			c.LocalConnDialerFactory,
+			c.PrivateRegistriesMap,
+			workerNodePlanMap,
+			c.Certificates,
+			c.SystemImages.Alpine,
+			c.UpgradeStrategy,
+			maxUnavailable); err != nil {
+			return fmt.Errorf("[workerPlane] Failed to upgrade Worker Plane: %v", err)
+		}
+	}
+	if err := services.RunWorkerPlane(ctx, otherHosts,
 		c.LocalConnDialerFactory,
 		c.PrivateRegistriesMap,
 		workerNodePlanMap,
@@ -167,6 +227,14 @@ func ParseCluster(
 	// Setting cluster Defaults
 	c.setClusterDefaults(ctx)
 
+	if len(c.ConfigPath) == 0 {
+		c.ConfigPath = pki.ClusterConfig
+	}
+	c.StateFilePath = GetStateFilePath(c.ConfigPath, configDir)
+	if err := c.setHostKeyVerifier(ctx); err != nil {
+		return nil, err
+	}
+
 	if err := c.InvertIndexHosts(); err != nil {
 		return nil, fmt.Errorf("Failed to classify hosts from config file: %v", err)
 	}
@@ -176,11 +244,21 @@ func ParseCluster(
 		return nil, fmt.Errorf("Failed to parse webhook config: %v", err)
 	}
 
+	// parse AuthzWebhookConfig
+	if err := c.parseAuthzWebhookConfig(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to parse authorization webhook config: %v", err)
+	}
+
 	// parse SchedulerPolicyConfig
 	if err := c.parseSchedulerConfig(ctx); err != nil {
 		return nil, fmt.Errorf("Failed to parse scheduler config: %v", err)
 	}
 
+	// parse AuditPolicyConfig
+	if err := c.parseAuditPolicy(ctx); err != nil {
+		return nil, fmt.Errorf("Failed to parse audit policy: %v", err)
+	}
+
 	if err := c.ValidateCluster(); err != nil {
 		return nil, fmt.Errorf("Failed to validate cluster: %v", err)
 	}
@@ -191,9 +269,6 @@ func ParseCluster(
 	c.ClusterDomain = c.Services.Kubelet.ClusterDomain
 	c.ClusterCIDR = c.Services.KubeController.ClusterCIDR
 	c.ClusterDNSServer = c.Services.Kubelet.ClusterDNSServer
-	if len(c.ConfigPath) == 0 {
-		c.ConfigPath = pki.ClusterConfig
-	}
 	c.LocalKubeConfigPath = pki.GetLocalKubeConfig(c.ConfigPath, configDir)
 
 	for _, pr := range c.PrivateRegistries {
@@ -220,9 +295,13 @@ func ParseCluster(
 	}
 
 	// Create k8s wrap transport for bastion host
-	if len(c.BastionHost.Address) > 0 {
+	if c.hasBastionHosts() {
+		hostBastionHosts := map[string]types.BastionHosts{}
+		for _, host := range c.ControlPlaneHosts {
+			hostBastionHosts[host.Address] = host.BastionHost
+		}
 		var err error
-		c.K8sWrapTransport, err = hosts.BastionHostWrapTransport(c.BastionHost)
+		c.K8sWrapTransport, err = hosts.BastionHostWrapTransport(c.BastionHost, hostBastionHosts, c.HostKeyVerifier, c.FallbackSSHKeyPassphrase)
 		if err != nil {
 			return nil, err
 		}
@@ -230,6 +309,18 @@ func ParseCluster(
 	return c, nil
 }
 
+func (c *Cluster) hasBastionHosts() bool {
+	if len(c.BastionHost) > 0 {
+		return true
+	}
+	for _, node := range c.Nodes {
+		if len(node.BastionHost) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 	if len(kubeCluster.ControlPlaneHosts) == 0 {
 		return nil
@@ -238,12 +329,11 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 	var workingConfig, newConfig string
 	currentKubeConfig := kubeCluster.Certificates[pki.KubeAdminCertName]
 	caCrt := kubeCluster.Certificates[pki.CACertName].Certificate
-	for _, cpHost := range kubeCluster.ControlPlaneHosts {
+	for _, kubeURL := range kubeCluster.getKubeAPIURLs() {
 		if (currentKubeConfig == pki.CertificatePKI{}) {
 			kubeCluster.Certificates = make(map[string]pki.CertificatePKI)
-			newConfig = getLocalAdminConfigWithNewAddress(kubeCluster.LocalKubeConfigPath, cpHost.Address, kubeCluster.ClusterName)
+			newConfig = getLocalAdminConfigWithNewAddress(kubeCluster.LocalKubeConfigPath, kubeURL, kubeCluster.ClusterName)
 		} else {
-			kubeURL := fmt.Sprintf("https://%s:6443", cpHost.Address)
 			caData := string(cert.EncodeCertPEM(caCrt))
 			crtData := string(cert.EncodeCertPEM(currentKubeConfig.Certificate))
 			keyData := string(cert.EncodePrivateKeyPEM(currentKubeConfig.Key))
@@ -257,7 +347,7 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 		}
 		workingConfig = newConfig
 		if _, err := GetK8sVersion(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport); err == nil {
-			log.Infof("[reconcile] host [%s] is active master on the cluster", cpHost.Address)
+			log.Infof("[reconcile] [%s] is active master on the cluster", kubeURL)
 			break
 		}
 	}
@@ -266,6 +356,19 @@ func rebuildLocalAdminConfig(ctx context.Context, kubeCluster *Cluster) error {
 	return nil
 }
 
+// getKubeAPIURLs returns the URLs tried for the local admin config, the
+// control plane endpoint follows the active masters by itself.
+func (c *Cluster) getKubeAPIURLs() []string {
+	if len(c.ControlPlaneEndpoint.Address) > 0 {
+		return []string{pki.GetKubeAPIURL(c.ControlPlaneEndpoint, c.ControlPlaneHosts)}
+	}
+	urls := []string{}
+	for _, cpHost := range c.ControlPlaneHosts {
+		urls = append(urls, pki.GetKubeAPIURL(c.ControlPlaneEndpoint, []*hosts.Host{cpHost}))
+	}
+	return urls
+}
+
 func isLocalConfigWorking(ctx context.Context, localKubeConfigPath string, k8sWrapTransport k8s.WrapTransport) bool {
 	if _, err := GetK8sVersion(localKubeConfigPath, k8sWrapTransport); err != nil {
 		log.Infof("[reconcile] Local config is not vaild, rebuilding admin config")
@@ -284,14 +387,14 @@ func getLocalConfigAddress(localConfigPath string) (string, error) {
 	return address[2:], nil
 }
 
-func getLocalAdminConfigWithNewAddress(localConfigPath, cpAddress string, clusterName string) string {
+func getLocalAdminConfigWithNewAddress(localConfigPath, kubeURL string, clusterName string) string {
 	config, _ := clientcmd.BuildConfigFromFlags("", localConfigPath)
 	if config == nil {
 		return ""
 	}
-	config.Host = fmt.Sprintf("https://%s:6443", cpAddress)
+	config.Host = kubeURL
 	return pki.GetKubeConfigX509WithData(
-		"https://"+cpAddress+":6443",
+		kubeURL,
 		clusterName,
 		pki.KubeAdminCertName,
 		string(config.CAData),
@@ -314,12 +417,17 @@ func ApplyAuthzResources(ctx context.Context, config types.KubernetesEngineConfi
 	if kubeCluster.Authorization.Mode == NoneAuthorizationMode {
 		return nil
 	}
-	if kubeCluster.Authorization.Mode == services.RBACAuthorizationMode {
+	if kubeCluster.hasAuthzMode(services.RBACAuthorizationMode) {
 		if err := authz.ApplySystemNodeClusterRoleBinding(ctx, kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport); err != nil {
 			return fmt.Errorf("Failed to apply the ClusterRoleBinding needed for node authorization: %v", err)
 		}
+		if kubeCluster.isKubeletBootstrap() {
+			if err := authz.ApplyKubeletBootstrapClusterRoleBindings(ctx, kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport); err != nil {
+				return fmt.Errorf("Failed to apply the ClusterRoleBindings needed for kubelet bootstrap: %v", err)
+			}
+		}
 	}
-	if kubeCluster.Authorization.Mode == services.RBACAuthorizationMode && kubeCluster.Services.KubeAPI.PodSecurityPolicy {
+	if kubeCluster.hasAuthzMode(services.RBACAuthorizationMode) && kubeCluster.Services.KubeAPI.PodSecurityPolicy {
 		if err := authz.ApplyDefaultPodSecurityPolicy(ctx, kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport); err != nil {
 			return fmt.Errorf("Failed to apply default PodSecurityPolicy: %v", err)
 		}
@@ -470,21 +578,6 @@ func (c *Cluster) AllHosts() []*hosts.Host {
 	return hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
 }
 
-func (c *Cluster) parseWebhookConfig(ctx context.Context) error {
-	if c.WebhookAuth.URL == "" {
-		return nil
-	}
-
-	config, err := templates.CompileTemplateFromMap(templates.WebhookAuthTemplate, map[string]string{
-		"URL": c.WebhookAuth.URL,
-	})
-	if err != nil {
-		return fmt.Errorf("Generate webhook auth config error: %v", err)
-	}
-	c.WebhookConfig = config
-	return nil
-}
-
 func (c *Cluster) parseSchedulerConfig(ctx context.Context) error {
 	if c.YunionConfig.SchedulerUrl == "" {
 		return nil
@@ -515,17 +608,15 @@ func RestartClusterPods(ctx context.Context, kubeCluster *Cluster) error {
 	if err != nil {
 		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
 	}
-	// TODO: our app
 	labelsList := []string{
-		fmt.Sprintf("%s=%s", KubeAppLabel, fmt.Sprintf("%s-cni", YunionNetworkPlugin)),
-		//fmt.Sprintf("%s=%s", KubeAppLabel, FlannelNetworkPlugin),
-		//fmt.Sprintf("%s=%s", KubeAppLabel, CanalNetworkPlugin),
-		//fmt.Sprintf("%s=%s", NameLabel, WeaveNetworkPlugin),
 		fmt.Sprintf("%s=%s", AppLabel, NginxIngressAddonAppName),
 		fmt.Sprintf("%s=%s", KubeAppLabel, DefaultMonitoringProvider),
 		fmt.Sprintf("%s=%s", KubeAppLabel, KubeDNSAddonAppName),
 		fmt.Sprintf("%s=%s", KubeAppLabel, KubeDNSAutoscalerAppName),
 	}
+	if plugin, err := GetNetworkPlugin(kubeCluster.Network.Plugin); err == nil {
+		labelsList = append(labelsList, plugin.PodSelectors()...)
+	}
 	var errgrp errgroup.Group
 	labelQueue := util.GetObjectQueue(labelsList)
 	for w := 0; w < services.WorkerThreads; w++ {
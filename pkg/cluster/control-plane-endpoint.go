@@ -0,0 +1,227 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/yke/pkg/docker"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
+)
+
+const (
+	ControlPlaneEndpointVIP      = "vip"
+	ControlPlaneEndpointExternal = "external"
+
+	// kube-apiserver already listens on 6443 of every address of the
+	// control plane hosts, haproxy can't take it for the virtual IP
+	DefaultControlPlaneVIPPort      = "8443"
+	DefaultControlPlaneExternalPort = KubeAPIPort
+	DefaultVirtualRouterID          = 51
+
+	KeepalivedConfEnv = "KEEPALIVED_CONF"
+	HAProxyConfEnv    = "HAPROXY_CFG"
+	// kubelet and kube-proxy are restarted when the kube-apiserver address
+	// of their kubeconfigs changes
+	KubeAPIEndpointEnv = "YKE_KUBE_API_ENDPOINT"
+)
+
+func (c *Cluster) setControlPlaneEndpointDefaults() {
+	endpoint := &c.ControlPlaneEndpoint
+	switch endpoint.Mode {
+	case ControlPlaneEndpointVIP:
+		setDefaultIfEmpty(&endpoint.Port, DefaultControlPlaneVIPPort)
+		if endpoint.VirtualRouterID == 0 {
+			endpoint.VirtualRouterID = DefaultVirtualRouterID
+		}
+	case ControlPlaneEndpointExternal:
+		setDefaultIfEmpty(&endpoint.Port, DefaultControlPlaneExternalPort)
+	}
+}
+
+func (c *Cluster) isControlPlaneVIP() bool {
+	return c.ControlPlaneEndpoint.Mode == ControlPlaneEndpointVIP
+}
+
+// getKubeAPIEndpointEnv returns the env of the worker components of a node
+// going through the control plane endpoint, their kubeconfigs are rewritten
+// when it's set or changed but the files aren't watched.
+func (c *Cluster) getKubeAPIEndpointEnv(host *hosts.Host) []string {
+	if host.IsControl || len(c.ControlPlaneEndpoint.Address) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s=%s", KubeAPIEndpointEnv, pki.GetKubeAPIURL(c.ControlPlaneEndpoint, nil))}
+}
+
+func validateControlPlaneEndpoint(c *Cluster) error {
+	endpoint := c.ControlPlaneEndpoint
+	if len(endpoint.Mode) == 0 {
+		if len(endpoint.Address) > 0 {
+			return fmt.Errorf("Control plane endpoint mode must be %s or %s", ControlPlaneEndpointVIP, ControlPlaneEndpointExternal)
+		}
+		return nil
+	}
+	if endpoint.Mode != ControlPlaneEndpointVIP && endpoint.Mode != ControlPlaneEndpointExternal {
+		return fmt.Errorf("Control plane endpoint mode [%s] is not supported, must be %s or %s", endpoint.Mode, ControlPlaneEndpointVIP, ControlPlaneEndpointExternal)
+	}
+	if len(endpoint.Address) == 0 {
+		return fmt.Errorf("Control plane endpoint address can't be empty")
+	}
+	if port, err := strconv.Atoi(endpoint.Port); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("Control plane endpoint port [%s] is not valid", endpoint.Port)
+	}
+	if endpoint.Mode == ControlPlaneEndpointExternal {
+		return nil
+	}
+	vip := net.ParseIP(endpoint.Address)
+	if vip == nil {
+		return fmt.Errorf("Control plane endpoint address [%s] must be an IP address in %s mode", endpoint.Address, ControlPlaneEndpointVIP)
+	}
+	for _, node := range c.Nodes {
+		if vip.Equal(net.ParseIP(node.Address)) || vip.Equal(net.ParseIP(node.InternalAddress)) {
+			return fmt.Errorf("Control plane endpoint address [%s] is the address of node [%s], the virtual IP must be unused", endpoint.Address, node.Address)
+		}
+	}
+	for _, host := range c.ControlPlaneHosts {
+		// the subnet of the interface is checked by the preflight checks
+		if ip := net.ParseIP(host.InternalAddress); ip != nil && isIPv6(ip) != isIPv6(vip) {
+			return fmt.Errorf("Control plane endpoint address [%s] is not in the network of control plane host [%s]", endpoint.Address, host.Address)
+		}
+	}
+	for _, port := range c.getControlPlaneHostPorts() {
+		if endpoint.Port == port {
+			return fmt.Errorf("Control plane endpoint port can't be %s in %s mode, it's already used on the control plane hosts", port, ControlPlaneEndpointVIP)
+		}
+	}
+	if len(endpoint.Interface) == 0 {
+		return fmt.Errorf("Control plane endpoint interface can't be empty in %s mode", ControlPlaneEndpointVIP)
+	}
+	if endpoint.VirtualRouterID < 1 || endpoint.VirtualRouterID > 255 {
+		return fmt.Errorf("Control plane endpoint virtual router id [%d] must be between 1 and 255", endpoint.VirtualRouterID)
+	}
+	return nil
+}
+
+// getControlPlaneHostPorts returns the ports taken on the host network of
+// the control plane hosts, haproxy can't listen on them.
+func (c *Cluster) getControlPlaneHostPorts() []string {
+	ports := []string{KubeAPIPort, EtcdPort1, EtcdPort2, KubeletPort, ScedulerPort, ControllerPort, KubeProxyPort}
+	return append(ports, c.getNetworkPluginPortList(ProtocolTCP)...)
+}
+
+// BuildKeepalivedProcess runs keepalived holding the virtual IP on one of the
+// control plane hosts, the hosts talk VRRP to each other over unicast. A host
+// whose haproxy stops answering gives the virtual IP up.
+func (c *Cluster) BuildKeepalivedProcess(host *hosts.Host) types.Process {
+	endpoint := c.ControlPlaneEndpoint
+	priority := 100
+	peers := []string{}
+	for i, cpHost := range c.ControlPlaneHosts {
+		if cpHost.Address == host.Address {
+			// the first hosts are preferred, the virtual IP stays where it is
+			// when a preferred host comes back
+			priority = 150 - i
+			continue
+		}
+		peers = append(peers, "    "+cpHost.InternalAddress)
+	}
+	conf := fmt.Sprintf(`global_defs {
+  router_id %s
+  script_user root
+}
+vrrp_script check_haproxy {
+  script "/bin/busybox nc -z -w 2 127.0.0.1 %s"
+  interval 2
+  timeout 3
+  fall 2
+  rise 2
+}
+vrrp_instance kube_apiserver {
+  state BACKUP
+  nopreempt
+  interface %s
+  virtual_router_id %d
+  priority %d
+  advert_int 1
+  unicast_src_ip %s
+  unicast_peer {
+%s
+  }
+  virtual_ipaddress {
+    %s
+  }
+  track_script {
+    check_haproxy
+  }
+}
+`, host.HostnameOverride, endpoint.Port, endpoint.Interface, endpoint.VirtualRouterID, priority, host.InternalAddress, strings.Join(peers, "\n"), endpoint.Address)
+
+	Env := []string{fmt.Sprintf("%s=%s", KeepalivedConfEnv, conf)}
+	registryAuthConfig, _, _ := docker.GetImageRegistryConfig(c.SystemImages.Keepalived, c.PrivateRegistriesMap)
+	return types.Process{
+		Name: services.KeepalivedContainerName,
+		Env:  Env,
+		Command: []string{
+			"sh", "-c",
+			fmt.Sprintf("printf '%%s' \"$%s\" > /etc/keepalived/keepalived.conf && exec keepalived --dont-fork --log-console --use-file /etc/keepalived/keepalived.conf", KeepalivedConfEnv),
+		},
+		NetworkMode:             "host",
+		RestartPolicy:           "always",
+		Privileged:              true,
+		HealthCheck:             types.HealthCheck{},
+		Image:                   c.SystemImages.Keepalived,
+		ImageRegistryAuthConfig: registryAuthConfig,
+		Labels: map[string]string{
+			ContainerNameLabel: services.KeepalivedContainerName,
+		},
+	}
+}
+
+// BuildHAProxyProcess runs haproxy on the control plane endpoint port, it
+// only forwards to the kube-apiservers passing their health checks.
+func (c *Cluster) BuildHAProxyProcess() types.Process {
+	servers := []string{}
+	for _, cpHost := range c.ControlPlaneHosts {
+		servers = append(servers, fmt.Sprintf("  server %s %s check check-ssl verify none", cpHost.HostnameOverride, net.JoinHostPort(cpHost.InternalAddress, KubeAPIPort)))
+	}
+	conf := fmt.Sprintf(`global
+  maxconn 4000
+defaults
+  mode tcp
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+frontend kube_apiserver
+  bind :%s
+  default_backend kube_apiserver
+backend kube_apiserver
+  balance roundrobin
+  option httpchk GET /healthz
+  http-check expect status 200
+  default-server inter 5s fall 3 rise 2
+%s
+`, c.ControlPlaneEndpoint.Port, strings.Join(servers, "\n"))
+
+	Env := []string{fmt.Sprintf("%s=%s", HAProxyConfEnv, conf)}
+	registryAuthConfig, _, _ := docker.GetImageRegistryConfig(c.SystemImages.HAProxy, c.PrivateRegistriesMap)
+	return types.Process{
+		Name: services.HAProxyContainerName,
+		Env:  Env,
+		Command: []string{
+			"sh", "-c",
+			fmt.Sprintf("printf '%%s' \"$%s\" > /tmp/haproxy.cfg && exec haproxy -db -f /tmp/haproxy.cfg", HAProxyConfEnv),
+		},
+		NetworkMode:             "host",
+		RestartPolicy:           "always",
+		HealthCheck:             types.HealthCheck{},
+		Image:                   c.SystemImages.HAProxy,
+		ImageRegistryAuthConfig: registryAuthConfig,
+		Labels: map[string]string{
+			ContainerNameLabel: services.HAProxyContainerName,
+		},
+	}
+}
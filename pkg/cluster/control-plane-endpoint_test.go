@@ -0,0 +1,164 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
+)
+
+func newControlPlaneEndpointTestCluster(endpoint types.ControlPlaneEndpoint) *Cluster {
+	c := &Cluster{}
+	c.ControlPlaneEndpoint = endpoint
+	c.Network.Plugin = CalicoNetworkPlugin
+	c.Nodes = []types.ConfigNode{
+		{Address: "1.1.1.1", InternalAddress: "10.0.0.1", HostnameOverride: "master1", Role: []string{services.ControlRole, services.ETCDRole}},
+		{Address: "1.1.1.2", InternalAddress: "10.0.0.2", HostnameOverride: "master2", Role: []string{services.ControlRole, services.ETCDRole}},
+		{Address: "1.1.1.3", InternalAddress: "10.0.0.3", HostnameOverride: "master3", Role: []string{services.ControlRole, services.ETCDRole}},
+		{Address: "1.1.1.4", InternalAddress: "10.0.0.4", HostnameOverride: "worker1", Role: []string{services.WorkerRole}},
+	}
+	c.setControlPlaneEndpointDefaults()
+	c.InvertIndexHosts()
+	return c
+}
+
+func TestValidateControlPlaneEndpoint(t *testing.T) {
+	vip := func(address, port, iface string) types.ControlPlaneEndpoint {
+		return types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointVIP, Address: address, Port: port, Interface: iface}
+	}
+	tests := []struct {
+		name     string
+		endpoint types.ControlPlaneEndpoint
+		err      string
+	}{
+		{name: "no endpoint"},
+		{name: "address without mode", endpoint: types.ControlPlaneEndpoint{Address: "10.0.0.100"}, err: "mode must be"},
+		{name: "unknown mode", endpoint: types.ControlPlaneEndpoint{Mode: "dns", Address: "10.0.0.100"}, err: "is not supported"},
+		{name: "external", endpoint: types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointExternal, Address: "lb.example.com"}},
+		{name: "external on the kube-apiserver port", endpoint: types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointExternal, Address: "lb.example.com", Port: KubeAPIPort}},
+		{name: "external without address", endpoint: types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointExternal}, err: "address can't be empty"},
+		{name: "invalid port", endpoint: vip("10.0.0.100", "65536", "eth0"), err: "port [65536] is not valid"},
+		{name: "vip", endpoint: vip("10.0.0.100", "", "eth0")},
+		{name: "vip on another port", endpoint: vip("10.0.0.100", "9443", "eth0")},
+		{name: "vip is a dns name", endpoint: vip("lb.example.com", "", "eth0"), err: "must be an IP address"},
+		{name: "vip is the internal address of a node", endpoint: vip("10.0.0.4", "", "eth0"), err: "is the address of node [1.1.1.4]"},
+		{name: "vip is the address of a node", endpoint: vip("1.1.1.2", "", "eth0"), err: "is the address of node [1.1.1.2]"},
+		{name: "ipv6 vip of ipv4 hosts", endpoint: vip("fd00::100", "", "eth0"), err: "is not in the network of control plane host"},
+		{name: "vip without interface", endpoint: vip("10.0.0.100", "", ""), err: "interface can't be empty"},
+		{name: "vip on the kube-apiserver port", endpoint: vip("10.0.0.100", KubeAPIPort, "eth0"), err: "port can't be 6443"},
+		{name: "vip on the etcd port", endpoint: vip("10.0.0.100", EtcdPort1, "eth0"), err: "port can't be 2379"},
+		{name: "vip on the kubelet port", endpoint: vip("10.0.0.100", KubeletPort, "eth0"), err: "port can't be 10250"},
+		{name: "vip on the network plugin port", endpoint: vip("10.0.0.100", CalicoBGPPort, "eth0"), err: "port can't be 179"},
+		{
+			name:     "vip with an invalid virtual router id",
+			endpoint: types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointVIP, Address: "10.0.0.100", Interface: "eth0", VirtualRouterID: 256},
+			err:      "virtual router id [256]",
+		},
+	}
+	for _, test := range tests {
+		err := validateControlPlaneEndpoint(newControlPlaneEndpointTestCluster(test.endpoint))
+		switch {
+		case err != nil && len(test.err) == 0:
+			t.Errorf("%s: %v", test.name, err)
+		case err == nil && len(test.err) > 0:
+			t.Errorf("%s: valid, want an error containing %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		}
+	}
+}
+
+func getProcessEnv(process []string, name string) string {
+	for _, env := range process {
+		if strings.HasPrefix(env, name+"=") {
+			return strings.TrimPrefix(env, name+"=")
+		}
+	}
+	return ""
+}
+
+func TestBuildKeepalivedProcess(t *testing.T) {
+	c := newControlPlaneEndpointTestCluster(types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointVIP, Address: "10.0.0.100", Interface: "eth0"})
+	tests := []struct {
+		host     *hosts.Host
+		priority string
+		peers    string
+	}{
+		{c.ControlPlaneHosts[0], "150", "    10.0.0.2\n    10.0.0.3"},
+		{c.ControlPlaneHosts[1], "149", "    10.0.0.1\n    10.0.0.3"},
+		{c.ControlPlaneHosts[2], "148", "    10.0.0.1\n    10.0.0.2"},
+	}
+	for _, test := range tests {
+		process := c.BuildKeepalivedProcess(test.host)
+		conf := getProcessEnv(process.Env, KeepalivedConfEnv)
+		expected := `global_defs {
+  router_id ` + test.host.HostnameOverride + `
+  script_user root
+}
+vrrp_script check_haproxy {
+  script "/bin/busybox nc -z -w 2 127.0.0.1 8443"
+  interval 2
+  timeout 3
+  fall 2
+  rise 2
+}
+vrrp_instance kube_apiserver {
+  state BACKUP
+  nopreempt
+  interface eth0
+  virtual_router_id 51
+  priority ` + test.priority + `
+  advert_int 1
+  unicast_src_ip ` + test.host.InternalAddress + `
+  unicast_peer {
+` + test.peers + `
+  }
+  virtual_ipaddress {
+    10.0.0.100
+  }
+  track_script {
+    check_haproxy
+  }
+}
+`
+		if conf != expected {
+			t.Errorf("keepalived config of [%s] is\n%s\nwant\n%s", test.host.Address, conf, expected)
+		}
+		if process.NetworkMode != "host" || !process.Privileged {
+			t.Errorf("keepalived of [%s] must run privileged on the host network", test.host.Address)
+		}
+	}
+}
+
+func TestBuildHAProxyProcess(t *testing.T) {
+	c := newControlPlaneEndpointTestCluster(types.ControlPlaneEndpoint{Mode: ControlPlaneEndpointVIP, Address: "10.0.0.100", Port: "9443", Interface: "eth0"})
+	process := c.BuildHAProxyProcess()
+	conf := getProcessEnv(process.Env, HAProxyConfEnv)
+	expected := `global
+  maxconn 4000
+defaults
+  mode tcp
+  timeout connect 5s
+  timeout client 1h
+  timeout server 1h
+frontend kube_apiserver
+  bind :9443
+  default_backend kube_apiserver
+backend kube_apiserver
+  balance roundrobin
+  option httpchk GET /healthz
+  http-check expect status 200
+  default-server inter 5s fall 3 rise 2
+  server master1 10.0.0.1:6443 check check-ssl verify none
+  server master2 10.0.0.2:6443 check check-ssl verify none
+  server master3 10.0.0.3:6443 check check-ssl verify none
+`
+	if conf != expected {
+		t.Errorf("haproxy config is\n%s\nwant\n%s", conf, expected)
+	}
+	if process.NetworkMode != "host" {
+		t.Errorf("haproxy must run on the host network")
+	}
+}
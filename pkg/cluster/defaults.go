@@ -6,6 +6,7 @@ import (
 
 	"yunion.io/x/log"
 	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
 	"yunion.io/x/yke/pkg/services"
 	"yunion.io/x/yke/pkg/types"
 )
@@ -34,6 +35,7 @@ const (
 	DefaultEtcdBackupRetentionPeriod = "24h"
 	DefaultMonitoringProvider        = "metrics-server"
 	DefaultDNSProvider               = "coredns"
+	DefaultUpgradeMaxUnavailable     = "10%"
 
 	DefaultEtcdHeartbeatIntervalName  = "heartbeat-interval"
 	DefaultEtcdHeartbeatIntervalValue = "500"
@@ -53,6 +55,24 @@ func setDefaultIfEmpty(varName *string, defaultValue string) {
 	}
 }
 
+func (c *Cluster) setBastionHostsDefaults(bastionHosts types.BastionHosts) {
+	for i, bastionHost := range bastionHosts {
+		if len(bastionHost.Port) == 0 {
+			bastionHosts[i].Port = DefaultSSHPort
+		}
+		if len(bastionHost.SSHKeyPath) == 0 {
+			bastionHosts[i].SSHKeyPath = c.SSHKeyPath
+		}
+		if len(bastionHost.SSHKeyPassphrase) == 0 {
+			bastionHosts[i].SSHKeyPassphrase = c.SSHKeyPassphrase
+		}
+		if len(bastionHost.SSHCert) == 0 && len(bastionHost.SSHCertPath) == 0 {
+			bastionHosts[i].SSHCertPath = c.SSHCertPath
+		}
+		bastionHosts[i].SSHAgentAuth = c.SSHAgentAuth
+	}
+}
+
 func (c *Cluster) setClusterDefaults(ctx context.Context) {
 	if len(c.SSHKeyPath) == 0 {
 		c.SSHKeyPath = DefaultClusterSSHKeyPath
@@ -62,15 +82,7 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 		c.PrefixPath = "/"
 	}
 	// Set bastion/jump  host defaults
-	if len(c.BastionHost.Address) > 0 {
-		if len(c.BastionHost.Port) == 0 {
-			c.BastionHost.Port = DefaultSSHPort
-		}
-		if len(c.BastionHost.SSHKeyPath) == 0 {
-			c.BastionHost.SSHKeyPath = c.SSHKeyPath
-		}
-		c.BastionHost.SSHAgentAuth = c.SSHAgentAuth
-	}
+	c.setBastionHostsDefaults(c.BastionHost)
 
 	for i, host := range c.Nodes {
 		if len(host.InternalAddress) == 0 {
@@ -83,9 +95,20 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 		if len(host.SSHKeyPath) == 0 {
 			c.Nodes[i].SSHKeyPath = c.SSHKeyPath
 		}
+		if len(host.SSHKeyPassphrase) == 0 {
+			c.Nodes[i].SSHKeyPassphrase = c.SSHKeyPassphrase
+		}
+		if len(host.SSHCert) == 0 && len(host.SSHCertPath) == 0 {
+			c.Nodes[i].SSHCertPath = c.SSHCertPath
+		}
 		if len(host.Port) == 0 {
 			c.Nodes[i].Port = DefaultSSHPort
 		}
+		if len(host.BastionHost) == 0 {
+			c.Nodes[i].BastionHost = append(types.BastionHosts{}, c.BastionHost...)
+		} else {
+			c.setBastionHostsDefaults(host.BastionHost)
+		}
 
 		// For now, you can set at the global level only.
 		c.Nodes[i].SSHAgentAuth = c.SSHAgentAuth
@@ -94,7 +117,7 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 	if len(c.Authorization.Mode) == 0 {
 		c.Authorization.Mode = DefaultAuthorizationMode
 	}
-	if c.Services.KubeAPI.PodSecurityPolicy && c.Authorization.Mode != services.RBACAuthorizationMode {
+	if c.Services.KubeAPI.PodSecurityPolicy && !c.hasAuthzMode(services.RBACAuthorizationMode) {
 		log.Warningf("PodSecurityPolicy can't be enabled with RBAC support disabled")
 		c.Services.KubeAPI.PodSecurityPolicy = false
 	}
@@ -116,10 +139,23 @@ func (c *Cluster) setClusterDefaults(ctx context.Context) {
 	if len(c.DNS.Provider) == 0 {
 		c.DNS.Provider = DefaultDNSProvider
 	}
+	if len(c.UpgradeStrategy.MaxUnavailable) == 0 {
+		c.UpgradeStrategy.MaxUnavailable = DefaultUpgradeMaxUnavailable
+	}
+	if c.UpgradeStrategy.DrainTimeout == 0 {
+		c.UpgradeStrategy.DrainTimeout = k8s.DefaultTimeout
+	}
+	if c.UpgradeStrategy.NodeReadyTimeout == 0 {
+		c.UpgradeStrategy.NodeReadyTimeout = k8s.DefaultTimeout
+	}
 
 	c.setClusterImageDefaults()
 	c.setClusterServicesDefaults()
 	c.setClusterNetworkDefaults()
+	c.setControlPlaneEndpointDefaults()
+	c.setAuthnDefaults()
+	c.setAuditLogDefaults()
+	c.setSecretsEncryptionDefaults()
 }
 
 func (c *Cluster) setClusterServicesDefaults() {
@@ -139,7 +175,7 @@ func (c *Cluster) setClusterServicesDefaults() {
 		&c.Services.Kubelet.ClusterDNSServer:             DefaultClusterDNSService,
 		&c.Services.Kubelet.ClusterDomain:                DefaultClusterDomain,
 		&c.Services.Kubelet.InfraContainerImage:          c.SystemImages.PodInfraContainer,
-		&c.Authentication.Strategy:                       DefaultAuthStrategy,
+		&c.Services.Kubelet.ClientCertMode:               pki.KubeletNodeCertMode,
 		&c.Services.Etcd.Creation:                        DefaultEtcdBackupCreationPeriod,
 		&c.Services.Etcd.Retention:                       DefaultEtcdBackupRetentionPeriod,
 	}
@@ -175,6 +211,8 @@ func (c *Cluster) setClusterImageDefaults() {
 	systemImagesDefaultsMap := map[*string]string{
 		&c.SystemImages.Alpine:            d(imageDefaults.Alpine, privRegURL),
 		&c.SystemImages.NginxProxy:        d(imageDefaults.NginxProxy, privRegURL),
+		&c.SystemImages.Keepalived:        d(imageDefaults.Keepalived, privRegURL),
+		&c.SystemImages.HAProxy:           d(imageDefaults.HAProxy, privRegURL),
 		&c.SystemImages.CertDownloader:    d(imageDefaults.CertDownloader, privRegURL),
 		&c.SystemImages.KubeDNS:           d(imageDefaults.KubeDNS, privRegURL),
 		&c.SystemImages.KubeDNSSidecar:    d(imageDefaults.KubeDNSSidecar, privRegURL),
@@ -187,6 +225,13 @@ func (c *Cluster) setClusterImageDefaults() {
 		&c.SystemImages.Kubernetes:                d(imageDefaults.Kubernetes, privRegURL),
 		&c.SystemImages.PodInfraContainer:         d(imageDefaults.PodInfraContainer, privRegURL),
 		&c.SystemImages.YunionCNI:                 d(imageDefaults.YunionCNI, privRegURL),
+		&c.SystemImages.Flannel:                   d(imageDefaults.Flannel, privRegURL),
+		&c.SystemImages.FlannelCNI:                d(imageDefaults.FlannelCNI, privRegURL),
+		&c.SystemImages.CalicoNode:                d(imageDefaults.CalicoNode, privRegURL),
+		&c.SystemImages.CalicoCNI:                 d(imageDefaults.CalicoCNI, privRegURL),
+		&c.SystemImages.CanalNode:                 d(imageDefaults.CanalNode, privRegURL),
+		&c.SystemImages.CanalCNI:                  d(imageDefaults.CanalCNI, privRegURL),
+		&c.SystemImages.CanalFlannel:              d(imageDefaults.CanalFlannel, privRegURL),
 		&c.SystemImages.Ingress:                   d(imageDefaults.Ingress, privRegURL),
 		&c.SystemImages.IngressBackend:            d(imageDefaults.IngressBackend, privRegURL),
 		&c.SystemImages.MetricsServer:             d(imageDefaults.MetricsServer, privRegURL),
@@ -205,6 +250,9 @@ func (c *Cluster) setClusterNetworkDefaults() {
 		c.Network.Options = make(map[string]string)
 	}
 	networkPluginConfigDefaultsMap := make(map[string]string)
+	if plugin, err := GetNetworkPlugin(c.Network.Plugin); err == nil {
+		networkPluginConfigDefaultsMap = plugin.DefaultOptions()
+	}
 	for k, v := range networkPluginConfigDefaultsMap {
 		setDefaultIfEmptyMapValue(c.Network.Options, k, v)
 	}
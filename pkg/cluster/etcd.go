@@ -4,16 +4,26 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/sets"
 
 	"yunion.io/x/yke/pkg/docker"
 	"yunion.io/x/yke/pkg/hosts"
 	"yunion.io/x/yke/pkg/services"
 	"yunion.io/x/yke/pkg/types"
+	"yunion.io/x/yke/pkg/util"
 )
 
 func (c *Cluster) SnapshotEtcd(ctx context.Context, snapshotName string) error {
 	for _, host := range c.EtcdHosts {
-		if err := services.RunEtcdSnapshotSave(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Alpine, c.Services.Etcd.Creation, c.Services.Etcd.Retention, snapshotName, true); err != nil {
+		if err := services.RunEtcdSnapshotSave(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Alpine, c.Services.Etcd.Creation, c.Services.Etcd.Retention, snapshotName, true, c.Services.Etcd.S3BackupConfig); err != nil {
 			return err
 		}
 	}
@@ -21,6 +31,15 @@ func (c *Cluster) SnapshotEtcd(ctx context.Context, snapshotName string) error {
 }
 
 func (c *Cluster) RestoreEtcdSnapshot(ctx context.Context, snapshotPath string) error {
+	// Download the snapshot from S3 onto the etcd hosts missing it before
+	// touching etcd
+	if c.Services.Etcd.S3BackupConfig != nil {
+		for _, host := range c.EtcdHosts {
+			if err := c.downloadEtcdSnapshot(ctx, host, snapshotPath); err != nil {
+				return fmt.Errorf("[etcd] Failed to download etcd snapshot: %v", err)
+			}
+		}
+	}
 	// Stopping all etcd containers
 	for _, host := range c.EtcdHosts {
 		if err := tearDownOldEtcd(ctx, host, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
@@ -41,9 +60,10 @@ func (c *Cluster) RestoreEtcdSnapshot(ctx context.Context, snapshotPath string)
 		etcdNodePlanMap[etcdHost.Address] = BuildKEConfigNodePlan(ctx, c, etcdHost, etcdHost.DockerInfo)
 	}
 	etcdRollingSnapshots := services.EtcdSnapshot{
-		Snapshot:  c.Services.Etcd.Snapshot,
-		Creation:  c.Services.Etcd.Creation,
-		Retention: c.Services.Etcd.Retention,
+		Snapshot:       c.Services.Etcd.Snapshot,
+		Creation:       c.Services.Etcd.Creation,
+		Retention:      c.Services.Etcd.Retention,
+		S3BackupConfig: c.Services.Etcd.S3BackupConfig,
 	}
 	if err := services.RunEtcdPlane(ctx, c.EtcdHosts, etcdNodePlanMap, c.LocalConnDialerFactory, c.PrivateRegistriesMap, c.UpdateWorkersOnly, c.SystemImages.Alpine, etcdRollingSnapshots); err != nil {
 		return fmt.Errorf("[etcd] Failed to bring up Etcd Plane: %v", err)
@@ -51,6 +71,29 @@ func (c *Cluster) RestoreEtcdSnapshot(ctx context.Context, snapshotPath string)
 	return nil
 }
 
+// downloadEtcdSnapshot fetches a snapshot from S3 unless the host already has
+// a local copy, which is the one restored.
+func (c *Cluster) downloadEtcdSnapshot(ctx context.Context, host *hosts.Host, snapshotName string) error {
+	snapshots, err := services.ListEtcdSnapshots(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Alpine)
+	if err != nil {
+		return err
+	}
+	if hasEtcdSnapshot(snapshots, snapshotName) {
+		log.Infof("[etcd] Snapshot [%s] found on host [%s], using the local copy", snapshotName, host.Address)
+		return nil
+	}
+	return services.DownloadEtcdSnapshotFromS3(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Alpine, snapshotName, c.Services.Etcd.S3BackupConfig)
+}
+
+func hasEtcdSnapshot(snapshots []services.EtcdSnapshotFile, snapshotName string) bool {
+	for _, snapshot := range snapshots {
+		if snapshot.Name == snapshotName {
+			return true
+		}
+	}
+	return false
+}
+
 func tearDownOldEtcd(ctx context.Context, host *hosts.Host, cleanupImage string, prsMap map[string]types.PrivateRegistry) error {
 	if err := docker.DoRemoveContainer(ctx, host.DClient, services.EtcdContainerName, host.Address); err != nil {
 		return fmt.Errorf("[etcd] Failed to stop old etcd container: %v", err)
@@ -61,3 +104,119 @@ func tearDownOldEtcd(ctx context.Context, host *hosts.Host, cleanupImage string,
 	}
 	return host.CleanUp(ctx, toCleanPaths, cleanupImage, prsMap)
 }
+
+type EtcdSnapshotInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+	Hosts     []string  `json:"hosts"`
+}
+
+type EtcdSnapshotHostStatus struct {
+	Address string `json:"address"`
+	services.EtcdSnapshotStatus
+}
+
+// ListEtcdSnapshots merges the snapshot files found on every etcd host, so
+// that each snapshot is reported once together with the hosts holding a copy.
+func (c *Cluster) ListEtcdSnapshots(ctx context.Context) ([]EtcdSnapshotInfo, error) {
+	var snapshotsLock sync.Mutex
+	snapshotsMap := map[string]*EtcdSnapshotInfo{}
+
+	var errgrp errgroup.Group
+	hostsQueue := util.GetObjectQueue(c.EtcdHosts)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			var errList []error
+			for host := range hostsQueue {
+				runHost := host.(*hosts.Host)
+				files, err := services.ListEtcdSnapshots(ctx, runHost, c.PrivateRegistriesMap, c.SystemImages.Alpine)
+				if err != nil {
+					errList = append(errList, err)
+					continue
+				}
+				snapshotsLock.Lock()
+				for _, file := range files {
+					snapshot, ok := snapshotsMap[file.Name]
+					if !ok {
+						snapshot = &EtcdSnapshotInfo{
+							Name:      file.Name,
+							Size:      file.Size,
+							Timestamp: file.Timestamp,
+						}
+						snapshotsMap[file.Name] = snapshot
+					}
+					snapshot.Hosts = append(snapshot.Hosts, runHost.Address)
+				}
+				snapshotsLock.Unlock()
+			}
+			return util.ErrList(errList)
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return nil, err
+	}
+	snapshots := []EtcdSnapshotInfo{}
+	for _, snapshot := range snapshotsMap {
+		sort.Strings(snapshot.Hosts)
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	return snapshots, nil
+}
+
+func (c *Cluster) RemoveEtcdSnapshot(ctx context.Context, snapshotName string) error {
+	if err := validateEtcdSnapshotName(snapshotName); err != nil {
+		return err
+	}
+	for _, host := range c.EtcdHosts {
+		if err := services.RemoveEtcdSnapshot(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Alpine, snapshotName); err != nil {
+			return fmt.Errorf("[etcd] Failed to remove etcd snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) InspectEtcdSnapshot(ctx context.Context, snapshotName string) ([]EtcdSnapshotHostStatus, error) {
+	if err := validateEtcdSnapshotName(snapshotName); err != nil {
+		return nil, err
+	}
+	snapshots, err := c.ListEtcdSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshotHosts := sets.NewString()
+	for _, snapshot := range snapshots {
+		if snapshot.Name == snapshotName {
+			snapshotHosts.Insert(snapshot.Hosts...)
+			break
+		}
+	}
+	if snapshotHosts.Len() == 0 {
+		return nil, fmt.Errorf("[etcd] Snapshot [%s] not found on any etcd host", snapshotName)
+	}
+	statuses := []EtcdSnapshotHostStatus{}
+	for _, host := range c.EtcdHosts {
+		if !snapshotHosts.Has(host.Address) {
+			continue
+		}
+		status, err := services.GetEtcdSnapshotStatus(ctx, host, c.PrivateRegistriesMap, c.SystemImages.Etcd, snapshotName)
+		if err != nil {
+			return nil, fmt.Errorf("[etcd] Failed to inspect etcd snapshot: %v", err)
+		}
+		statuses = append(statuses, EtcdSnapshotHostStatus{
+			Address:            host.Address,
+			EtcdSnapshotStatus: status,
+		})
+	}
+	return statuses, nil
+}
+
+func validateEtcdSnapshotName(snapshotName string) error {
+	if len(snapshotName) == 0 || strings.Contains(snapshotName, "/") || snapshotName == "." || snapshotName == ".." {
+		return fmt.Errorf("[etcd] Invalid snapshot name [%s]", snapshotName)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package cluster
+
+import (
+	"testing"
+
+	"yunion.io/x/yke/pkg/services"
+)
+
+func TestHasEtcdSnapshot(t *testing.T) {
+	snapshots := []services.EtcdSnapshotFile{
+		{Name: "snapshot-1"},
+		{Name: "snapshot-2"},
+	}
+	tests := []struct {
+		snapshots []services.EtcdSnapshotFile
+		name      string
+		want      bool
+	}{
+		{snapshots, "snapshot-1", true},
+		{snapshots, "snapshot-2", true},
+		{snapshots, "snapshot", false},
+		{snapshots, "snapshot-10", false},
+		{nil, "snapshot-1", false},
+	}
+	for _, test := range tests {
+		if got := hasEtcdSnapshot(test.snapshots, test.name); got != test.want {
+			t.Errorf("hasEtcdSnapshot(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
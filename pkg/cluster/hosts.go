@@ -41,13 +41,21 @@ func (c *Cluster) TunnelHosts(ctx context.Context, local bool) error {
 				if strings.Contains(err.Error(), "Unsupported Docker version found") {
 					return err
 				}
+				// Neither is a host key that can't be verified
+				if strings.Contains(err.Error(), hosts.HostKeyVerificationFailed) {
+					return fmt.Errorf("Failed to set up SSH tunneling for host [%s]: %v", runHost.Address, err)
+				}
 				log.Warningf("Failed to set up SSH tunneling for host [%s]: %v", runHost.Address, err)
 				c.InactiveHosts = append(c.InactiveHosts, runHost)
 			}
 			return nil
 		})
 	}
-	if err := errgrp.Wait(); err != nil {
+	err := errgrp.Wait()
+	if err := c.saveTrustedHostKeys(ctx); err != nil {
+		return err
+	}
+	if err != nil {
 		return err
 	}
 	for _, host := range c.InactiveHosts {
@@ -79,10 +87,8 @@ func (c *Cluster) InvertIndexHosts() error {
 			newHost.ToAddLabels[k] = v
 		}
 		newHost.IgnoreDockerVersion = c.IgnoreDockerVersion
-		if c.BastionHost.Address != "" {
-			// Add the bastion host information to eash host object
-			newHost.BastionHost = c.BastionHost
-		}
+		newHost.HostKeyVerifier = c.HostKeyVerifier
+		newHost.FallbackSSHKeyPassphrase = c.FallbackSSHKeyPassphrase
 		for _, role := range host.Role {
 			log.Debugf("Host: " + host.Address + " has role: " + role)
 			switch role {
@@ -116,9 +122,13 @@ func (c *Cluster) InvertIndexHosts() error {
 }
 
 func (c *Cluster) SetUpHosts(ctx context.Context, rotateCerts bool) error {
-	if c.Authentication.Strategy == X509AuthenticationProvider {
+	hostList := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	return c.setUpHostList(ctx, hostList, c.ControlPlaneHosts, rotateCerts)
+}
+
+func (c *Cluster) setUpHostList(ctx context.Context, hostList, controlHosts []*hosts.Host, rotateCerts bool) error {
+	if c.hasAuthnStrategy(X509AuthenticationProvider) {
 		log.Infof("[certificates] Deploying kubernetes certificates to Cluster nodes")
-		hostList := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
 		var errgrp errgroup.Group
 		hostsQueue := util.GetObjectQueue(hostList)
 		for w := 0; w < WorkerThreads; w++ {
@@ -144,6 +154,11 @@ func (c *Cluster) SetUpHosts(ctx context.Context, rotateCerts bool) error {
 		if err := deployAdminConfig(ctx, hostList, c.Certificates[pki.KubeAdminCertName].Config, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
 			return err
 		}
+		if c.isKubeletBootstrap() {
+			if err := c.deployKubeletBootstrapConfig(ctx, hostList); err != nil {
+				return err
+			}
+		}
 		if err := deployLogrotateConfig(ctx, hostList, c.YunionConfig.DockerGraphDir, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
 			return err
 		}
@@ -157,15 +172,39 @@ func (c *Cluster) SetUpHosts(ctx context.Context, rotateCerts bool) error {
 	}
 
 	if c.WebhookConfig != "" {
-		if err := deployWebhookConfig(ctx, c.ControlPlaneHosts, c.SystemImages.Alpine, c.WebhookConfig, c.PrivateRegistriesMap); err != nil {
+		if err := deployWebhookConfig(ctx, controlHosts, c.SystemImages.Alpine, c.WebhookConfig, c.PrivateRegistriesMap); err != nil {
 			return err
 		}
 		log.Infof("[%s] Successfully deployed kubernetes webhook file to Cluster nodes", WebhookConfigDeployer)
 	}
+	if c.AuthzWebhookConfig != "" {
+		if err := deployAuthzWebhookConfig(ctx, controlHosts, c.SystemImages.Alpine, c.AuthzWebhookConfig, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+		log.Infof("[%s] Successfully deployed authorization webhook file to Cluster nodes", AuthzWebhookServiceName)
+	}
+	if c.hasAuthnStrategy(OIDCAuthenticationProvider) && len(c.Authentication.OIDC.CACert) > 0 {
+		if err := deployOIDCCACert(ctx, controlHosts, c.SystemImages.Alpine, c.Authentication.OIDC.CACert, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+		log.Infof("[%s] Successfully deployed oidc CA certificate to Cluster nodes", OIDCServiceName)
+	}
 	if c.SchedulerPolicyConfig != "" {
-		if err := deploySchedulerConfig(ctx, c.ControlPlaneHosts, c.SystemImages.Alpine, c.SchedulerPolicyConfig, c.PrivateRegistriesMap); err != nil {
+		if err := deploySchedulerConfig(ctx, controlHosts, c.SystemImages.Alpine, c.SchedulerPolicyConfig, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+	}
+	if c.Services.KubeAPI.AuditLog.Enabled {
+		if err := deployAuditPolicy(ctx, controlHosts, c.SystemImages.Alpine, c.AuditPolicyConfig, c.PrivateRegistriesMap); err != nil {
+			return err
+		}
+		log.Infof("[%s] Successfully deployed audit policy file to Cluster nodes", AuditLogServiceName)
+	}
+	if c.SecretsEncryptionConfig != "" {
+		if err := deploySecretsEncryptionConfig(ctx, controlHosts, c.SystemImages.Alpine, c.SecretsEncryptionConfig, c.PrivateRegistriesMap); err != nil {
 			return err
 		}
+		log.Infof("[%s] Successfully deployed secrets encryption config file to Cluster nodes", SecretsEncryptionServiceName)
 	}
 	return nil
 }
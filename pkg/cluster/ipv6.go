@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// mask of the pod CIDR allocated to every node of an IPv6 cluster
+	IPv6NodeCIDRMaskSize = 64
+	// kube-apiserver refuses service ranges of more than 20 bits
+	IPv6MinServiceRangeMaskSize = 108
+)
+
+func isIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil
+}
+
+// isIPv6Cluster tells whether the pods and services of the cluster get IPv6
+// addresses, a cluster only runs a single IP family.
+func (c *Cluster) isIPv6Cluster() bool {
+	ip, _, err := net.ParseCIDR(c.Services.KubeController.ClusterCIDR)
+	return err == nil && isIPv6(ip)
+}
+
+// validateSingleStackRange rejects the comma separated IPv4/IPv6 pairs of
+// dual-stack clusters, the supported kubernetes versions can't run them.
+func (c *Cluster) validateSingleStackRange(name, ranges string) error {
+	if !strings.Contains(ranges, ",") {
+		return nil
+	}
+	return fmt.Errorf("%s [%s] is a dual-stack range which kubernetes %s can't run, use a single IPv4 or IPv6 CIDR", name, ranges, c.Version)
+}
+
+// validateIPv6Ranges checks the sizes kubernetes expects from the IPv6 cluster
+// CIDR and service cluster IP range.
+func validateIPv6Ranges(clusterCIDR, serviceRange *net.IPNet) []error {
+	errs := []error{}
+	if isIPv6(clusterCIDR.IP) != isIPv6(serviceRange.IP) {
+		errs = append(errs, fmt.Errorf("Cluster CIDR [%s] and service cluster IP range [%s] must be of the same IP family", clusterCIDR, serviceRange))
+		return errs
+	}
+	if !isIPv6(clusterCIDR.IP) {
+		return errs
+	}
+	if ones, _ := clusterCIDR.Mask.Size(); ones >= IPv6NodeCIDRMaskSize {
+		errs = append(errs, fmt.Errorf("Cluster CIDR [%s] is too small, IPv6 nodes get a /%d each", clusterCIDR, IPv6NodeCIDRMaskSize))
+	}
+	if ones, _ := serviceRange.Mask.Size(); ones < IPv6MinServiceRangeMaskSize {
+		errs = append(errs, fmt.Errorf("Service cluster IP range [%s] is too large, IPv6 ranges must be /%d or smaller", serviceRange, IPv6MinServiceRangeMaskSize))
+	}
+	return errs
+}
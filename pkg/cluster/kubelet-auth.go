@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"time"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+)
+
+const (
+	KubeletBootstrapConfigWriter = "kubelet-bootstrap-config-writer"
+	KubeletBootstrapConfigPath   = "/etc/kubernetes/ssl/kubecfg-kubelet-bootstrap.yaml"
+	KubeletBootstrapServiceName  = "kubelet-bootstrap"
+	// bootstrapping kubelets write the kubeconfig of the certificate they got
+	// in their root dir
+	KubeletBootstrapKubeConfig = "/var/lib/kubelet/kubeconfig"
+	// the bootstrap token is deleted once every kubelet registered its node,
+	// a kubelet which didn't within the timeout keeps it until it expires
+	KubeletBootstrapTokenTTL      = time.Hour
+	KubeletBootstrapWaitTimeout   = 300
+	KubeletBootstrapConfigRemover = "kubelet-bootstrap-config-remover"
+)
+
+func (c *Cluster) isKubeletBootstrap() bool {
+	return c.Services.Kubelet.ClientCertMode == pki.KubeletBootstrapCertMode
+}
+
+// getKubeletHosts returns the hosts running a kubelet, that is all of them.
+func (c *Cluster) getKubeletHosts() []*hosts.Host {
+	return hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+}
+
+func validateKubeletClientCertMode(c *Cluster) error {
+	mode := c.Services.Kubelet.ClientCertMode
+	if mode != pki.KubeletNodeCertMode && mode != pki.KubeletBootstrapCertMode {
+		return fmt.Errorf("Kubelet client_cert_mode [%s] is not supported, must be %s or %s", mode, pki.KubeletNodeCertMode, pki.KubeletBootstrapCertMode)
+	}
+	if mode == pki.KubeletBootstrapCertMode && !c.hasAuthnStrategy(X509AuthenticationProvider) {
+		return fmt.Errorf("Kubelet client_cert_mode %s requires the %s authentication strategy", mode, X509AuthenticationProvider)
+	}
+	return nil
+}
+
+// setUpKubeletCertificates issues the client and serving certificates of the
+// nodes added to the cluster, or whose addresses changed, and drops the ones
+// of the removed nodes. The serving certificates reissued for existing nodes
+// are recorded so that their kubelets get restarted.
+func setUpKubeletCertificates(ctx context.Context, c *Cluster) error {
+	nodeCrtNames := map[string]bool{}
+	for _, node := range c.Nodes {
+		nodeName := pki.GetNodeName(node)
+		crtName := pki.GetKubeletServingCrtName(nodeName)
+		nodeCrtNames[crtName] = true
+		crt := c.Certificates[crtName].Certificate
+		if pki.IsKubeletServingCertUpToDate(crt, node) {
+			continue
+		}
+		if crt != nil {
+			c.ReissuedCerts = append(c.ReissuedCerts, crtName)
+		}
+		if err := pki.GenerateKubeletServingCertificate(c.Certificates, node); err != nil {
+			return fmt.Errorf("Failed to generate kubelet serving certificate of node [%s]: %v", nodeName, err)
+		}
+	}
+	if !c.isKubeletBootstrap() {
+		for _, node := range c.Nodes {
+			nodeName := pki.GetNodeName(node)
+			crtName := pki.GetKubeletCrtName(nodeName)
+			nodeCrtNames[crtName] = true
+			if c.Certificates[crtName].Certificate != nil {
+				continue
+			}
+			if err := pki.GenerateKubeletCertificate(c.Certificates, nodeName); err != nil {
+				return fmt.Errorf("Failed to generate kubelet certificate of node [%s]: %v", nodeName, err)
+			}
+		}
+	}
+	for crtName := range c.Certificates {
+		if (pki.IsKubeletCrtName(crtName) || pki.IsKubeletServingCrtName(crtName)) && !nodeCrtNames[crtName] {
+			delete(c.Certificates, crtName)
+		}
+	}
+	return nil
+}
+
+// getKubeletBootstrapToken returns the bootstrap token of the kubelets, every
+// run generates a new one which only lives until the kubelets got their
+// client certificates.
+func (c *Cluster) getKubeletBootstrapToken() (string, string, error) {
+	if len(c.KubeletBootstrapToken) == 0 {
+		buf := make([]byte, 11)
+		if _, err := rand.Read(buf); err != nil {
+			return "", "", fmt.Errorf("Failed to generate kubelet bootstrap token: %v", err)
+		}
+		c.KubeletBootstrapToken = hex.EncodeToString(buf)
+	}
+	// token ids are 6 and secrets 16 characters of [a-z0-9]
+	return c.KubeletBootstrapToken[:6], c.KubeletBootstrapToken[6:22], nil
+}
+
+func (c *Cluster) getKubeletBootstrapConfig(host *hosts.Host) (string, error) {
+	kubeAPIURL := "https://127.0.0.1:" + KubeAPIPort
+	if !host.IsControl && len(c.ControlPlaneEndpoint.Address) > 0 {
+		// nodes without a local kube-apiserver go through the control plane endpoint
+		kubeAPIURL = pki.GetKubeAPIURL(c.ControlPlaneEndpoint, nil)
+	}
+	tokenID, tokenSecret, err := c.getKubeletBootstrapToken()
+	if err != nil {
+		return "", err
+	}
+	return pki.GetKubeConfigToken(kubeAPIURL, "local", KubeletBootstrapServiceName, pki.GetCertPath(pki.CACertName), tokenID+"."+tokenSecret), nil
+}
+
+func (c *Cluster) deployKubeletBootstrapConfig(ctx context.Context, hostList []*hosts.Host) error {
+	for _, host := range hostList {
+		log.Infof("[%s] Deploying kubelet bootstrap kubeconfig to node [%s]", KubeletBootstrapServiceName, host.Address)
+		config, err := c.getKubeletBootstrapConfig(host)
+		if err != nil {
+			return err
+		}
+		if err := host.WriteHostFile(ctx, KubeletBootstrapConfigWriter, path.Join(host.PrefixPath, KubeletBootstrapConfigPath), config, c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
+			return fmt.Errorf("Failed to deploy kubelet bootstrap kubeconfig on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
+
+// DeployKubeletBootstrapToken creates the bootstrap token the kubelets
+// request their client certificates with, it has to exist before the worker
+// plane is deployed and expires after KubeletBootstrapTokenTTL.
+func (c *Cluster) DeployKubeletBootstrapToken(ctx context.Context) error {
+	if !c.isKubeletBootstrap() || len(c.ControlPlaneHosts) == 0 {
+		return nil
+	}
+	log.Infof("[%s] Creating kubelet bootstrap token", KubeletBootstrapServiceName)
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+	}
+	tokenID, tokenSecret, err := c.getKubeletBootstrapToken()
+	if err != nil {
+		return err
+	}
+	if err := k8s.UpdateBootstrapTokenSecret(kubeClient, tokenID, tokenSecret, "yke kubelet bootstrap token", time.Now().Add(KubeletBootstrapTokenTTL)); err != nil {
+		return fmt.Errorf("Failed to create kubelet bootstrap token: %v", err)
+	}
+	log.Infof("[%s] Successfully created kubelet bootstrap token", KubeletBootstrapServiceName)
+	return nil
+}
+
+// CleanKubeletBootstrapToken deletes the bootstrap token and the bootstrap
+// kubeconfig of the nodes once every kubelet registered its node, which it
+// only does with the client certificate it got.
+func (c *Cluster) CleanKubeletBootstrapToken(ctx context.Context) error {
+	if !c.isKubeletBootstrap() || len(c.ControlPlaneHosts) == 0 || len(c.KubeletBootstrapToken) == 0 {
+		return nil
+	}
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+	}
+	kubeletHosts := c.getKubeletHosts()
+	deadline := time.Now().Add(time.Second * KubeletBootstrapWaitTimeout)
+	for _, host := range kubeletHosts {
+		nodeName := pki.GetNodeName(host.ConfigNode)
+		for {
+			if _, err := k8s.GetNode(kubeClient, nodeName); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Warningf("[%s] Node [%s] didn't register yet, keeping the kubelet bootstrap token until it expires", KubeletBootstrapServiceName, nodeName)
+				return nil
+			}
+			time.Sleep(time.Second * k8s.DefaultSleepSeconds)
+		}
+	}
+	tokenID, _, err := c.getKubeletBootstrapToken()
+	if err != nil {
+		return err
+	}
+	log.Infof("[%s] Deleting kubelet bootstrap token", KubeletBootstrapServiceName)
+	if err := k8s.DeleteBootstrapTokenSecret(kubeClient, tokenID); err != nil {
+		return fmt.Errorf("Failed to delete kubelet bootstrap token: %v", err)
+	}
+	for _, host := range kubeletHosts {
+		if err := host.DeleteHostFile(ctx, KubeletBootstrapConfigRemover, path.Join(host.PrefixPath, KubeletBootstrapConfigPath), c.SystemImages.Alpine, c.PrivateRegistriesMap); err != nil {
+			return fmt.Errorf("Failed to delete kubelet bootstrap kubeconfig on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
+
+// setKubeletCertArgs points the kubelet to its serving and client
+// certificates, or to the bootstrap kubeconfig it requests the client one with.
+func (c *Cluster) setKubeletCertArgs(host *hosts.Host, prefixPath string, commandArgs map[string]string) {
+	nodeName := pki.GetNodeName(host.ConfigNode)
+	servingCrtName := pki.GetKubeletServingCrtName(nodeName)
+	commandArgs["tls-cert-file"] = pki.GetCertPath(servingCrtName)
+	commandArgs["tls-private-key-file"] = pki.GetKeyPath(servingCrtName)
+	if !c.isKubeletBootstrap() {
+		commandArgs["kubeconfig"] = pki.GetConfigPath(pki.GetKubeletCrtName(nodeName))
+		return
+	}
+	commandArgs["bootstrap-kubeconfig"] = KubeletBootstrapConfigPath
+	commandArgs["kubeconfig"] = path.Join(prefixPath, KubeletBootstrapKubeConfig)
+	commandArgs["rotate-certificates"] = "true"
+}
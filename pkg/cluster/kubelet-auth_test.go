@@ -0,0 +1,25 @@
+package cluster
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGetKubeletBootstrapToken(t *testing.T) {
+	c := &Cluster{}
+	tokenID, tokenSecret, err := c.getKubeletBootstrapToken()
+	if err != nil {
+		t.Fatalf("getKubeletBootstrapToken: %v", err)
+	}
+	if !regexp.MustCompile(`^[a-z0-9]{6}$`).MatchString(tokenID) || !regexp.MustCompile(`^[a-z0-9]{16}$`).MatchString(tokenSecret) {
+		t.Errorf("Invalid bootstrap token %s.%s", tokenID, tokenSecret)
+	}
+	// the kubeconfig of the nodes and the token secret use the same token
+	if id, secret, _ := c.getKubeletBootstrapToken(); id != tokenID || secret != tokenSecret {
+		t.Errorf("Bootstrap token changed within a run")
+	}
+	// every run gets a new one
+	if id, _, _ := (&Cluster{}).getKubeletBootstrapToken(); id == tokenID {
+		t.Errorf("Bootstrap token reused across runs")
+	}
+}
@@ -1,11 +1,25 @@
 package cluster
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/ghodss/yaml"
 	"golang.org/x/sync/errgroup"
 
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/docker"
 	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
 	"yunion.io/x/yke/pkg/util"
 )
 
@@ -29,3 +43,242 @@ func (c *Cluster) CleanDeadLogs(ctx context.Context) error {
 
 	return errgrp.Wait()
 }
+
+// LogFile is a single file of a logs bundle, the name is relative to the
+// bundle root.
+type LogFile struct {
+	Name string
+	Data []byte
+}
+
+var (
+	ykeLogContainerNames = []string{
+		services.EtcdContainerName,
+		services.EtcdSnapshotContainerName,
+		services.KubeAPIContainerName,
+		services.KubeControllerContainerName,
+		services.SchedulerContainerName,
+		services.KubeletContainerName,
+		services.KubeproxyContainerName,
+		services.NginxProxyContainerName,
+		services.HAProxyContainerName,
+		services.KeepalivedContainerName,
+	}
+
+	privateKeyRegexp = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+const redactedValue = "[REDACTED]"
+
+// CollectLogs gathers in parallel from every host the logs of the yke
+// containers, docker info and the rendered node plan. Hosts that could not be
+// tunneled only get an error file. Secrets of the cluster configuration are
+// redacted from every collected file.
+func (c *Cluster) CollectLogs(ctx context.Context, tail string) []LogFile {
+	redactor := NewSecretsRedactor(&c.KubernetesEngineConfig)
+	files := []LogFile{}
+	var lock sync.Mutex
+	addFile := func(name string, data []byte) {
+		lock.Lock()
+		defer lock.Unlock()
+		files = append(files, LogFile{Name: name, Data: redactor.Redact(data)})
+	}
+
+	hostList := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	var errgrp errgroup.Group
+	hostsQueue := util.GetObjectQueue(hostList)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			for host := range hostsQueue {
+				c.collectHostLogs(ctx, host.(*hosts.Host), tail, addFile)
+			}
+			return nil
+		})
+	}
+	errgrp.Wait()
+	for _, host := range c.InactiveHosts {
+		addFile(path.Join("nodes", host.Address, "errors.txt"), []byte("Failed to set up SSH tunneling for host\n"))
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files
+}
+
+func (c *Cluster) collectHostLogs(ctx context.Context, host *hosts.Host, tail string, addFile func(string, []byte)) {
+	log.Infof("[logs] Collecting logs from host [%s]", host.Address)
+	hostDir := path.Join("nodes", host.Address)
+	errList := []string{}
+
+	info, err := host.DClient.Info(ctx)
+	if err != nil {
+		errList = append(errList, fmt.Sprintf("Failed to get docker info: %v", err))
+		info = host.DockerInfo
+	} else if data, err := json.MarshalIndent(info, "", "  "); err == nil {
+		addFile(path.Join(hostDir, "docker-info.json"), data)
+	}
+
+	plan := redactNodePlan(BuildKEConfigNodePlan(ctx, c, host, info))
+	if data, err := yaml.Marshal(plan); err != nil {
+		errList = append(errList, fmt.Sprintf("Failed to render node plan: %v", err))
+	} else {
+		addFile(path.Join(hostDir, "plan.yaml"), data)
+	}
+
+	for _, name := range ykeLogContainerNames {
+		exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, name, true)
+		if err != nil {
+			errList = append(errList, err.Error())
+			continue
+		}
+		if !exists {
+			continue
+		}
+		containerLog, err := docker.GetContainerLogs(ctx, host.DClient, name, tail)
+		if err != nil {
+			errList = append(errList, err.Error())
+		}
+		addFile(path.Join(hostDir, "containers", name+".log"), []byte(containerLog))
+	}
+
+	if len(errList) > 0 {
+		log.Warningf("[logs] Failed to collect some logs from host [%s]", host.Address)
+		addFile(path.Join(hostDir, "errors.txt"), []byte(strings.Join(errList, "\n")+"\n"))
+	}
+}
+
+// redactNodePlan blanks the parts of a node plan holding encoded secrets the
+// redactor can't match: the file contents, like the cloud config with the
+// yunion admin password, and the registry auths of the kubelet.
+func redactNodePlan(plan types.ConfigNodePlan) types.ConfigNodePlan {
+	files := make([]types.File, len(plan.Files))
+	for i, file := range plan.Files {
+		if len(file.Contents) > 0 {
+			file.Contents = redactedValue
+		}
+		files[i] = file
+	}
+	plan.Files = files
+	processes := make(map[string]types.Process, len(plan.Processes))
+	for name, process := range plan.Processes {
+		env := make([]string, len(process.Env))
+		for i, e := range process.Env {
+			if strings.HasPrefix(e, KubeletDockerConfigEnv+"=") {
+				e = KubeletDockerConfigEnv + "=" + redactedValue
+			}
+			env[i] = e
+		}
+		process.Env = env
+		processes[name] = process
+	}
+	plan.Processes = processes
+	return plan
+}
+
+// SecretsRedactor replaces private keys and the secret values of a cluster
+// configuration found in collected data.
+type SecretsRedactor struct {
+	secrets []string
+}
+
+func NewSecretsRedactor(config *types.KubernetesEngineConfig) *SecretsRedactor {
+	candidates := []string{
+		config.SSHKeyPassphrase,
+		config.FallbackSSHKeyPassphrase,
+		config.YunionConfig.AdminPassword,
+		config.Services.Etcd.Key,
+	}
+	for _, bastionHost := range config.BastionHost {
+		candidates = append(candidates, bastionHost.SSHKey, bastionHost.SSHKeyPassphrase)
+	}
+	for _, node := range config.Nodes {
+		candidates = append(candidates, node.SSHKey, node.SSHKeyPassphrase)
+		for _, bastionHost := range node.BastionHost {
+			candidates = append(candidates, bastionHost.SSHKey, bastionHost.SSHKeyPassphrase)
+		}
+	}
+	for _, pr := range config.PrivateRegistries {
+		candidates = append(candidates, pr.Password)
+	}
+	if s3Config := config.Services.Etcd.S3BackupConfig; s3Config != nil {
+		candidates = append(candidates, s3Config.AccessKey, s3Config.SecretKey)
+	}
+	if provider := config.CloudProvider.YunionCloudProvider; provider != nil {
+		candidates = append(candidates, provider.AdminPassword)
+	}
+	secrets := []string{}
+	for _, secret := range candidates {
+		if len(strings.TrimSpace(secret)) > 0 {
+			secrets = append(secrets, secret)
+		}
+	}
+	// replace longer secrets first so a secret containing another one is
+	// not left partially redacted
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	return &SecretsRedactor{secrets: secrets}
+}
+
+func (r *SecretsRedactor) Redact(data []byte) []byte {
+	data = privateKeyRegexp.ReplaceAll(data, []byte(redactedValue))
+	for _, secret := range r.secrets {
+		data = bytes.Replace(data, []byte(secret), []byte(redactedValue), -1)
+	}
+	return data
+}
+
+// GetRedactedConfig returns a copy of the cluster configuration with all
+// secret values replaced.
+func GetRedactedConfig(config types.KubernetesEngineConfig) types.KubernetesEngineConfig {
+	redact := func(value string) string {
+		if len(value) == 0 {
+			return value
+		}
+		return redactedValue
+	}
+	redactBastionHosts := func(bastionHosts types.BastionHosts) types.BastionHosts {
+		if bastionHosts == nil {
+			return nil
+		}
+		redacted := make(types.BastionHosts, len(bastionHosts))
+		for i, bastionHost := range bastionHosts {
+			bastionHost.SSHKey = redact(bastionHost.SSHKey)
+			bastionHost.SSHKeyPassphrase = redact(bastionHost.SSHKeyPassphrase)
+			redacted[i] = bastionHost
+		}
+		return redacted
+	}
+	config.SSHKeyPassphrase = redact(config.SSHKeyPassphrase)
+	config.FallbackSSHKeyPassphrase = redact(config.FallbackSSHKeyPassphrase)
+	config.BastionHost = redactBastionHosts(config.BastionHost)
+	config.YunionConfig.AdminPassword = redact(config.YunionConfig.AdminPassword)
+	config.Services.Etcd.Key = redact(config.Services.Etcd.Key)
+
+	nodes := make([]types.ConfigNode, len(config.Nodes))
+	for i, node := range config.Nodes {
+		node.SSHKey = redact(node.SSHKey)
+		node.SSHKeyPassphrase = redact(node.SSHKeyPassphrase)
+		node.BastionHost = redactBastionHosts(node.BastionHost)
+		nodes[i] = node
+	}
+	config.Nodes = nodes
+	registries := make([]types.PrivateRegistry, len(config.PrivateRegistries))
+	for i, pr := range config.PrivateRegistries {
+		pr.Password = redact(pr.Password)
+		registries[i] = pr
+	}
+	config.PrivateRegistries = registries
+	if config.Services.Etcd.S3BackupConfig != nil {
+		s3Config := *config.Services.Etcd.S3BackupConfig
+		s3Config.AccessKey = redact(s3Config.AccessKey)
+		s3Config.SecretKey = redact(s3Config.SecretKey)
+		config.Services.Etcd.S3BackupConfig = &s3Config
+	}
+	if config.CloudProvider.YunionCloudProvider != nil {
+		provider := *config.CloudProvider.YunionCloudProvider
+		provider.AdminPassword = redact(provider.AdminPassword)
+		config.CloudProvider.YunionCloudProvider = &provider
+	}
+	return config
+}
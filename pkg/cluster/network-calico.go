@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"yunion.io/x/yke/pkg/templates"
+)
+
+const (
+	CalicoNetworkPlugin = "calico"
+
+	CalicoIface    = "calico_iface"
+	CalicoIPIPMode = "calico_ipip_mode"
+
+	CalicoIPIPAlways      = "Always"
+	CalicoIPIPCrossSubnet = "CrossSubnet"
+	CalicoIPIPNever       = "Never"
+
+	CalicoBGPPort = "179"
+)
+
+// calicoNetworkPlugin runs calico with the kubernetes datastore, routes are
+// exchanged with BGP between the nodes.
+type calicoNetworkPlugin struct{}
+
+func init() {
+	RegisterNetworkPlugin(calicoNetworkPlugin{})
+}
+
+func (calicoNetworkPlugin) Name() string {
+	return CalicoNetworkPlugin
+}
+
+func (calicoNetworkPlugin) DefaultOptions() map[string]string {
+	return map[string]string{
+		CalicoIPIPMode: CalicoIPIPAlways,
+	}
+}
+
+func (calicoNetworkPlugin) ValidateOptions(c *Cluster) error {
+	if err := validateNetworkPluginOptions(c, CalicoIface, CalicoIPIPMode); err != nil {
+		return err
+	}
+	if err := validateIPv4OnlyNetwork(c); err != nil {
+		return err
+	}
+	return validateNetworkChoiceOption(c, CalicoIPIPMode, CalicoIPIPAlways, CalicoIPIPCrossSubnet, CalicoIPIPNever)
+}
+
+func (calicoNetworkPlugin) Ports(c *Cluster) []NetworkPluginPort {
+	return []NetworkPluginPort{{Port: CalicoBGPPort, Protocol: ProtocolTCP}}
+}
+
+func (calicoNetworkPlugin) Manifest(c *Cluster) (string, error) {
+	calicoConfig := map[string]string{
+		ClusterCIDR:               c.ClusterCIDR,
+		NodeImage:                 c.SystemImages.CalicoNode,
+		CNIImage:                  c.SystemImages.CalicoCNI,
+		RBACConfig:                c.getRBACConfig(),
+		templates.CalicoInterface: c.Network.Options[CalicoIface],
+		templates.CalicoIPIPMode:  c.Network.Options[CalicoIPIPMode],
+		templates.ServiceAccount:  "calico-node",
+	}
+	return templates.CompileTemplateFromMap(templates.CalicoTemplate, calicoConfig)
+}
+
+func (calicoNetworkPlugin) PodSelectors() []string {
+	return []string{KubeAppLabel + "=calico-node"}
+}
+
+func (calicoNetworkPlugin) AllocateNodeCIDRs() bool {
+	// the cni plugin uses the pod CIDR of the node with host-local ipam
+	return true
+}
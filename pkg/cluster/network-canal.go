@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"yunion.io/x/yke/pkg/templates"
+)
+
+const (
+	CanalNetworkPlugin = "canal"
+
+	CanalIface              = "canal_iface"
+	CanalFlannelBackendType = "canal_flannel_backend_type"
+	CanalFlannelBackendVNI  = "canal_flannel_backend_vni"
+	CanalFlannelBackendPort = "canal_flannel_backend_port"
+)
+
+// canalNetworkPlugin routes the pod network with flannel and enforces network
+// policies with calico.
+type canalNetworkPlugin struct{}
+
+func init() {
+	RegisterNetworkPlugin(canalNetworkPlugin{})
+}
+
+func (canalNetworkPlugin) Name() string {
+	return CanalNetworkPlugin
+}
+
+func (canalNetworkPlugin) DefaultOptions() map[string]string {
+	return map[string]string{
+		CanalFlannelBackendType: FlannelBackendVxLan,
+		CanalFlannelBackendVNI:  DefaultFlannelBackendVNI,
+		CanalFlannelBackendPort: DefaultFlannelBackendPort,
+	}
+}
+
+func (canalNetworkPlugin) ValidateOptions(c *Cluster) error {
+	if err := validateNetworkPluginOptions(c, CanalIface, CanalFlannelBackendType, CanalFlannelBackendVNI, CanalFlannelBackendPort); err != nil {
+		return err
+	}
+	if err := validateIPv4OnlyNetwork(c); err != nil {
+		return err
+	}
+	return validateFlannelBackend(c, CanalFlannelBackendType, CanalFlannelBackendVNI, CanalFlannelBackendPort)
+}
+
+func (canalNetworkPlugin) Ports(c *Cluster) []NetworkPluginPort {
+	return getFlannelBackendPorts(c, CanalFlannelBackendType, CanalFlannelBackendPort)
+}
+
+func (canalNetworkPlugin) Manifest(c *Cluster) (string, error) {
+	canalConfig := map[string]string{
+		ClusterCIDR:                  c.ClusterCIDR,
+		NodeImage:                    c.SystemImages.CanalNode,
+		CNIImage:                     c.SystemImages.CanalCNI,
+		Image:                        c.SystemImages.CanalFlannel,
+		RBACConfig:                   c.getRBACConfig(),
+		templates.CanalInterface:     c.Network.Options[CanalIface],
+		templates.FlannelBackendType: c.Network.Options[CanalFlannelBackendType],
+		templates.FlannelBackendVNI:  c.Network.Options[CanalFlannelBackendVNI],
+		templates.FlannelBackendPort: c.Network.Options[CanalFlannelBackendPort],
+		templates.ServiceAccount:     "canal",
+	}
+	return templates.CompileTemplateFromMap(templates.CanalTemplate, canalConfig)
+}
+
+func (canalNetworkPlugin) PodSelectors() []string {
+	return []string{KubeAppLabel + "=" + CanalNetworkPlugin}
+}
+
+func (canalNetworkPlugin) AllocateNodeCIDRs() bool {
+	return true
+}
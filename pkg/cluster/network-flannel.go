@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	"yunion.io/x/yke/pkg/templates"
+)
+
+const (
+	FlannelNetworkPlugin = "flannel"
+
+	FlannelIface       = "flannel_iface"
+	FlannelBackendType = "flannel_backend_type"
+	FlannelBackendVNI  = "flannel_backend_vni"
+	FlannelBackendPort = "flannel_backend_port"
+
+	FlannelBackendVxLan  = "vxlan"
+	FlannelBackendHostGw = "host-gw"
+
+	DefaultFlannelBackendVNI  = "1"
+	DefaultFlannelBackendPort = "8472"
+)
+
+// flannelNetworkPlugin runs flannel with the kubernetes subnet manager, the
+// pod CIDR of every node is routed over vxlan or host-gw.
+type flannelNetworkPlugin struct{}
+
+func init() {
+	RegisterNetworkPlugin(flannelNetworkPlugin{})
+}
+
+func (flannelNetworkPlugin) Name() string {
+	return FlannelNetworkPlugin
+}
+
+func (flannelNetworkPlugin) DefaultOptions() map[string]string {
+	return map[string]string{
+		FlannelBackendType: FlannelBackendVxLan,
+		FlannelBackendVNI:  DefaultFlannelBackendVNI,
+		FlannelBackendPort: DefaultFlannelBackendPort,
+	}
+}
+
+func (flannelNetworkPlugin) ValidateOptions(c *Cluster) error {
+	if err := validateNetworkPluginOptions(c, FlannelIface, FlannelBackendType, FlannelBackendVNI, FlannelBackendPort); err != nil {
+		return err
+	}
+	if err := validateIPv4OnlyNetwork(c); err != nil {
+		return err
+	}
+	return validateFlannelBackend(c, FlannelBackendType, FlannelBackendVNI, FlannelBackendPort)
+}
+
+func (flannelNetworkPlugin) Ports(c *Cluster) []NetworkPluginPort {
+	return getFlannelBackendPorts(c, FlannelBackendType, FlannelBackendPort)
+}
+
+func (flannelNetworkPlugin) Manifest(c *Cluster) (string, error) {
+	flannelConfig := map[string]string{
+		ClusterCIDR:                  c.ClusterCIDR,
+		Image:                        c.SystemImages.Flannel,
+		CNIImage:                     c.SystemImages.FlannelCNI,
+		RBACConfig:                   c.getRBACConfig(),
+		templates.FlannelInterface:   c.Network.Options[FlannelIface],
+		templates.FlannelBackendType: c.Network.Options[FlannelBackendType],
+		templates.FlannelBackendVNI:  c.Network.Options[FlannelBackendVNI],
+		templates.FlannelBackendPort: c.Network.Options[FlannelBackendPort],
+	}
+	return templates.CompileTemplateFromMap(templates.FlannelTemplate, flannelConfig)
+}
+
+func (flannelNetworkPlugin) PodSelectors() []string {
+	return []string{KubeAppLabel + "=" + FlannelNetworkPlugin}
+}
+
+func (flannelNetworkPlugin) AllocateNodeCIDRs() bool {
+	return true
+}
+
+func validateFlannelBackend(c *Cluster, typeKey, vniKey, portKey string) error {
+	if err := validateNetworkChoiceOption(c, typeKey, FlannelBackendVxLan, FlannelBackendHostGw); err != nil {
+		return err
+	}
+	if err := validateNetworkVNIOption(c, vniKey); err != nil {
+		return err
+	}
+	return validateNetworkPortOption(c, portKey, 1, 65535)
+}
+
+// getFlannelBackendPorts returns the vxlan port, host-gw routes the pod
+// traffic without encapsulation.
+func getFlannelBackendPorts(c *Cluster, typeKey, portKey string) []NetworkPluginPort {
+	if c.Network.Options[typeKey] != FlannelBackendVxLan {
+		return nil
+	}
+	return []NetworkPluginPort{{Port: c.Network.Options[portKey], Protocol: ProtocolUDP}}
+}
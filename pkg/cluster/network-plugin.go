@@ -0,0 +1,192 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/log"
+)
+
+const (
+	NoNetworkPlugin = "none"
+
+	MinVXLANVNI = 1
+	MaxVXLANVNI = 16777215
+)
+
+// NetworkPlugin deploys the pod network of the cluster, plugins are selected
+// by network.plugin of the cluster file.
+type NetworkPlugin interface {
+	// Name is the value of network.plugin selecting the plugin
+	Name() string
+	// DefaultOptions are set in network.options when they are missing
+	DefaultOptions() map[string]string
+	// ValidateOptions checks network.options of the cluster
+	ValidateOptions(c *Cluster) error
+	// Ports returns the ports the plugin needs open between all the nodes
+	Ports(c *Cluster) []NetworkPluginPort
+	// Manifest returns the manifest deployed as the network plugin addon,
+	// nothing is deployed when it's empty
+	Manifest(c *Cluster) (string, error)
+	// PodSelectors select the pods of the plugin, they are restarted along
+	// with the other system pods
+	PodSelectors() []string
+	// AllocateNodeCIDRs tells whether kube-controller-manager has to assign
+	// a pod CIDR to every node
+	AllocateNodeCIDRs() bool
+}
+
+var networkPlugins = map[string]NetworkPlugin{}
+
+// RegisterNetworkPlugin makes a network plugin available to the cluster
+// file, it's called from init.
+func RegisterNetworkPlugin(plugin NetworkPlugin) {
+	if _, ok := networkPlugins[plugin.Name()]; ok {
+		panic(fmt.Sprintf("Network plugin %s is registered twice", plugin.Name()))
+	}
+	networkPlugins[plugin.Name()] = plugin
+}
+
+// GetNetworkPlugin returns the registered network plugin called name.
+func GetNetworkPlugin(name string) (NetworkPlugin, error) {
+	plugin, ok := networkPlugins[name]
+	if !ok {
+		return nil, fmt.Errorf("Network plugin [%s] is not supported, must be one of [%s]", name, strings.Join(GetNetworkPluginNames(), ", "))
+	}
+	return plugin, nil
+}
+
+// GetNetworkPluginNames returns the names of the registered network plugins.
+func GetNetworkPluginNames() []string {
+	names := []string{}
+	for name := range networkPlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Cluster) deployNetworkPlugin(ctx context.Context) error {
+	log.Infof("[network] Setting up network plugin: %s", c.Network.Plugin)
+	plugin, err := GetNetworkPlugin(c.Network.Plugin)
+	if err != nil {
+		return fmt.Errorf("[network] %v", err)
+	}
+	pluginYaml, err := plugin.Manifest(c)
+	if err != nil {
+		return fmt.Errorf("[network] Failed to build %s manifest: %v", plugin.Name(), err)
+	}
+	if len(pluginYaml) == 0 {
+		log.Infof("[network] Network plugin %s deploys nothing, the pod network has to be set up separately", plugin.Name())
+		return nil
+	}
+	if err := c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName, true, false); err != nil {
+		return fmt.Errorf("Deploy %s network plugin: %v", plugin.Name(), err)
+	}
+	return nil
+}
+
+// validateNetworkPluginOptions rejects options not in supported, so that
+// typos and options of other plugins don't go unnoticed.
+func validateNetworkPluginOptions(c *Cluster, supported ...string) error {
+	for key := range c.Network.Options {
+		found := false
+		for _, option := range supported {
+			if key == option {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Network option [%s] is not supported by network plugin [%s]", key, c.Network.Plugin)
+		}
+	}
+	return nil
+}
+
+func validateNetworkPortOption(c *Cluster, key string, min, max int) error {
+	value, ok := c.Network.Options[key]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return fmt.Errorf("Network option [%s] must be a number between %d and %d, got [%s]", key, min, max, value)
+	}
+	return nil
+}
+
+// validateNetworkVNIOption checks a VXLAN network identifier, it's 24 bits
+// and 0 isn't usable.
+func validateNetworkVNIOption(c *Cluster, key string) error {
+	value, ok := c.Network.Options[key]
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < MinVXLANVNI || n > MaxVXLANVNI {
+		return fmt.Errorf("Network option [%s] must be a VXLAN network identifier between %d and %d, got [%s]", key, MinVXLANVNI, MaxVXLANVNI, value)
+	}
+	return nil
+}
+
+func validateNetworkChoiceOption(c *Cluster, key string, choices ...string) error {
+	value, ok := c.Network.Options[key]
+	if !ok {
+		return nil
+	}
+	for _, choice := range choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf("Network option [%s] must be one of [%s], got [%s]", key, strings.Join(choices, ", "), value)
+}
+
+// validateIPv4OnlyNetwork rejects IPv6 cluster CIDRs for the plugins only
+// running IPv4 pod networks.
+func validateIPv4OnlyNetwork(c *Cluster) error {
+	if c.isIPv6Cluster() {
+		return fmt.Errorf("Network plugin [%s] only supports an IPv4 cluster CIDR, got [%s]", c.Network.Plugin, c.Services.KubeController.ClusterCIDR)
+	}
+	return nil
+}
+
+// noNetworkPlugin leaves the pod network to a CNI deployed by the user.
+type noNetworkPlugin struct{}
+
+func init() {
+	RegisterNetworkPlugin(noNetworkPlugin{})
+}
+
+func (noNetworkPlugin) Name() string {
+	return NoNetworkPlugin
+}
+
+func (noNetworkPlugin) DefaultOptions() map[string]string {
+	return nil
+}
+
+func (noNetworkPlugin) ValidateOptions(c *Cluster) error {
+	return validateNetworkPluginOptions(c)
+}
+
+func (noNetworkPlugin) Ports(c *Cluster) []NetworkPluginPort {
+	return nil
+}
+
+func (noNetworkPlugin) Manifest(c *Cluster) (string, error) {
+	return "", nil
+}
+
+func (noNetworkPlugin) PodSelectors() []string {
+	return nil
+}
+
+func (noNetworkPlugin) AllocateNodeCIDRs() bool {
+	// most CNIs brought by the user rely on the pod CIDR of the node
+	return true
+}
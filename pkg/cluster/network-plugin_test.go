@@ -0,0 +1,153 @@
+package cluster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetClusterNetworkDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		plugin  string
+		options map[string]string
+		want    map[string]string
+	}{
+		{
+			name:   "default plugin",
+			plugin: "",
+			want:   map[string]string{},
+		},
+		{
+			name:   "flannel",
+			plugin: FlannelNetworkPlugin,
+			want: map[string]string{
+				FlannelBackendType: FlannelBackendVxLan,
+				FlannelBackendVNI:  DefaultFlannelBackendVNI,
+				FlannelBackendPort: DefaultFlannelBackendPort,
+			},
+		},
+		{
+			name:    "flannel options are kept",
+			plugin:  FlannelNetworkPlugin,
+			options: map[string]string{FlannelBackendType: FlannelBackendHostGw, FlannelBackendVNI: "4096"},
+			want: map[string]string{
+				FlannelBackendType: FlannelBackendHostGw,
+				FlannelBackendVNI:  "4096",
+				FlannelBackendPort: DefaultFlannelBackendPort,
+			},
+		},
+		{
+			name:   "canal",
+			plugin: CanalNetworkPlugin,
+			want: map[string]string{
+				CanalFlannelBackendType: FlannelBackendVxLan,
+				CanalFlannelBackendVNI:  DefaultFlannelBackendVNI,
+				CanalFlannelBackendPort: DefaultFlannelBackendPort,
+			},
+		},
+		{
+			name:   "calico",
+			plugin: CalicoNetworkPlugin,
+			want:   map[string]string{CalicoIPIPMode: CalicoIPIPAlways},
+		},
+		{
+			name:    "calico options are kept",
+			plugin:  CalicoNetworkPlugin,
+			options: map[string]string{CalicoIPIPMode: CalicoIPIPNever},
+			want:    map[string]string{CalicoIPIPMode: CalicoIPIPNever},
+		},
+		{
+			name:   "yunion",
+			plugin: YunionNetworkPlugin,
+			want:   map[string]string{},
+		},
+		{
+			name:    "yunion options are kept",
+			plugin:  YunionNetworkPlugin,
+			options: map[string]string{YunionBridge: "br0"},
+			want:    map[string]string{YunionBridge: "br0"},
+		},
+		{
+			name:   "none",
+			plugin: NoNetworkPlugin,
+			want:   map[string]string{},
+		},
+		{
+			name:   "unknown plugin",
+			plugin: "weave",
+			want:   map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		c := &Cluster{}
+		c.Network.Plugin = test.plugin
+		c.Network.Options = test.options
+		c.setClusterNetworkDefaults()
+		if test.plugin == "" && c.Network.Plugin != DefaultNetworkPlugin {
+			t.Errorf("%s: plugin is %q, want %q", test.name, c.Network.Plugin, DefaultNetworkPlugin)
+		}
+		if !reflect.DeepEqual(c.Network.Options, test.want) {
+			t.Errorf("%s: options are %v, want %v", test.name, c.Network.Options, test.want)
+		}
+	}
+}
+
+func TestValidateNetworkOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		plugin      string
+		options     map[string]string
+		clusterCIDR string
+		err         string
+	}{
+		{name: "flannel defaults", plugin: FlannelNetworkPlugin},
+		{name: "flannel host-gw", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendType: FlannelBackendHostGw}},
+		{name: "flannel interface", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelIface: "eth1"}},
+		{name: "flannel unknown backend", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendType: "udp"}, err: "[flannel_backend_type] must be one of [vxlan, host-gw]"},
+		{name: "flannel largest vni", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendVNI: "16777215"}},
+		{name: "flannel vni 0", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendVNI: "0"}, err: "[flannel_backend_vni] must be a VXLAN network identifier between 1 and 16777215"},
+		{name: "flannel vni over 24 bits", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendVNI: "16777216"}, err: "[flannel_backend_vni] must be a VXLAN network identifier"},
+		{name: "flannel vni not a number", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendVNI: "one"}, err: "[flannel_backend_vni] must be a VXLAN network identifier"},
+		{name: "flannel port over 16 bits", plugin: FlannelNetworkPlugin, options: map[string]string{FlannelBackendPort: "65536"}, err: "[flannel_backend_port] must be a number between 1 and 65535"},
+		{name: "flannel with a canal option", plugin: FlannelNetworkPlugin, options: map[string]string{CanalIface: "eth1"}, err: "[canal_iface] is not supported by network plugin [flannel]"},
+		{name: "flannel ipv6", plugin: FlannelNetworkPlugin, clusterCIDR: "fd00:10:42::/56", err: "only supports an IPv4 cluster CIDR"},
+		{name: "canal defaults", plugin: CanalNetworkPlugin},
+		{name: "canal interface", plugin: CanalNetworkPlugin, options: map[string]string{CanalIface: "eth1"}},
+		{name: "canal vni", plugin: CanalNetworkPlugin, options: map[string]string{CanalFlannelBackendVNI: "16777216"}, err: "[canal_flannel_backend_vni] must be a VXLAN network identifier"},
+		{name: "canal port", plugin: CanalNetworkPlugin, options: map[string]string{CanalFlannelBackendPort: "0"}, err: "[canal_flannel_backend_port] must be a number between 1 and 65535"},
+		{name: "canal with a flannel option", plugin: CanalNetworkPlugin, options: map[string]string{FlannelBackendVNI: "2"}, err: "[flannel_backend_vni] is not supported by network plugin [canal]"},
+		{name: "canal ipv6", plugin: CanalNetworkPlugin, clusterCIDR: "fd00:10:42::/56", err: "only supports an IPv4 cluster CIDR"},
+		{name: "calico defaults", plugin: CalicoNetworkPlugin},
+		{name: "calico cross subnet", plugin: CalicoNetworkPlugin, options: map[string]string{CalicoIPIPMode: CalicoIPIPCrossSubnet}},
+		{name: "calico unknown ipip mode", plugin: CalicoNetworkPlugin, options: map[string]string{CalicoIPIPMode: "always"}, err: "[calico_ipip_mode] must be one of [Always, CrossSubnet, Never]"},
+		{name: "calico with a flannel option", plugin: CalicoNetworkPlugin, options: map[string]string{FlannelIface: "eth1"}, err: "[flannel_iface] is not supported by network plugin [calico]"},
+		{name: "calico ipv6", plugin: CalicoNetworkPlugin, clusterCIDR: "fd00:10:42::/56", err: "only supports an IPv4 cluster CIDR"},
+		{name: "yunion defaults", plugin: YunionNetworkPlugin},
+		{name: "yunion options", plugin: YunionNetworkPlugin, options: map[string]string{YunionBridge: "br0", YunionRegion: "region0"}},
+		{name: "yunion with a calico option", plugin: YunionNetworkPlugin, options: map[string]string{CalicoIPIPMode: CalicoIPIPNever}, err: "[calico_ipip_mode] is not supported by network plugin [yunion]"},
+		{name: "none defaults", plugin: NoNetworkPlugin},
+		{name: "none ipv6", plugin: NoNetworkPlugin, clusterCIDR: "fd00:10:42::/56"},
+		{name: "none with an option", plugin: NoNetworkPlugin, options: map[string]string{FlannelIface: "eth1"}, err: "[flannel_iface] is not supported by network plugin [none]"},
+		{name: "unknown plugin", plugin: "weave", err: "Network plugin [weave] is not supported"},
+	}
+	for _, test := range tests {
+		c := &Cluster{}
+		c.Network.Plugin = test.plugin
+		c.Network.Options = map[string]string{}
+		for k, v := range test.options {
+			c.Network.Options[k] = v
+		}
+		c.Services.KubeController.ClusterCIDR = test.clusterCIDR
+		c.setClusterNetworkDefaults()
+		err := validateNetworkOptions(c)
+		switch {
+		case err != nil && len(test.err) == 0:
+			t.Errorf("%s: %v", test.name, err)
+		case err == nil && len(test.err) > 0:
+			t.Errorf("%s: valid, want an error containing %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		}
+	}
+}
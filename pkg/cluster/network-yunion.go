@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"yunion.io/x/yke/pkg/templates"
+)
+
+// yunionNetworkPlugin attaches the pods to the Yunion SDN, its settings come
+// from the yunion config of the cluster.
+type yunionNetworkPlugin struct{}
+
+func init() {
+	RegisterNetworkPlugin(yunionNetworkPlugin{})
+}
+
+func (yunionNetworkPlugin) Name() string {
+	return YunionNetworkPlugin
+}
+
+func (yunionNetworkPlugin) DefaultOptions() map[string]string {
+	return nil
+}
+
+func (yunionNetworkPlugin) ValidateOptions(c *Cluster) error {
+	// written by config --topo
+	return validateNetworkPluginOptions(c,
+		YunionCNIImage,
+		YunionBridge,
+		YunionAuthURL,
+		YunionAdminUser,
+		YunionAdminPasswd,
+		YunionAdminProject,
+		YunionRegion,
+		YunionKubeCluster,
+	)
+}
+
+func (yunionNetworkPlugin) Ports(c *Cluster) []NetworkPluginPort {
+	return nil
+}
+
+func (yunionNetworkPlugin) Manifest(c *Cluster) (string, error) {
+	yunionConfig := map[string]string{
+		ClusterCIDR:                  c.ClusterCIDR,
+		RBACConfig:                   c.getRBACConfig(),
+		CNIImage:                     c.SystemImages.YunionCNI,
+		templates.YunionBridge:       c.YunionConfig.HostBridge,
+		templates.YunionAuthURL:      c.YunionConfig.AuthURL,
+		templates.YunionAdminUser:    c.YunionConfig.AdminUser,
+		templates.YunionAdminPasswd:  c.YunionConfig.AdminPassword,
+		templates.YunionAdminProject: c.YunionConfig.AdminProject,
+		templates.YunionRegion:       c.YunionConfig.Region,
+		templates.YunionKubeCluster:  c.YunionConfig.KubeCluster,
+		ClusterVersion:               getTagMajorVersion(c.Version),
+	}
+	return templates.CompileTemplateFromMap(templates.YunionCNITemplate, yunionConfig)
+}
+
+func (yunionNetworkPlugin) PodSelectors() []string {
+	return []string{KubeAppLabel + "=" + YunionNetworkPlugin + "-cni"}
+}
+
+func (yunionNetworkPlugin) AllocateNodeCIDRs() bool {
+	// pod addresses are allocated by the yunion ipam
+	return false
+}
@@ -14,7 +14,6 @@ import (
 
 	"yunion.io/x/yke/pkg/docker"
 	"yunion.io/x/yke/pkg/hosts"
-	"yunion.io/x/yke/pkg/templates"
 	"yunion.io/x/yke/pkg/types"
 	"yunion.io/x/yke/pkg/util"
 )
@@ -27,6 +26,10 @@ const (
 	CPPortListenContainer     = "yke-cp-port-listener"
 	WorkerPortListenContainer = "yke-worker-port-listener"
 
+	NetworkTCPPortListenContainer = "yke-network-tcp-port-listener"
+	NetworkUDPPortListenContainer = "yke-network-udp-port-listener"
+	PortListenerPort              = "1337"
+
 	KubeAPIPort    = "6443"
 	EtcdPort1      = "2379"
 	EtcdPort2      = "2380"
@@ -99,50 +102,6 @@ var EtcdClientPortList = []string{
 	EtcdPort1,
 }
 
-func (c *Cluster) deployNetworkPlugin(ctx context.Context) error {
-	log.Infof("[network] Setting up network plugin: %s", c.Network.Plugin)
-	switch c.Network.Plugin {
-	case YunionNetworkPlugin:
-		return c.doYunionDeploy(ctx)
-	default:
-		return fmt.Errorf("[network] Unsupported network plugin: %s", c.Network.Plugin)
-	}
-}
-
-func (c *Cluster) doYunionDeploy(ctx context.Context) error {
-	yunionConfig := map[string]string{
-		ClusterCIDR:                  c.ClusterCIDR,
-		RBACConfig:                   c.Authorization.Mode,
-		CNIImage:                     c.SystemImages.YunionCNI,
-		templates.YunionBridge:       c.YunionConfig.HostBridge,
-		templates.YunionAuthURL:      c.YunionConfig.AuthURL,
-		templates.YunionAdminUser:    c.YunionConfig.AdminUser,
-		templates.YunionAdminPasswd:  c.YunionConfig.AdminPassword,
-		templates.YunionAdminProject: c.YunionConfig.AdminProject,
-		templates.YunionRegion:       c.YunionConfig.Region,
-		templates.YunionKubeCluster:  c.YunionConfig.KubeCluster,
-		ClusterVersion:               getTagMajorVersion(c.Version),
-	}
-	pluginYaml, err := c.getNetworkPluginManifest(yunionConfig)
-	if err != nil {
-		return err
-	}
-	err = c.doAddonDeploy(ctx, pluginYaml, NetworkPluginResourceName, true, false)
-	if err != nil {
-		return fmt.Errorf("Deploy yunion cni container: %v", err)
-	}
-	return nil
-}
-
-func (c *Cluster) getNetworkPluginManifest(pluginConfig map[string]string) (string, error) {
-	switch c.Network.Plugin {
-	case YunionNetworkPlugin:
-		return templates.CompileTemplateFromMap(templates.YunionCNITemplate, pluginConfig)
-	default:
-		return "", fmt.Errorf("[network] Unsupported network plugin: %s", c.Network.Plugin)
-	}
-}
-
 func (c *Cluster) CheckClusterPorts(ctx context.Context, currentCluster *Cluster) error {
 	if currentCluster != nil {
 		newEtcdHost := hosts.GetToAddHosts(currentCluster.EtcdHosts, c.EtcdHosts)
@@ -159,10 +118,10 @@ func (c *Cluster) CheckClusterPorts(ctx context.Context, currentCluster *Cluster
 	if err := c.deployTCPPortListeners(ctx, currentCluster); err != nil {
 		return err
 	}
-	if err := c.runServicePortChecks(ctx); err != nil {
+	if err := c.runServicePortChecks(ctx, currentCluster); err != nil {
 		return err
 	}
-	if c.K8sWrapTransport == nil && len(c.BastionHost.Address) == 0 {
+	if c.K8sWrapTransport == nil && !c.hasBastionHosts() {
 		if err := c.checkKubeAPIPort(ctx); err != nil {
 			return err
 		}
@@ -177,7 +136,7 @@ func (c *Cluster) checkKubeAPIPort(ctx context.Context) error {
 	log.Infof("[network] Checking KubeAPI port Control Plane hosts")
 	for _, host := range c.ControlPlaneHosts {
 		log.Debugf("[network] Checking KubeAPI port [%s] on host: %s", KubeAPIPort, host.Address)
-		address := fmt.Sprintf("%s:%s", host.Address, KubeAPIPort)
+		address := net.JoinHostPort(host.Address, KubeAPIPort)
 		conn, err := net.Dial("tcp", address)
 		if err != nil {
 			return fmt.Errorf("[network] Can't access KubeAPI port [%s] on Control Plane host: %s", KubeAPIPort, host.Address)
@@ -189,33 +148,71 @@ func (c *Cluster) checkKubeAPIPort(ctx context.Context) error {
 
 func (c *Cluster) deployTCPPortListeners(ctx context.Context, currentCluster *Cluster) error {
 	log.Infof("[network] Deploying port listener containers")
+	newHosts := c.getPortCheckHosts(currentCluster)
 
 	// deploy ectd listeners
-	if err := c.deployListenerOnPlane(ctx, EtcdPortList, c.EtcdHosts, EtcdPortListenContainer); err != nil {
+	if err := c.deployListenerOnPlane(ctx, EtcdPortList, ProtocolTCP, newHosts.etcd, EtcdPortListenContainer); err != nil {
 		return err
 	}
 
 	// deploy controlplane listeners
-	if err := c.deployListenerOnPlane(ctx, ControlPlanePortList, c.ControlPlaneHosts, CPPortListenContainer); err != nil {
+	if err := c.deployListenerOnPlane(ctx, ControlPlanePortList, ProtocolTCP, newHosts.controlPlane, CPPortListenContainer); err != nil {
 		return err
 	}
 
 	// deploy worker listeners
-	if err := c.deployListenerOnPlane(ctx, WorkerPortList, c.WorkerHosts, WorkerPortListenContainer); err != nil {
+	if err := c.deployListenerOnPlane(ctx, WorkerPortList, ProtocolTCP, newHosts.worker, WorkerPortListenContainer); err != nil {
 		return err
 	}
+
+	// deploy network plugin listeners
+	if portList := c.getNetworkPluginPortList(ProtocolTCP); len(portList) > 0 {
+		if err := c.deployListenerOnPlane(ctx, portList, ProtocolTCP, newHosts.all, NetworkTCPPortListenContainer); err != nil {
+			return err
+		}
+	}
+	if portList := c.getNetworkPluginPortList(ProtocolUDP); len(portList) > 0 {
+		if err := c.deployListenerOnPlane(ctx, portList, ProtocolUDP, newHosts.all, NetworkUDPPortListenContainer); err != nil {
+			return err
+		}
+	}
 	log.Infof("[network] Port listener containers deployed successfully")
 	return nil
 }
 
-func (c *Cluster) deployListenerOnPlane(ctx context.Context, portList []string, hostPlane []*hosts.Host, containerName string) error {
+// portCheckHosts are the hosts of every plane whose ports are checked.
+type portCheckHosts struct {
+	etcd         []*hosts.Host
+	controlPlane []*hosts.Host
+	worker       []*hosts.Host
+	all          []*hosts.Host
+}
+
+// getPortCheckHosts returns the hosts not running their planes yet. The
+// ports of the running ones are taken by the cluster services, and the UDP
+// ones of the network plugin by the kernel, the listeners can't answer there.
+func (c *Cluster) getPortCheckHosts(currentCluster *Cluster) portCheckHosts {
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	if currentCluster == nil {
+		return portCheckHosts{c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts, allHosts}
+	}
+	currentHosts := hosts.GetUniqueHostList(currentCluster.EtcdHosts, currentCluster.ControlPlaneHosts, currentCluster.WorkerHosts)
+	return portCheckHosts{
+		etcd:         hosts.GetToAddHosts(currentCluster.EtcdHosts, c.EtcdHosts),
+		controlPlane: hosts.GetToAddHosts(currentCluster.ControlPlaneHosts, c.ControlPlaneHosts),
+		worker:       hosts.GetToAddHosts(currentCluster.WorkerHosts, c.WorkerHosts),
+		all:          hosts.GetToAddHosts(currentHosts, allHosts),
+	}
+}
+
+func (c *Cluster) deployListenerOnPlane(ctx context.Context, portList []string, protocol string, hostPlane []*hosts.Host, containerName string) error {
 	var errgrp errgroup.Group
 	hostsQueue := util.GetObjectQueue(hostPlane)
 	for w := 0; w < WorkerThreads; w++ {
 		errgrp.Go(func() error {
 			var errList []error
 			for host := range hostsQueue {
-				err := c.deployListener(ctx, host.(*hosts.Host), portList, containerName)
+				err := c.deployListener(ctx, host.(*hosts.Host), portList, protocol, containerName)
 				if err != nil {
 					errList = append(errList, err)
 				}
@@ -226,24 +223,18 @@ func (c *Cluster) deployListenerOnPlane(ctx context.Context, portList []string,
 	return errgrp.Wait()
 }
 
-func (c *Cluster) deployListener(ctx context.Context, host *hosts.Host, portList []string, containerName string) error {
+func (c *Cluster) deployListener(ctx context.Context, host *hosts.Host, portList []string, protocol, containerName string) error {
+	listenPort := nat.Port(fmt.Sprintf("%s/%s", PortListenerPort, strings.ToLower(protocol)))
 	imageCfg := &container.Config{
 		Image: c.SystemImages.Alpine,
-		Cmd: []string{
-			"nc",
-			"-kl",
-			"-p",
-			"1337",
-			"-e",
-			"echo",
-		},
+		Cmd:   getPortListenerCmd(protocol),
 		ExposedPorts: nat.PortSet{
-			"1337/tcp": {},
+			listenPort: {},
 		},
 	}
 	hostCfg := &container.HostConfig{
 		PortBindings: nat.PortMap{
-			"1337/tcp": getPortBindings("0.0.0.0", portList),
+			listenPort: getPortBindings("0.0.0.0", portList, protocol),
 		},
 	}
 
@@ -258,6 +249,27 @@ func (c *Cluster) deployListener(ctx context.Context, host *hosts.Host, portList
 	return nil
 }
 
+// getPortListenerCmd returns the command of the listener answering the port
+// checks, the UDP one echoes a datagram back to every peer.
+func getPortListenerCmd(protocol string) []string {
+	if protocol == ProtocolUDP {
+		// nc exits once it served a peer
+		return []string{
+			"sh",
+			"-c",
+			fmt.Sprintf("while true; do nc -u -l -p %s -e echo pong; done", PortListenerPort),
+		}
+	}
+	return []string{
+		"nc",
+		"-kl",
+		"-p",
+		PortListenerPort,
+		"-e",
+		"echo",
+	}
+}
+
 func (c *Cluster) removeTCPPortListeners(ctx context.Context) error {
 	log.Infof("[network] Removing port listener containers")
 
@@ -270,6 +282,13 @@ func (c *Cluster) removeTCPPortListeners(ctx context.Context) error {
 	if err := removeListenerFromPlane(ctx, c.WorkerHosts, WorkerPortListenContainer); err != nil {
 		return err
 	}
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	if err := removeListenerFromPlane(ctx, allHosts, NetworkTCPPortListenContainer); err != nil {
+		return err
+	}
+	if err := removeListenerFromPlane(ctx, allHosts, NetworkUDPPortListenContainer); err != nil {
+		return err
+	}
 	log.Infof("[network] Port listener containers removed successfully")
 	return nil
 }
@@ -294,18 +313,106 @@ func removeListenerFromPlane(ctx context.Context, hostPlane []*hosts.Host, conta
 	return errgrp.Wait()
 }
 
-func (c *Cluster) runServicePortChecks(ctx context.Context) error {
-	var errgrp errgroup.Group
+// NetworkPluginPort is a port a network plugin needs open between all the
+// nodes of the cluster.
+type NetworkPluginPort struct {
+	Port     string
+	Protocol string
+}
+
+func (c *Cluster) getNetworkPluginPortList(protocol string) []string {
+	portList := []string{}
+	plugin, err := GetNetworkPlugin(c.Network.Plugin)
+	if err != nil {
+		// rejected by the validation
+		return portList
+	}
+	for _, port := range plugin.Ports(c) {
+		if port.Protocol == protocol {
+			portList = append(portList, port.Port)
+		}
+	}
+	return portList
+}
+
+// PortCheckResult is the outcome of connecting from one host to a port of
+// another one.
+type PortCheckResult struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Port        string `json:"port"`
+	Protocol    string `json:"protocol"`
+	Reachable   bool   `json:"reachable"`
+}
+
+// servicePortCheck is a set of ports of the target hosts that every source
+// host has to be able to connect to.
+type servicePortCheck struct {
+	name     string
+	sources  []*hosts.Host
+	ports    []string
+	protocol string
+	targets  []*hosts.Host
+}
+
+// getServicePortChecks checks the ports of the hosts not running their
+// planes yet from every host of the source planes. With checkRunning the
+// TCP ports of the running hosts are checked too, their services answer in
+// place of the listeners. Their UDP ports are held by the kernel which never
+// answers the probes, only the new hosts get their UDP ports checked.
+func (c *Cluster) getServicePortChecks(currentCluster *Cluster, checkRunning bool) []servicePortCheck {
+	newHosts := c.getPortCheckHosts(currentCluster)
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	targets := newHosts
+	if checkRunning {
+		targets = portCheckHosts{c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts, allHosts}
+	}
+	checks := []servicePortCheck{}
 	// check etcd <-> etcd
 	// one etcd host is a pass
 	if len(c.EtcdHosts) > 1 {
-		log.Infof("[network] Running etcd <-> etcd port checks")
-		hostsQueue := util.GetObjectQueue(c.EtcdHosts)
+		checks = append(checks, servicePortCheck{"etcd <-> etcd", c.EtcdHosts, EtcdPortList, ProtocolTCP, targets.etcd})
+	}
+	checks = append(checks,
+		// check control -> etcd connectivity
+		servicePortCheck{"control plane -> etcd", c.ControlPlaneHosts, EtcdClientPortList, ProtocolTCP, targets.etcd},
+		// check controle plane -> Workers
+		servicePortCheck{"control plane -> worker", c.ControlPlaneHosts, WorkerPortList, ProtocolTCP, targets.worker},
+		// check workers -> control plane
+		servicePortCheck{"workers -> control plane", c.WorkerHosts, ControlPlanePortList, ProtocolTCP, targets.controlPlane},
+	)
+	// check node <-> node ports of the network plugin
+	if portList := c.getNetworkPluginPortList(ProtocolTCP); len(portList) > 0 {
+		name := fmt.Sprintf("%s %s node <-> node", c.Network.Plugin, ProtocolTCP)
+		checks = append(checks, servicePortCheck{name, allHosts, portList, ProtocolTCP, targets.all})
+	}
+	if portList := c.getNetworkPluginPortList(ProtocolUDP); len(portList) > 0 {
+		name := fmt.Sprintf("%s %s node <-> node", c.Network.Plugin, ProtocolUDP)
+		checks = append(checks, servicePortCheck{name, allHosts, portList, ProtocolUDP, newHosts.all})
+	}
+	ret := []servicePortCheck{}
+	for _, check := range checks {
+		if len(check.sources) > 0 && len(check.targets) > 0 {
+			ret = append(ret, check)
+		}
+	}
+	return ret
+}
+
+func (c *Cluster) runServicePortChecks(ctx context.Context, currentCluster *Cluster) error {
+	for _, check := range c.getServicePortChecks(currentCluster, false) {
+		log.Infof("[network] Running %s port checks", check.name)
+		var errgrp errgroup.Group
+		hostsQueue := util.GetObjectQueue(check.sources)
 		for w := 0; w < WorkerThreads; w++ {
 			errgrp.Go(func() error {
 				var errList []error
 				for host := range hostsQueue {
-					err := checkPlaneTCPPortsFromHost(ctx, host.(*hosts.Host), EtcdPortList, c.EtcdHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap)
+					runHost := host.(*hosts.Host)
+					results, err := checkPlanePortsFromHost(ctx, runHost, check.ports, check.protocol, check.targets, c.SystemImages.Alpine, c.PrivateRegistriesMap)
+					if err == nil {
+						err = getPortCheckError(runHost, results)
+					}
 					if err != nil {
 						errList = append(errList, err)
 					}
@@ -317,77 +424,41 @@ func (c *Cluster) runServicePortChecks(ctx context.Context) error {
 			return err
 		}
 	}
-	// check control -> etcd connectivity
-	log.Infof("[network] Running control plane -> etcd port checks")
-	hostsQueue := util.GetObjectQueue(c.ControlPlaneHosts)
-	for w := 0; w < WorkerThreads; w++ {
-		errgrp.Go(func() error {
-			var errList []error
-			for host := range hostsQueue {
-				err := checkPlaneTCPPortsFromHost(ctx, host.(*hosts.Host), EtcdClientPortList, c.EtcdHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap)
-				if err != nil {
-					errList = append(errList, err)
-				}
-			}
-			return util.ErrList(errList)
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
-		return err
-	}
-	// check controle plane -> Workers
-	log.Infof("[network] Running control plane -> worker port checks")
-	hostsQueue = util.GetObjectQueue(c.ControlPlaneHosts)
-	for w := 0; w < WorkerThreads; w++ {
-		errgrp.Go(func() error {
-			var errList []error
-			for host := range hostsQueue {
-				err := checkPlaneTCPPortsFromHost(ctx, host.(*hosts.Host), WorkerPortList, c.WorkerHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap)
-				if err != nil {
-					errList = append(errList, err)
-				}
-			}
-			return util.ErrList(errList)
-		})
-	}
-	if err := errgrp.Wait(); err != nil {
-		return err
+	return nil
+}
+
+func getPortCheckError(host *hosts.Host, results []PortCheckResult) error {
+	unreachable := []string{}
+	for _, result := range results {
+		if result.Reachable {
+			continue
+		}
+		address := fmt.Sprintf("%s:%s", result.Destination, result.Port)
+		if result.Protocol != ProtocolTCP {
+			address = fmt.Sprintf("%s/%s", address, strings.ToLower(result.Protocol))
+		}
+		unreachable = append(unreachable, address)
 	}
-	// check workers -> control plane
-	log.Infof("[network] Running workers -> control plane port checks")
-	hostsQueue = util.GetObjectQueue(c.WorkerHosts)
-	for w := 0; w < WorkerThreads; w++ {
-		errgrp.Go(func() error {
-			var errList []error
-			for host := range hostsQueue {
-				err := checkPlaneTCPPortsFromHost(ctx, host.(*hosts.Host), ControlPlanePortList, c.ControlPlaneHosts, c.SystemImages.Alpine, c.PrivateRegistriesMap)
-				if err != nil {
-					errList = append(errList, err)
-				}
-			}
-			return util.ErrList(errList)
-		})
+	if len(unreachable) > 0 {
+		return fmt.Errorf("[network] Host [%s] is not able to connect to the following ports: [%s]. Please check network policies and firewall rules", host.Address, strings.Join(unreachable, ", "))
 	}
-	return errgrp.Wait()
+	return nil
 }
 
-func checkPlaneTCPPortsFromHost(ctx context.Context, host *hosts.Host, portList []string, planeHosts []*hosts.Host, image string, prsMap map[string]types.PrivateRegistry) error {
+// checkPlanePortsFromHost connects from host to every port of the plane
+// hosts, UDP ports are reachable when the listener echoes a datagram back.
+func checkPlanePortsFromHost(ctx context.Context, host *hosts.Host, portList []string, protocol string, planeHosts []*hosts.Host, image string, prsMap map[string]types.PrivateRegistry) ([]PortCheckResult, error) {
 	hosts := []string{}
 	for _, host := range planeHosts {
 		hosts = append(hosts, host.InternalAddress)
 	}
 	imageCfg := &container.Config{
 		Image: image,
-		Tty:   true,
 		Env: []string{
 			fmt.Sprintf("HOSTS=%s", strings.Join(hosts, " ")),
 			fmt.Sprintf("PORTS=%s", strings.Join(portList, " ")),
 		},
-		Cmd: []string{
-			"sh",
-			"-c",
-			"for host in $HOSTS; do for port in $PORTS ; do echo \"Checking host ${host} on port ${port}\" >&1 & nc -w 5 -z $host $port > /dev/null || echo \"${host}:${port}\" >&2 & done; wait; done",
-		},
+		Cmd: getPortCheckCmd(protocol),
 	}
 	hostCfg := &container.HostConfig{
 		NetworkMode: "host",
@@ -396,33 +467,70 @@ func checkPlaneTCPPortsFromHost(ctx context.Context, host *hosts.Host, portList
 		},
 	}
 	if err := docker.DoRemoveContainer(ctx, host.DClient, PortCheckContainer, host.Address); err != nil {
-		return err
+		return nil, err
 	}
 	if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, PortCheckContainer, host.Address, "network", prsMap); err != nil {
-		return err
+		return nil, err
 	}
 
-	containerLog, logsErr := docker.GetContainerLogsStdoutStderr(ctx, host.DClient, PortCheckContainer, "all", true)
+	containerLog, logsErr := docker.GetContainerLogsStdout(ctx, host.DClient, PortCheckContainer, "all", true)
 	if logsErr != nil {
 		log.Warningf("[network] Failed to get network port check logs: %v", logsErr)
 	}
 	log.Debugf("[network] containerLog [%s] on host: %s", containerLog, host.Address)
 
 	if err := docker.RemoveContainer(ctx, host.DClient, host.Address, PortCheckContainer); err != nil {
-		return err
+		return nil, err
 	}
-	log.Debugf("[network] Length of containerLog is [%d] on host: %s", len(containerLog), host.Address)
-	if len(containerLog) > 0 {
-		portCheckLogs := strings.Join(strings.Split(strings.TrimSpace(containerLog), "\n"), ", ")
-		return fmt.Errorf("[network] Host [%s] is not able to connect to the following ports: [%s]. Please check network policies and firewall rules", host.Address, portCheckLogs)
+
+	return parsePortCheckLog(host, containerLog, portList, protocol, planeHosts), nil
+}
+
+// getPortCheckCmd returns the command printing "ok host port" or "fail host
+// port" for every port of $PORTS on every host of $HOSTS.
+func getPortCheckCmd(protocol string) []string {
+	check := "nc -w 5 -z $host $port > /dev/null"
+	if protocol == ProtocolUDP {
+		// a datagram can be lost, it is sent three times
+		check = "for i in 1 2 3; do [ -n \"$( (echo ping; sleep 2) | nc -u -w 2 $host $port 2>/dev/null)\" ] && break; done"
 	}
-	return nil
+	return []string{
+		"sh",
+		"-c",
+		fmt.Sprintf("for host in $HOSTS; do for port in $PORTS ; do (if %s; then echo \"ok ${host} ${port}\"; else echo \"fail ${host} ${port}\"; fi) & done; wait; done", check),
+	}
+}
+
+// parsePortCheckLog reads the "ok host port" and "fail host port" lines of
+// the port check container.
+func parsePortCheckLog(host *hosts.Host, containerLog string, portList []string, protocol string, planeHosts []*hosts.Host) []PortCheckResult {
+	reachable := map[string]bool{}
+	for _, line := range strings.Split(containerLog, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 {
+			reachable[fields[1]+":"+fields[2]] = fields[0] == "ok"
+		}
+	}
+	results := []PortCheckResult{}
+	for _, planeHost := range planeHosts {
+		for _, port := range portList {
+			results = append(results, PortCheckResult{
+				Source:      host.Address,
+				Destination: planeHost.Address,
+				Port:        port,
+				Protocol:    protocol,
+				// missing from the output counts as unreachable
+				Reachable: reachable[planeHost.InternalAddress+":"+port],
+			})
+		}
+	}
+	return results
 }
 
-func getPortBindings(hostAddress string, portList []string) []nat.PortBinding {
+func getPortBindings(hostAddress string, portList []string, protocol string) []nat.PortBinding {
 	portBindingList := []nat.PortBinding{}
 	for _, portNumber := range portList {
-		rawPort := fmt.Sprintf("%s:%s:1337/tcp", hostAddress, portNumber)
+		rawPort := fmt.Sprintf("%s:%s:%s/%s", hostAddress, portNumber, PortListenerPort, strings.ToLower(protocol))
 		portMapping, _ := nat.ParsePortSpec(rawPort)
 		portBindingList = append(portBindingList, portMapping[0].Binding)
 	}
@@ -0,0 +1,303 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/types"
+)
+
+// fakeNC answers like nc for the host:port pairs of $OPEN_PORTS, the UDP
+// peers echo a datagram back like the port listener.
+const fakeNC = `#!/bin/sh
+eval host=\${$(($# - 1))}
+eval port=\${$#}
+case " $OPEN_PORTS " in
+*" $host:$port "*) ;;
+*) exit 1 ;;
+esac
+if [ "$1" = "-u" ]; then
+	echo pong
+fi
+`
+
+func TestGetPortListenerCmd(t *testing.T) {
+	tests := []struct {
+		protocol string
+		cmd      []string
+	}{
+		{ProtocolTCP, []string{"nc", "-kl", "-p", PortListenerPort, "-e", "echo"}},
+		{ProtocolUDP, []string{"sh", "-c", "while true; do nc -u -l -p " + PortListenerPort + " -e echo pong; done"}},
+	}
+	for _, test := range tests {
+		if cmd := getPortListenerCmd(test.protocol); !reflect.DeepEqual(cmd, test.cmd) {
+			t.Errorf("getPortListenerCmd(%s) = %q, want %q", test.protocol, cmd, test.cmd)
+		}
+	}
+}
+
+func TestGetPortCheckCmd(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	binDir, err := ioutil.TempDir("", "yke-nc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	if err := ioutil.WriteFile(filepath.Join(binDir, "nc"), []byte(fakeNC), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		protocol string
+		open     string
+		output   []string
+	}{
+		{
+			name:     "tcp",
+			protocol: ProtocolTCP,
+			open:     "10.0.0.1:2379 10.0.0.2:2380",
+			output:   []string{"fail 10.0.0.1 2380", "fail 10.0.0.2 2379", "ok 10.0.0.1 2379", "ok 10.0.0.2 2380"},
+		},
+		{
+			name:     "udp echoed back by one host",
+			protocol: ProtocolUDP,
+			open:     "10.0.0.1:8472",
+			output:   []string{"fail 10.0.0.2 8472", "ok 10.0.0.1 8472"},
+		},
+	}
+	for _, test := range tests {
+		ports := "2379 2380"
+		if test.protocol == ProtocolUDP {
+			ports = "8472"
+		}
+		args := getPortCheckCmd(test.protocol)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = []string{
+			"PATH=" + binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+			"HOSTS=10.0.0.1 10.0.0.2",
+			"PORTS=" + ports,
+			"OPEN_PORTS=" + test.open,
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: port check failed: %v", test.name, err)
+		}
+		output := strings.Split(strings.TrimSpace(string(out)), "\n")
+		sort.Strings(output)
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%s: port check printed %q, want %q", test.name, output, test.output)
+		}
+	}
+}
+
+func TestParsePortCheckLog(t *testing.T) {
+	source := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.1", InternalAddress: "10.0.0.1"}}
+	target1 := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.2", InternalAddress: "10.0.0.2"}}
+	target2 := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.3", InternalAddress: "10.0.0.3"}}
+	tests := []struct {
+		name      string
+		log       string
+		reachable []bool
+	}{
+		{
+			name:      "all ok",
+			log:       "ok 10.0.0.2 2379\nok 10.0.0.2 2380\nok 10.0.0.3 2380\nok 10.0.0.3 2379\n",
+			reachable: []bool{true, true, true, true},
+		},
+		{
+			name:      "one failure",
+			log:       "ok 10.0.0.2 2379\nfail 10.0.0.2 2380\nok 10.0.0.3 2379\nok 10.0.0.3 2380",
+			reachable: []bool{true, false, true, true},
+		},
+		{
+			name:      "missing and garbled lines",
+			log:       "ok 10.0.0.2 2379\nok 10.0.0.2\nnc: bad address\nok 10.0.0.3 2379 extra\n",
+			reachable: []bool{true, false, false, false},
+		},
+		{
+			name:      "public address is not matched",
+			log:       "ok 1.1.1.2 2379\nok 1.1.1.2 2380\nok 1.1.1.3 2379\nok 1.1.1.3 2380\n",
+			reachable: []bool{false, false, false, false},
+		},
+		{
+			name:      "empty log",
+			reachable: []bool{false, false, false, false},
+		},
+	}
+	for _, test := range tests {
+		results := parsePortCheckLog(source, test.log, EtcdPortList, ProtocolTCP, []*hosts.Host{target1, target2})
+		if len(results) != len(test.reachable) {
+			t.Fatalf("%s: got %d results, want %d", test.name, len(results), len(test.reachable))
+		}
+		i := 0
+		for _, target := range []string{"1.1.1.2", "1.1.1.3"} {
+			for _, port := range EtcdPortList {
+				want := PortCheckResult{
+					Source:      "1.1.1.1",
+					Destination: target,
+					Port:        port,
+					Protocol:    ProtocolTCP,
+					Reachable:   test.reachable[i],
+				}
+				if results[i] != want {
+					t.Errorf("%s: result %d = %+v, want %+v", test.name, i, results[i], want)
+				}
+				i++
+			}
+		}
+	}
+}
+
+func TestGetPortCheckError(t *testing.T) {
+	host := &hosts.Host{ConfigNode: types.ConfigNode{Address: "1.1.1.1"}}
+	tests := []struct {
+		name    string
+		results []PortCheckResult
+		err     string
+	}{
+		{
+			name: "no result",
+		},
+		{
+			name: "all reachable",
+			results: []PortCheckResult{
+				{Destination: "1.1.1.2", Port: "2379", Protocol: ProtocolTCP, Reachable: true},
+				{Destination: "1.1.1.2", Port: "8472", Protocol: ProtocolUDP, Reachable: true},
+			},
+		},
+		{
+			name: "tcp and udp unreachable",
+			results: []PortCheckResult{
+				{Destination: "1.1.1.2", Port: "2379", Protocol: ProtocolTCP, Reachable: false},
+				{Destination: "1.1.1.2", Port: "2380", Protocol: ProtocolTCP, Reachable: true},
+				{Destination: "1.1.1.3", Port: "8472", Protocol: ProtocolUDP, Reachable: false},
+			},
+			err: "[network] Host [1.1.1.1] is not able to connect to the following ports: [1.1.1.2:2379, 1.1.1.3:8472/udp]. Please check network policies and firewall rules",
+		},
+	}
+	for _, test := range tests {
+		err := getPortCheckError(host, test.results)
+		switch {
+		case err == nil && test.err != "":
+			t.Errorf("%s: no error, want %q", test.name, test.err)
+		case err != nil && err.Error() != test.err:
+			t.Errorf("%s: error %q, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestGetServicePortChecks(t *testing.T) {
+	newHost := func(address string) *hosts.Host {
+		return &hosts.Host{ConfigNode: types.ConfigNode{Address: address}}
+	}
+	etcd1, etcd2 := newHost("1.1.1.1"), newHost("1.1.1.2")
+	control, worker1, worker2 := newHost("1.1.1.3"), newHost("1.1.1.4"), newHost("1.1.1.5")
+	newCluster := func(plugin string, workers ...*hosts.Host) *Cluster {
+		c := &Cluster{
+			EtcdHosts:         []*hosts.Host{etcd1, etcd2},
+			ControlPlaneHosts: []*hosts.Host{control},
+			WorkerHosts:       workers,
+		}
+		c.Network.Plugin = plugin
+		c.Network.Options = map[string]string{
+			FlannelBackendType: FlannelBackendVxLan,
+			FlannelBackendPort: DefaultFlannelBackendPort,
+		}
+		return c
+	}
+	// the targets of every check are listed by their addresses
+	tests := []struct {
+		name         string
+		cluster      *Cluster
+		current      *Cluster
+		checkRunning bool
+		checks       map[string][]string
+	}{
+		{
+			name:    "new cluster",
+			cluster: newCluster(FlannelNetworkPlugin, worker1),
+			checks: map[string][]string{
+				"etcd <-> etcd":             {"1.1.1.1", "1.1.1.2"},
+				"control plane -> etcd":     {"1.1.1.1", "1.1.1.2"},
+				"control plane -> worker":   {"1.1.1.4"},
+				"workers -> control plane":  {"1.1.1.3"},
+				"flannel UDP node <-> node": {"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4"},
+			},
+		},
+		{
+			name:    "worker added",
+			cluster: newCluster(FlannelNetworkPlugin, worker1, worker2),
+			current: newCluster(FlannelNetworkPlugin, worker1),
+			checks: map[string][]string{
+				"control plane -> worker":   {"1.1.1.5"},
+				"flannel UDP node <-> node": {"1.1.1.5"},
+			},
+		},
+		{
+			name:    "nothing added",
+			cluster: newCluster(CalicoNetworkPlugin, worker1),
+			current: newCluster(CalicoNetworkPlugin, worker1),
+			checks:  map[string][]string{},
+		},
+		{
+			name:         "running hosts checked",
+			cluster:      newCluster(FlannelNetworkPlugin, worker1, worker2),
+			current:      newCluster(FlannelNetworkPlugin, worker1),
+			checkRunning: true,
+			checks: map[string][]string{
+				"etcd <-> etcd":             {"1.1.1.1", "1.1.1.2"},
+				"control plane -> etcd":     {"1.1.1.1", "1.1.1.2"},
+				"control plane -> worker":   {"1.1.1.4", "1.1.1.5"},
+				"workers -> control plane":  {"1.1.1.3"},
+				"flannel UDP node <-> node": {"1.1.1.5"},
+			},
+		},
+		{
+			name:         "running calico hosts checked",
+			cluster:      newCluster(CalicoNetworkPlugin, worker1),
+			current:      newCluster(CalicoNetworkPlugin, worker1),
+			checkRunning: true,
+			checks: map[string][]string{
+				"etcd <-> etcd":            {"1.1.1.1", "1.1.1.2"},
+				"control plane -> etcd":    {"1.1.1.1", "1.1.1.2"},
+				"control plane -> worker":  {"1.1.1.4"},
+				"workers -> control plane": {"1.1.1.3"},
+				"calico TCP node <-> node": {"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4"},
+			},
+		},
+		{
+			name:    "no network plugin ports",
+			cluster: newCluster(NoNetworkPlugin, worker1),
+			checks: map[string][]string{
+				"etcd <-> etcd":            {"1.1.1.1", "1.1.1.2"},
+				"control plane -> etcd":    {"1.1.1.1", "1.1.1.2"},
+				"control plane -> worker":  {"1.1.1.4"},
+				"workers -> control plane": {"1.1.1.3"},
+			},
+		},
+	}
+	for _, test := range tests {
+		checks := map[string][]string{}
+		for _, check := range test.cluster.getServicePortChecks(test.current, test.checkRunning) {
+			targets := []string{}
+			for _, host := range check.targets {
+				targets = append(targets, host.Address)
+			}
+			sort.Strings(targets)
+			checks[check.name] = targets
+		}
+		if !reflect.DeepEqual(checks, test.checks) {
+			t.Errorf("%s: got checks %v, want %v", test.name, checks, test.checks)
+		}
+	}
+}
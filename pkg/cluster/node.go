@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
+)
+
+// AddNode reconciles a single node newly added to the cluster configuration.
+// Only the reconcile steps of the node roles are run, and a worker only node
+// is deployed alone without touching the rest of the cluster.
+func AddNode(ctx context.Context, kubeCluster, currentCluster *Cluster, address string) error {
+	host := getHostByAddress(hosts.GetUniqueHostList(kubeCluster.EtcdHosts, kubeCluster.ControlPlaneHosts, kubeCluster.WorkerHosts), address)
+	if host == nil {
+		return fmt.Errorf("Host [%s] not found in cluster configuration", address)
+	}
+	if getHostByAddress(hosts.GetUniqueHostList(currentCluster.EtcdHosts, currentCluster.ControlPlaneHosts, currentCluster.WorkerHosts), address) != nil {
+		return fmt.Errorf("Host [%s] is already part of the cluster", address)
+	}
+	kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+	}
+	kubeCluster.UpdateWorkersOnly = false
+	syncLabels(ctx, currentCluster, kubeCluster)
+
+	log.Infof("[reconcile] Adding host [%s] with roles %v", host.Address, host.Role)
+	if host.IsEtcd {
+		if err := reconcileEtcd(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return fmt.Errorf("Failed to reconcile etcd plane: %v", err)
+		}
+	}
+	if host.IsWorker {
+		if err := reconcileWorker(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return err
+		}
+	}
+	if host.IsControl {
+		if err := reconcileControl(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return err
+		}
+	}
+
+	if host.IsEtcd || host.IsControl {
+		// etcd members and control plane endpoints are referenced by every
+		// host, so certificates and planes are redeployed cluster wide
+		if err := kubeCluster.SetUpHosts(ctx, false); err != nil {
+			return err
+		}
+		if err := kubeCluster.DeployControlPlane(ctx); err != nil {
+			return err
+		}
+		if err := kubeCluster.DeployKubeletBootstrapToken(ctx); err != nil {
+			return err
+		}
+		if err := kubeCluster.DeployWorkerPlane(ctx); err != nil {
+			return err
+		}
+	} else {
+		if err := kubeCluster.setUpHostList(ctx, []*hosts.Host{host}, nil, false); err != nil {
+			return err
+		}
+		if err := kubeCluster.DeployKubeletBootstrapToken(ctx); err != nil {
+			return err
+		}
+		workerNodePlanMap := map[string]types.ConfigNodePlan{
+			host.Address: BuildKEConfigNodePlan(ctx, kubeCluster, host, host.DockerInfo),
+		}
+		if err := services.RunWorkerPlane(ctx, []*hosts.Host{host},
+			kubeCluster.LocalConnDialerFactory,
+			kubeCluster.PrivateRegistriesMap,
+			workerNodePlanMap,
+			kubeCluster.Certificates,
+			kubeCluster.UpdateWorkersOnly,
+			kubeCluster.SystemImages.Alpine); err != nil {
+			return fmt.Errorf("[workerPlane] Failed to bring up Worker Plane: %v", err)
+		}
+	}
+
+	if err := kubeCluster.CleanKubeletBootstrapToken(ctx); err != nil {
+		return err
+	}
+
+	log.Infof("[sync] Syncing node [%s] Labels and Taints", host.HostnameOverride)
+	if err := setNodeAnnotationsLabelsTaints(kubeClient, host); err != nil {
+		return err
+	}
+	log.Infof("[reconcile] Successfully added host [%s]", host.Address)
+	return nil
+}
+
+// RemoveNode drains a node removed from the cluster configuration, then runs
+// the reconcile steps of its roles to take it out of the cluster.
+func RemoveNode(ctx context.Context, kubeCluster, currentCluster *Cluster, address string) error {
+	host := getHostByAddress(hosts.GetUniqueHostList(currentCluster.EtcdHosts, currentCluster.ControlPlaneHosts, currentCluster.WorkerHosts), address)
+	if host == nil {
+		return fmt.Errorf("Host [%s] is not part of the cluster", address)
+	}
+	if getHostByAddress(hosts.GetUniqueHostList(kubeCluster.EtcdHosts, kubeCluster.ControlPlaneHosts, kubeCluster.WorkerHosts), address) != nil {
+		return fmt.Errorf("Host [%s] is still in cluster configuration", address)
+	}
+	kubeClient, err := k8s.NewClient(kubeCluster.LocalKubeConfigPath, kubeCluster.K8sWrapTransport)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize new kubernetes client: %v", err)
+	}
+	kubeCluster.UpdateWorkersOnly = false
+
+	nodeName := pki.GetNodeName(host.ConfigNode)
+	if _, err := k8s.GetNode(kubeClient, nodeName); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.Warningf("[reconcile] Can't find node by name [%s], skipping drain", nodeName)
+	} else {
+		log.Infof("[reconcile] Cordoning and draining node [%s]", nodeName)
+		if err := k8s.CordonUncordon(kubeClient, nodeName, true); err != nil {
+			return err
+		}
+		if err := k8s.DrainNode(kubeClient, nodeName, kubeCluster.UpgradeStrategy.GracePeriod, kubeCluster.UpgradeStrategy.DrainTimeout); err != nil {
+			return fmt.Errorf("Failed to drain node [%s]: %v", nodeName, err)
+		}
+	}
+
+	log.Infof("[reconcile] Removing host [%s] with roles %v", host.Address, host.Role)
+	if host.IsEtcd {
+		if err := reconcileEtcd(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return fmt.Errorf("Failed to reconcile etcd plane: %v", err)
+		}
+	}
+	if host.IsWorker {
+		if err := reconcileWorker(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return err
+		}
+	}
+	if host.IsControl {
+		if err := reconcileControl(ctx, currentCluster, kubeCluster, kubeClient); err != nil {
+			return err
+		}
+	}
+
+	if host.IsEtcd || host.IsControl {
+		if err := kubeCluster.SetUpHosts(ctx, false); err != nil {
+			return err
+		}
+	}
+	// kube-apiserver has to drop the removed etcd member
+	if host.IsEtcd {
+		if err := kubeCluster.DeployControlPlane(ctx); err != nil {
+			return err
+		}
+	}
+	// nginx proxies have to drop the removed control plane host
+	if host.IsControl {
+		if err := kubeCluster.DeployWorkerPlane(ctx); err != nil {
+			return err
+		}
+	}
+	log.Infof("[reconcile] Successfully removed host [%s]", host.Address)
+	return nil
+}
+
+func getHostByAddress(hostList []*hosts.Host, address string) *hosts.Host {
+	for _, host := range hostList {
+		if host.Address == address {
+			return host
+		}
+	}
+	return nil
+}
@@ -5,13 +5,16 @@ import (
 	"crypto/md5"
 	"fmt"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	b64 "encoding/base64"
 
 	ref "github.com/docker/distribution/reference"
 	dtypes "github.com/docker/docker/api/types"
+	"golang.org/x/sync/errgroup"
 
 	"yunion.io/x/yke/pkg/docker"
 	"yunion.io/x/yke/pkg/hosts"
@@ -19,6 +22,7 @@ import (
 	"yunion.io/x/yke/pkg/pki"
 	"yunion.io/x/yke/pkg/services"
 	"yunion.io/x/yke/pkg/types"
+	"yunion.io/x/yke/pkg/util"
 )
 
 const (
@@ -61,14 +65,20 @@ func BuildKEConfigNodePlan(ctx context.Context, myCluster *Cluster, host *hosts.
 	processes[services.KubeproxyContainerName] = myCluster.BuildKubeProxyProcess(host, prefixPath)
 
 	portChecks = append(portChecks, BuildPortChecksFromPortList(host, WorkerPortList, ProtocolTCP)...)
+	portChecks = append(portChecks, BuildPortChecksFromPortList(host, myCluster.getNetworkPluginPortList(ProtocolTCP), ProtocolTCP)...)
+	portChecks = append(portChecks, BuildPortChecksFromPortList(host, myCluster.getNetworkPluginPortList(ProtocolUDP), ProtocolUDP)...)
 	// Do we need an nginxProxy for this one ?
-	if !host.IsControl {
+	if !host.IsControl && len(myCluster.ControlPlaneEndpoint.Address) == 0 {
 		processes[services.NginxProxyContainerName] = myCluster.BuildProxyProcess()
 	}
 	if host.IsControl {
 		processes[services.KubeAPIContainerName] = myCluster.BuildKubeAPIProcess(prefixPath)
 		processes[services.KubeControllerContainerName] = myCluster.BuildKubeControllerProcess(prefixPath)
 		processes[services.SchedulerContainerName] = myCluster.BuildSchedulerProcess(prefixPath)
+		if myCluster.isControlPlaneVIP() {
+			processes[services.HAProxyContainerName] = myCluster.BuildHAProxyProcess()
+			processes[services.KeepalivedContainerName] = myCluster.BuildKeepalivedProcess(host)
+		}
 
 		portChecks = append(portChecks, BuildPortChecksFromPortList(host, ControlPlanePortList, ProtocolTCP)...)
 	}
@@ -131,6 +141,7 @@ func (c *Cluster) BuildKubeAPIProcess(prefixPath string) types.Process {
 		"tls-private-key-file":               pki.GetKeyPath(pki.KubeAPICertName),
 		"kubelet-client-certificate":         pki.GetCertPath(pki.KubeAPICertName),
 		"kubelet-client-key":                 pki.GetKeyPath(pki.KubeAPICertName),
+		"kubelet-certificate-authority":      pki.GetCertPath(pki.CACertName),
 		"service-account-key-file":           pki.GetKeyPath(pki.ServiceAccountTokenKeyName),
 		"etcd-cafile":                        etcdCAClientCert,
 		"etcd-certfile":                      etcdClientCert,
@@ -166,17 +177,20 @@ func (c *Cluster) BuildKubeAPIProcess(prefixPath string) types.Process {
 		}
 	}
 
-	if c.Authorization.Mode == services.RBACAuthorizationMode {
-		CommandArgs["authorization-mode"] = "Node,RBAC"
+	if authorizationMode := c.getAuthorizationModeArg(); len(authorizationMode) > 0 {
+		CommandArgs["authorization-mode"] = authorizationMode
 	}
 	if c.Services.KubeAPI.PodSecurityPolicy {
 		CommandArgs["runtime-config"] = "extensions/v1beta1/podsecuritypolicy=true"
-		for _, optionName := range admissionControlOptionNames {
-			if _, ok := CommandArgs[optionName]; ok {
-				CommandArgs[optionName] = CommandArgs[optionName] + ",PodSecurityPolicy"
-				break
-			}
-		}
+		addAdmissionPlugin(CommandArgs, "PodSecurityPolicy")
+	}
+	if len(CommandArgs["authorization-mode"]) > 0 {
+		// every kubelet has a node identity of its own, they can only modify
+		// their own Node and the Pods bound to it
+		addAdmissionPlugin(CommandArgs, "NodeRestriction")
+	}
+	if c.isKubeletBootstrap() {
+		CommandArgs["enable-bootstrap-token-auth"] = "true"
 	}
 
 	VolumesFrom := []string{
@@ -185,6 +199,29 @@ func (c *Cluster) BuildKubeAPIProcess(prefixPath string) types.Process {
 	Binds := []string{
 		fmt.Sprintf("%s:/etc/kubernetes:z", path.Join(prefixPath, "/etc/kubernetes")),
 	}
+	Env := c.setAuthnArgs(CommandArgs)
+	Env = append(Env, c.setAuthzWebhookArgs(CommandArgs)...)
+	if c.Services.KubeAPI.AuditLog.Enabled {
+		auditLog := c.Services.KubeAPI.AuditLog
+		CommandArgs["audit-log-path"] = auditLog.Path
+		CommandArgs["audit-log-maxage"] = strconv.Itoa(auditLog.MaxAge)
+		CommandArgs["audit-log-maxbackup"] = strconv.Itoa(auditLog.MaxBackup)
+		CommandArgs["audit-log-maxsize"] = strconv.Itoa(auditLog.MaxSize)
+		CommandArgs["audit-log-format"] = auditLog.Format
+		CommandArgs["audit-policy-file"] = AuditPolicyPath
+		auditLogDir := path.Dir(auditLog.Path)
+		Binds = append(Binds, fmt.Sprintf("%s:%s:z", path.Join(prefixPath, auditLogDir), auditLogDir))
+		// restart kube-apiserver when the policy changes
+		Env = append(Env, fmt.Sprintf("%s=%s", AuditPolicySumEnv, getAuditPolicyChecksum(c.AuditPolicyConfig)))
+	}
+	if len(c.SecretsEncryptionConfig) > 0 {
+		CommandArgs[c.getEncryptionProviderConfigArg()] = SecretsEncryptionConfigPath
+		if kmsSocketDir := c.getKMSSocketDir(); len(kmsSocketDir) > 0 {
+			Binds = append(Binds, fmt.Sprintf("%s:%s:z", kmsSocketDir, kmsSocketDir))
+		}
+		// restart kube-apiserver when the keys change
+		Env = append(Env, fmt.Sprintf("%s=%s", SecretsEncryptionSumEnv, getSecretsEncryptionChecksum(c.SecretsEncryptionConfig)))
+	}
 
 	// Override args if they exist, add additional args
 	for arg, value := range c.Services.KubeAPI.ExtraArgs {
@@ -199,6 +236,7 @@ func (c *Cluster) BuildKubeAPIProcess(prefixPath string) types.Process {
 	}
 
 	Binds = append(Binds, c.Services.KubeAPI.ExtraBinds...)
+	Env = append(Env, c.Services.KubeAPI.ExtraEnv...)
 
 	healthCheck := types.HealthCheck{
 		URL: services.GetHealthCheckURL(true, services.KubeAPIPort),
@@ -210,7 +248,7 @@ func (c *Cluster) BuildKubeAPIProcess(prefixPath string) types.Process {
 		Command:                 Command,
 		VolumesFrom:             VolumesFrom,
 		Binds:                   getUniqStringList(Binds),
-		Env:                     getUniqStringList(c.Services.KubeAPI.ExtraEnv),
+		Env:                     getUniqStringList(Env),
 		NetworkMode:             "host",
 		RestartPolicy:           "always",
 		Image:                   c.Services.KubeAPI.Image,
@@ -246,6 +284,20 @@ func (c *Cluster) BuildKubeControllerProcess(prefixPath string) types.Process {
 		"service-account-private-key-file": pki.GetKeyPath(pki.ServiceAccountTokenKeyName),
 		"root-ca-file":                     pki.GetCertPath(pki.CACertName),
 	}
+	if plugin, err := GetNetworkPlugin(c.Network.Plugin); err == nil && plugin.AllocateNodeCIDRs() {
+		CommandArgs["allocate-node-cidrs"] = "true"
+		CommandArgs["cluster-cidr"] = c.ClusterCIDR
+		if c.isIPv6Cluster() {
+			CommandArgs["node-cidr-mask-size"] = strconv.Itoa(IPv6NodeCIDRMaskSize)
+		}
+	}
+	if c.isKubeletBootstrap() {
+		// sign the certificates requested by the kubelets with the cluster CA
+		CommandArgs["cluster-signing-cert-file"] = pki.GetCertPath(pki.CACertName)
+		CommandArgs["cluster-signing-key-file"] = pki.GetKeyPath(pki.CACertName)
+		// deletes the expired bootstrap tokens
+		CommandArgs["controllers"] = "*,tokencleaner"
+	}
 	//if len(c.CloudProvider.Name) > 0 {
 	//CommandArgs["cloud-config"] = CloudConfigPath
 	//}
@@ -268,7 +320,7 @@ func (c *Cluster) BuildKubeControllerProcess(prefixPath string) types.Process {
 	}
 
 	args := []string{}
-	if c.Authorization.Mode == services.RBACAuthorizationMode {
+	if c.hasAuthzMode(services.RBACAuthorizationMode) {
 		args = append(args, "--use-service-account-credentials=true")
 	}
 	VolumesFrom := []string{
@@ -337,7 +389,6 @@ func (c *Cluster) BuildKubeletProcess(host *hosts.Host, prefixPath string) types
 		"resolv-conf":               "/etc/resolv.conf",
 		"allow-privileged":          "true",
 		//"cloud-provider":               c.CloudProvider.Name,
-		"kubeconfig":                   pki.GetConfigPath(pki.KubeNodeCertName),
 		"client-ca-file":               pki.GetCertPath(pki.CACertName),
 		"anonymous-auth":               "false",
 		"volume-plugin-dir":            "/var/lib/kubelet/volumeplugins",
@@ -345,6 +396,7 @@ func (c *Cluster) BuildKubeletProcess(host *hosts.Host, prefixPath string) types
 		"root-dir":                     path.Join(prefixPath, "/var/lib/kubelet"),
 		"authentication-token-webhook": "true",
 	}
+	c.setKubeletCertArgs(host, prefixPath, CommandArgs)
 	if host.IsControl && !host.IsWorker {
 		CommandArgs["register-with-taints"] = unschedulableControlTaint
 	}
@@ -436,7 +488,7 @@ func (c *Cluster) BuildKubeletProcess(host *hosts.Host, prefixPath string) types
 		Command:                 Command,
 		VolumesFrom:             VolumesFrom,
 		Binds:                   getUniqStringList(Binds),
-		Env:                     getUniqStringList(c.Services.Kubelet.ExtraEnv),
+		Env:                     getUniqStringList(append(c.getKubeAPIEndpointEnv(host), c.Services.Kubelet.ExtraEnv...)),
 		NetworkMode:             "host",
 		RestartPolicy:           "always",
 		Image:                   c.Services.Kubelet.Image,
@@ -463,6 +515,10 @@ func (c *Cluster) BuildKubeProxyProcess(host *hosts.Host, prefixPath string) typ
 		"hostname-override":    host.HostnameOverride,
 		"kubeconfig":           pki.GetConfigPath(pki.KubeProxyCertName),
 	}
+	if c.isIPv6Cluster() {
+		// kube-proxy picks the IP family of its rules from the bind address
+		CommandArgs["bind-address"] = "::"
+	}
 
 	// check if our version has specific options for this component
 	serviceOptions := c.GetKubernetesServicesOptions()
@@ -506,7 +562,7 @@ func (c *Cluster) BuildKubeProxyProcess(host *hosts.Host, prefixPath string) typ
 		Command:                 Command,
 		VolumesFrom:             VolumesFrom,
 		Binds:                   getUniqStringList(Binds),
-		Env:                     c.Services.Kubeproxy.ExtraEnv,
+		Env:                     append(c.getKubeAPIEndpointEnv(host), c.Services.Kubeproxy.ExtraEnv...),
 		NetworkMode:             "host",
 		RestartPolicy:           "always",
 		PidMode:                 "host",
@@ -763,6 +819,17 @@ func getCloudConfigChecksum(config types.CloudProvider) string {
 	return fmt.Sprintf("%x", configByteSum)
 }
 
+// addAdmissionPlugin enables plugin in the admission control option used by
+// the kubernetes version.
+func addAdmissionPlugin(commandArgs map[string]string, plugin string) {
+	for _, optionName := range admissionControlOptionNames {
+		if _, ok := commandArgs[optionName]; ok {
+			commandArgs[optionName] = commandArgs[optionName] + "," + plugin
+			break
+		}
+	}
+}
+
 func getUniqStringList(l []string) []string {
 	m := map[string]bool{}
 	ul := []string{}
@@ -774,3 +841,97 @@ func getUniqStringList(l []string) []string {
 	}
 	return ul
 }
+
+const (
+	ProcessActionCreate    = "create"
+	ProcessActionRecreate  = "recreate"
+	ProcessActionUnchanged = "unchanged"
+)
+
+type ProcessChange struct {
+	Address   string `json:"address"`
+	Container string `json:"container"`
+	Action    string `json:"action"`
+}
+
+// DiffPlan compares every process in the plan with the container running on
+// the reachable hosts and reports whether it would be created, recreated or
+// left untouched by the next deployment.
+func (c *Cluster) DiffPlan(ctx context.Context, clusterPlan types.Plan) ([]ProcessChange, error) {
+	nodePlanMap := map[string]types.ConfigNodePlan{}
+	for _, nodePlan := range clusterPlan.Nodes {
+		nodePlanMap[nodePlan.Address] = nodePlan
+	}
+	var changesLock sync.Mutex
+	changes := []ProcessChange{}
+	uniqHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+
+	var errgrp errgroup.Group
+	hostsQueue := util.GetObjectQueue(uniqHosts)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			var errList []error
+			for host := range hostsQueue {
+				runHost := host.(*hosts.Host)
+				nodePlan, ok := nodePlanMap[runHost.Address]
+				if !ok || runHost.DClient == nil {
+					continue
+				}
+				hostChanges, err := diffNodePlan(ctx, runHost, nodePlan)
+				if err != nil {
+					errList = append(errList, err)
+					continue
+				}
+				changesLock.Lock()
+				changes = append(changes, hostChanges...)
+				changesLock.Unlock()
+			}
+			return util.ErrList(errList)
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Address != changes[j].Address {
+			return changes[i].Address < changes[j].Address
+		}
+		return changes[i].Container < changes[j].Container
+	})
+	return changes, nil
+}
+
+func diffNodePlan(ctx context.Context, host *hosts.Host, nodePlan types.ConfigNodePlan) ([]ProcessChange, error) {
+	changes := []ProcessChange{}
+	for containerName, process := range nodePlan.Processes {
+		action, err := getProcessAction(ctx, host, containerName, process)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, ProcessChange{
+			Address:   host.Address,
+			Container: containerName,
+			Action:    action,
+		})
+	}
+	return changes, nil
+}
+
+func getProcessAction(ctx context.Context, host *hosts.Host, containerName string, process types.Process) (string, error) {
+	exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, containerName, true)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return ProcessActionCreate, nil
+	}
+	imageCfg, hostCfg, _ := services.GetProcessConfig(process)
+	upgradable, err := docker.IsContainerUpgradable(ctx, host.DClient, imageCfg, hostCfg, containerName, host.Address, "plan")
+	if err != nil {
+		return "", err
+	}
+	if upgradable {
+		return ProcessActionRecreate, nil
+	}
+	return ProcessActionUnchanged, nil
+}
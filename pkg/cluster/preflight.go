@@ -0,0 +1,519 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/sync/errgroup"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/docker"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/util"
+)
+
+const (
+	PreflightContainer = "yke-preflight"
+
+	PreflightStatusPass = "pass"
+	PreflightStatusWarn = "warn"
+	PreflightStatusFail = "fail"
+
+	// free space in MiB of the docker root dir and the etcd data dir
+	PreflightMinFreeDiskMB  = 2048
+	PreflightWarnFreeDiskMB = 10240
+	// clock offset in seconds between the nodes
+	PreflightWarnClockSkew = 2
+	PreflightMaxClockSkew  = 30
+
+	// source of the checks run from the machine running yke
+	PreflightLocalSource = "local"
+
+	DefaultKubeletCgroupDriver = "cgroupfs"
+	KubeProxyModeIPVS          = "ipvs"
+
+	preflightHostSys     = "/host/sys"
+	preflightHostDocker  = "/host/docker"
+	preflightHostVarLib  = "/host/var/lib"
+	preflightFactsScript = `echo "time=$(date +%s)"
+for m in $MODULES; do
+  if grep -qs "^$m " /proc/modules || [ -d /host/sys/module/$m ]; then echo "module.$m=1"; else echo "module.$m=0"; fi
+done
+for s in $SYSCTLS; do
+  f=/proc/sys/$(echo $s | tr . /)
+  if [ -f $f ]; then echo "sysctl.$s=$(cat $f)"; else echo "sysctl.$s="; fi
+done
+echo "swap=$(tail -n +2 /proc/swaps | wc -l)"
+echo "selinux=$(cat /host/sys/fs/selinux/enforce 2>/dev/null)"
+echo "disk.docker=$(df -Pk /host/docker | tail -n 1 | awk '{print $4}')"
+if [ -n "$ETCD" ]; then echo "disk.etcd=$(df -Pk /host/var/lib | tail -n 1 | awk '{print $4}')"; fi
+if [ -n "$VIP_IFACE" ]; then
+  if ip link show dev "$VIP_IFACE" > /dev/null 2>&1; then echo "vip.iface=1"; else echo "vip.iface=0"; fi
+  echo "vip.addresses=$(ip -o addr show dev "$VIP_IFACE" 2>/dev/null | awk '{print $4}' | xargs)"
+fi
+`
+)
+
+// kernel modules and sysctls needed by kubelet and the network plugin on
+// every node
+var preflightKernelModules = []string{"br_netfilter"}
+
+var preflightIPVSKernelModules = []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+
+var preflightSysctls = map[string]string{
+	"net.bridge.bridge-nf-call-iptables": "1",
+	"net.ipv4.ip_forward":                "1",
+}
+
+type PreflightResult struct {
+	Host    string `json:"host"`
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type PreflightReport struct {
+	Results []PreflightResult `json:"results"`
+	// every source, destination and port tried by the port checks
+	NetworkMatrix []PortCheckResult `json:"networkMatrix,omitempty"`
+}
+
+// HasFailures reports whether any check failed, warnings don't stop a deploy.
+func (r *PreflightReport) HasFailures() bool {
+	return r.Count(PreflightStatusFail) > 0
+}
+
+// Count returns the number of checks with the given status.
+func (r *PreflightReport) Count(status string) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+type preflightReportBuilder struct {
+	lock          sync.Mutex
+	results       []PreflightResult
+	networkMatrix []PortCheckResult
+}
+
+func (b *preflightReportBuilder) addPortCheckResults(results []PortCheckResult) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.networkMatrix = append(b.networkMatrix, results...)
+}
+
+func (b *preflightReportBuilder) add(host, check, status, format string, args ...interface{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.results = append(b.results, PreflightResult{
+		Host:    host,
+		Check:   check,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// hostFacts are collected from a node by the preflight container.
+type hostFacts struct {
+	values map[string]string
+	// offset of the node clock from the local clock in seconds
+	clockOffset int64
+}
+
+// RunPreflightChecks checks that every host is able to run its roles before
+// any container of the cluster is changed. Port checks between the nodes
+// are part of the report unless portChecks is false, on an existing cluster
+// only the ports of the added hosts are checked unless checkRunning is set.
+func (c *Cluster) RunPreflightChecks(ctx context.Context, currentCluster *Cluster, portChecks, checkRunning bool) (*PreflightReport, error) {
+	log.Infof("[preflight] Running preflight checks on cluster hosts")
+	builder := &preflightReportBuilder{}
+	allHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+
+	var errgrp errgroup.Group
+	var factsLock sync.Mutex
+	facts := map[string]*hostFacts{}
+	hostsQueue := util.GetObjectQueue(allHosts)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			for host := range hostsQueue {
+				runHost := host.(*hosts.Host)
+				hostFacts, err := c.getHostFacts(ctx, runHost)
+				if err != nil {
+					builder.add(runHost.Address, "host-facts", PreflightStatusFail, "Failed to run preflight container: %v", err)
+					continue
+				}
+				factsLock.Lock()
+				facts[runHost.Address] = hostFacts
+				factsLock.Unlock()
+				c.checkHostFacts(runHost, hostFacts, builder)
+			}
+			return nil
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return nil, err
+	}
+	checkClockSkew(allHosts, facts, builder)
+
+	if portChecks {
+		if err := c.runPreflightPortChecks(ctx, currentCluster, checkRunning, builder); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &PreflightReport{Results: builder.results, NetworkMatrix: builder.networkMatrix}
+	sort.SliceStable(report.Results, func(i, j int) bool {
+		if report.Results[i].Host != report.Results[j].Host {
+			return report.Results[i].Host < report.Results[j].Host
+		}
+		return report.Results[i].Check < report.Results[j].Check
+	})
+	sort.SliceStable(report.NetworkMatrix, func(i, j int) bool {
+		a, b := report.NetworkMatrix[i], report.NetworkMatrix[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Destination != b.Destination {
+			return a.Destination < b.Destination
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Port < b.Port
+	})
+	log.Infof("[preflight] Preflight checks finished: %d passed, %d warnings, %d failed",
+		report.Count(PreflightStatusPass), report.Count(PreflightStatusWarn), report.Count(PreflightStatusFail))
+	return report, nil
+}
+
+func (c *Cluster) getHostFacts(ctx context.Context, host *hosts.Host) (*hostFacts, error) {
+	sysctls := []string{}
+	for sysctl := range preflightSysctls {
+		sysctls = append(sysctls, sysctl)
+	}
+	env := []string{
+		fmt.Sprintf("MODULES=%s", strings.Join(c.getPreflightKernelModules(), " ")),
+		fmt.Sprintf("SYSCTLS=%s", strings.Join(sysctls, " ")),
+	}
+	binds := []string{
+		fmt.Sprintf("/sys:%s:ro", preflightHostSys),
+		fmt.Sprintf("%s:%s:ro", host.DockerInfo.DockerRootDir, preflightHostDocker),
+	}
+	if host.IsControl && c.isControlPlaneVIP() {
+		env = append(env, fmt.Sprintf("VIP_IFACE=%s", c.ControlPlaneEndpoint.Interface))
+	}
+	if host.IsEtcd {
+		env = append(env, "ETCD=true")
+		binds = append(binds, fmt.Sprintf("%s:%s:ro", path.Join(host.PrefixPath, "/var/lib"), preflightHostVarLib))
+	}
+	imageCfg := &container.Config{
+		Image: c.SystemImages.Alpine,
+		Env:   env,
+		Cmd:   []string{"sh", "-c", preflightFactsScript},
+	}
+	hostCfg := &container.HostConfig{
+		// sysctls of the network namespace of the host
+		NetworkMode: "host",
+		Binds:       binds,
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+	// pull first so that the clock is read right after the container starts
+	if err := docker.UseLocalOrPull(ctx, host.DClient, host.Address, c.SystemImages.Alpine, "preflight", c.PrivateRegistriesMap); err != nil {
+		return nil, err
+	}
+	if err := docker.DoRemoveContainer(ctx, host.DClient, PreflightContainer, host.Address); err != nil {
+		return nil, err
+	}
+	before := time.Now().Unix()
+	if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, PreflightContainer, host.Address, "preflight", c.PrivateRegistriesMap); err != nil {
+		return nil, err
+	}
+	containerLog, err := docker.GetContainerLogsStdout(ctx, host.DClient, PreflightContainer, "all", true)
+	after := time.Now().Unix()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[preflight] containerLog [%s] on host: %s", containerLog, host.Address)
+	if err := docker.RemoveContainer(ctx, host.DClient, host.Address, PreflightContainer); err != nil {
+		return nil, err
+	}
+
+	facts := &hostFacts{values: map[string]string{}}
+	for _, line := range strings.Split(containerLog, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 {
+			facts.values[parts[0]] = parts[1]
+		}
+	}
+	hostTime, err := strconv.ParseInt(facts.values["time"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the clock of host [%s]: %v", host.Address, err)
+	}
+	// the node clock was read some time between before and after, it's only
+	// off when it's outside of that window
+	if hostTime < before {
+		facts.clockOffset = hostTime - before
+	} else if hostTime > after {
+		facts.clockOffset = hostTime - after
+	}
+	return facts, nil
+}
+
+func (c *Cluster) checkHostFacts(host *hosts.Host, facts *hostFacts, builder *preflightReportBuilder) {
+	for _, module := range c.getPreflightKernelModules() {
+		check := "module/" + module
+		if facts.values["module."+module] == "1" {
+			builder.add(host.Address, check, PreflightStatusPass, "Kernel module is loaded")
+		} else {
+			builder.add(host.Address, check, PreflightStatusFail, "Kernel module is not loaded, load it with modprobe %s and add it to /etc/modules-load.d", module)
+		}
+	}
+
+	for sysctl, expected := range preflightSysctls {
+		check := "sysctl/" + sysctl
+		value, ok := facts.values["sysctl."+sysctl]
+		switch {
+		case !ok || len(value) == 0:
+			builder.add(host.Address, check, PreflightStatusFail, "Sysctl is not available")
+		case value != expected:
+			builder.add(host.Address, check, PreflightStatusFail, "Sysctl is %s, must be %s", value, expected)
+		default:
+			builder.add(host.Address, check, PreflightStatusPass, "Sysctl is %s", value)
+		}
+	}
+
+	if facts.values["swap"] != "0" {
+		if c.Services.Kubelet.FailSwapOn {
+			builder.add(host.Address, "swap", PreflightStatusFail, "Swap is on and fail_swap_on is set, turn it off with swapoff -a and remove it from /etc/fstab")
+		} else {
+			builder.add(host.Address, "swap", PreflightStatusWarn, "Swap is on, kubelet tolerates it because fail_swap_on is not set")
+		}
+	} else {
+		builder.add(host.Address, "swap", PreflightStatusPass, "Swap is off")
+	}
+
+	checkFreeDisk(host.Address, "disk/docker", host.DockerInfo.DockerRootDir, facts.values["disk.docker"], builder)
+	if host.IsEtcd {
+		checkFreeDisk(host.Address, "disk/etcd", path.Join(host.PrefixPath, "/var/lib"), facts.values["disk.etcd"], builder)
+	}
+
+	driver := c.getKubeletCgroupDriver()
+	if host.DockerInfo.CgroupDriver != driver {
+		builder.add(host.Address, "cgroup-driver", PreflightStatusFail, "Docker uses cgroup driver %s but kubelet uses %s, set cgroup-driver in the kubelet extra_args or change the docker daemon", host.DockerInfo.CgroupDriver, driver)
+	} else {
+		builder.add(host.Address, "cgroup-driver", PreflightStatusPass, "Docker and kubelet use cgroup driver %s", driver)
+	}
+
+	if host.IsControl && c.isControlPlaneVIP() {
+		checkControlPlaneVIP(host.Address, c.ControlPlaneEndpoint.Address, c.ControlPlaneEndpoint.Interface, facts.values["vip.iface"], facts.values["vip.addresses"], builder)
+	}
+
+	switch facts.values["selinux"] {
+	case "1":
+		if hasSecurityOption(host.DockerInfo.SecurityOptions, "selinux") {
+			builder.add(host.Address, "selinux", PreflightStatusPass, "SELinux is enforcing and docker has SELinux support enabled")
+		} else {
+			builder.add(host.Address, "selinux", PreflightStatusWarn, "SELinux is enforcing but docker runs without SELinux support, volumes may not be relabeled")
+		}
+	case "0":
+		builder.add(host.Address, "selinux", PreflightStatusPass, "SELinux is permissive")
+	default:
+		builder.add(host.Address, "selinux", PreflightStatusPass, "SELinux is disabled")
+	}
+}
+
+// checkControlPlaneVIP checks that keepalived is able to announce the
+// virtual IP on the interface of a control plane host, addresses are the
+// CIDRs of the interface.
+func checkControlPlaneVIP(address, vip, iface, ifaceFound, addresses string, builder *preflightReportBuilder) {
+	const check = "control-plane-endpoint"
+	if ifaceFound != "1" {
+		builder.add(address, check, PreflightStatusFail, "Interface [%s] of the control plane endpoint doesn't exist", iface)
+		return
+	}
+	vipIP := net.ParseIP(vip)
+	for _, cidr := range strings.Fields(addresses) {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(vipIP) {
+			builder.add(address, check, PreflightStatusPass, "Virtual IP [%s] is in the subnet %s of interface [%s]", vip, ipNet, iface)
+			return
+		}
+	}
+	if len(strings.Fields(addresses)) == 0 {
+		builder.add(address, check, PreflightStatusFail, "Interface [%s] of the control plane endpoint has no address", iface)
+		return
+	}
+	builder.add(address, check, PreflightStatusFail, "Virtual IP [%s] is outside of the subnets [%s] of interface [%s], the other hosts can't reach it", vip, addresses, iface)
+}
+
+func checkFreeDisk(address, check, dir, availableKB string, builder *preflightReportBuilder) {
+	available, err := strconv.ParseInt(availableKB, 10, 64)
+	if err != nil {
+		builder.add(address, check, PreflightStatusWarn, "Failed to read free space of %s", dir)
+		return
+	}
+	availableMB := available / 1024
+	switch {
+	case availableMB < PreflightMinFreeDiskMB:
+		builder.add(address, check, PreflightStatusFail, "Only %d MiB free in %s, at least %d MiB are needed", availableMB, dir, PreflightMinFreeDiskMB)
+	case availableMB < PreflightWarnFreeDiskMB:
+		builder.add(address, check, PreflightStatusWarn, "Only %d MiB free in %s", availableMB, dir)
+	default:
+		builder.add(address, check, PreflightStatusPass, "%d MiB free in %s", availableMB, dir)
+	}
+}
+
+// checkClockSkew compares the clocks of the nodes to each other, the local
+// clock is only used as a common reference.
+func checkClockSkew(allHosts []*hosts.Host, facts map[string]*hostFacts, builder *preflightReportBuilder) {
+	offsets := []int64{}
+	for _, host := range allHosts {
+		if hostFacts, ok := facts[host.Address]; ok {
+			offsets = append(offsets, hostFacts.clockOffset)
+		}
+	}
+	if len(offsets) == 0 {
+		return
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+	for _, host := range allHosts {
+		hostFacts, ok := facts[host.Address]
+		if !ok {
+			continue
+		}
+		skew := hostFacts.clockOffset - median
+		if skew < 0 {
+			skew = -skew
+		}
+		switch {
+		case skew >= PreflightMaxClockSkew:
+			builder.add(host.Address, "clock", PreflightStatusFail, "Clock is %ds off from the other nodes, sync it with NTP", skew)
+		case skew >= PreflightWarnClockSkew:
+			builder.add(host.Address, "clock", PreflightStatusWarn, "Clock is %ds off from the other nodes, sync it with NTP", skew)
+		default:
+			builder.add(host.Address, "clock", PreflightStatusPass, "Clock is in sync with the other nodes")
+		}
+	}
+}
+
+func (c *Cluster) runPreflightPortChecks(ctx context.Context, currentCluster *Cluster, checkRunning bool, builder *preflightReportBuilder) error {
+	newHosts := c.getPortCheckHosts(currentCluster)
+	udpPorts := c.getNetworkPluginPortList(ProtocolUDP)
+	for _, host := range hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts) {
+		switch {
+		case !checkRunning && !hostInList(host, newHosts.etcd, newHosts.controlPlane, newHosts.worker):
+			builder.add(host.Address, "ports", PreflightStatusPass, "Host already runs the cluster, its ports are not checked")
+		case checkRunning && len(udpPorts) > 0 && !hostInList(host, newHosts.all):
+			builder.add(host.Address, "ports", PreflightStatusPass, "Host already runs the cluster, its UDP ports [%s] are not checked", strings.Join(udpPorts, ","))
+		}
+	}
+	if err := c.deployTCPPortListeners(ctx, currentCluster); err != nil {
+		return err
+	}
+	for _, check := range c.getServicePortChecks(currentCluster, checkRunning) {
+		log.Infof("[preflight] Running %s port checks", check.name)
+		var errgrp errgroup.Group
+		hostsQueue := util.GetObjectQueue(check.sources)
+		for w := 0; w < WorkerThreads; w++ {
+			errgrp.Go(func() error {
+				for host := range hostsQueue {
+					runHost := host.(*hosts.Host)
+					name := fmt.Sprintf("ports/%s", check.name)
+					results, err := checkPlanePortsFromHost(ctx, runHost, check.ports, check.protocol, check.targets, c.SystemImages.Alpine, c.PrivateRegistriesMap)
+					if err == nil {
+						builder.addPortCheckResults(results)
+						err = getPortCheckError(runHost, results)
+					}
+					if err != nil {
+						builder.add(runHost.Address, name, PreflightStatusFail, "%v", err)
+					} else {
+						builder.add(runHost.Address, name, PreflightStatusPass, "Ports [%s] are reachable", strings.Join(check.ports, ","))
+					}
+				}
+				return nil
+			})
+		}
+		errgrp.Wait()
+	}
+	if c.K8sWrapTransport == nil && !c.hasBastionHosts() {
+		for _, host := range c.ControlPlaneHosts {
+			name := fmt.Sprintf("ports/yke -> %s", KubeAPIPort)
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(host.Address, KubeAPIPort), time.Second*5)
+			builder.addPortCheckResults([]PortCheckResult{{
+				Source:      PreflightLocalSource,
+				Destination: host.Address,
+				Port:        KubeAPIPort,
+				Protocol:    ProtocolTCP,
+				Reachable:   err == nil,
+			}})
+			if err != nil {
+				builder.add(host.Address, name, PreflightStatusFail, "KubeAPI port is not reachable from this machine: %v", err)
+				continue
+			}
+			conn.Close()
+			builder.add(host.Address, name, PreflightStatusPass, "KubeAPI port is reachable from this machine")
+		}
+	}
+	return c.removeTCPPortListeners(ctx)
+}
+
+func (c *Cluster) getPreflightKernelModules() []string {
+	modules := append([]string{}, preflightKernelModules...)
+	if c.getKubeProxyMode() == KubeProxyModeIPVS {
+		modules = append(modules, preflightIPVSKernelModules...)
+	}
+	return modules
+}
+
+func (c *Cluster) getKubeletCgroupDriver() string {
+	if driver, ok := c.Services.Kubelet.ExtraArgs["cgroup-driver"]; ok {
+		return driver
+	}
+	if driver, ok := c.GetKubernetesServicesOptions().Kubelet["cgroup-driver"]; ok && len(driver) > 0 {
+		return driver
+	}
+	return DefaultKubeletCgroupDriver
+}
+
+func (c *Cluster) getKubeProxyMode() string {
+	if mode, ok := c.Services.Kubeproxy.ExtraArgs["proxy-mode"]; ok {
+		return mode
+	}
+	return c.GetKubernetesServicesOptions().Kubeproxy["proxy-mode"]
+}
+
+func hostInList(host *hosts.Host, hostLists ...[]*hosts.Host) bool {
+	for _, hostList := range hostLists {
+		for _, h := range hostList {
+			if h.Address == host.Address {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSecurityOption(options []string, name string) bool {
+	for _, option := range options {
+		// name=selinux on recent docker versions, selinux on older ones
+		if option == name || strings.HasPrefix(option, "name="+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"testing"
+
+	"yunion.io/x/yke/pkg/hosts"
+)
+
+func TestCheckFreeDisk(t *testing.T) {
+	tests := []struct {
+		availableKB string
+		status      string
+	}{
+		{"", PreflightStatusWarn},
+		{"not a number", PreflightStatusWarn},
+		{"0", PreflightStatusFail},
+		{"2097151", PreflightStatusFail},
+		{"2097152", PreflightStatusWarn},
+		{"10485759", PreflightStatusWarn},
+		{"10485760", PreflightStatusPass},
+		{"104857600", PreflightStatusPass},
+	}
+	for _, test := range tests {
+		builder := &preflightReportBuilder{}
+		checkFreeDisk("1.1.1.1", "disk/docker", "/var/lib/docker", test.availableKB, builder)
+		if len(builder.results) != 1 {
+			t.Fatalf("checkFreeDisk(%q) reported %d results, want 1", test.availableKB, len(builder.results))
+		}
+		if status := builder.results[0].Status; status != test.status {
+			t.Errorf("checkFreeDisk(%q) = %s, want %s", test.availableKB, status, test.status)
+		}
+	}
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets []int64
+		status  []string
+	}{
+		{
+			name:    "in sync",
+			offsets: []int64{0, 1, -1},
+			status:  []string{PreflightStatusPass, PreflightStatusPass, PreflightStatusPass},
+		},
+		{
+			name:    "offset shared by all the nodes",
+			offsets: []int64{100, 100, 101},
+			status:  []string{PreflightStatusPass, PreflightStatusPass, PreflightStatusPass},
+		},
+		{
+			name:    "warn threshold",
+			offsets: []int64{0, 0, PreflightWarnClockSkew - 1, -PreflightWarnClockSkew},
+			status:  []string{PreflightStatusPass, PreflightStatusPass, PreflightStatusPass, PreflightStatusWarn},
+		},
+		{
+			name:    "fail threshold",
+			offsets: []int64{0, 0, 0, PreflightMaxClockSkew - 1, -PreflightMaxClockSkew},
+			status:  []string{PreflightStatusPass, PreflightStatusPass, PreflightStatusPass, PreflightStatusWarn, PreflightStatusFail},
+		},
+		{
+			name:    "single node",
+			offsets: []int64{3600},
+			status:  []string{PreflightStatusPass},
+		},
+	}
+	addresses := []string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"}
+	for _, test := range tests {
+		allHosts := []*hosts.Host{}
+		facts := map[string]*hostFacts{}
+		for i, offset := range test.offsets {
+			host := &hosts.Host{}
+			host.Address = addresses[i]
+			allHosts = append(allHosts, host)
+			facts[host.Address] = &hostFacts{clockOffset: offset}
+		}
+		// hosts without facts are not reported
+		missing := &hosts.Host{}
+		missing.Address = "2.2.2.2"
+		allHosts = append(allHosts, missing)
+
+		builder := &preflightReportBuilder{}
+		checkClockSkew(allHosts, facts, builder)
+		if len(builder.results) != len(test.status) {
+			t.Fatalf("%s: got %d results, want %d", test.name, len(builder.results), len(test.status))
+		}
+		for i, result := range builder.results {
+			if result.Host != addresses[i] || result.Status != test.status[i] {
+				t.Errorf("%s: host %s got %s, want %s on %s", test.name, result.Host, result.Status, test.status[i], addresses[i])
+			}
+		}
+	}
+
+	builder := &preflightReportBuilder{}
+	checkClockSkew(nil, map[string]*hostFacts{}, builder)
+	if len(builder.results) != 0 {
+		t.Errorf("No results are expected without hosts, got %d", len(builder.results))
+	}
+}
+
+func TestHasSecurityOption(t *testing.T) {
+	tests := []struct {
+		options []string
+		name    string
+		want    bool
+	}{
+		{nil, "selinux", false},
+		{[]string{"apparmor", "seccomp"}, "selinux", false},
+		{[]string{"selinux"}, "selinux", true},
+		{[]string{"name=seccomp,profile=default", "name=selinux"}, "selinux", true},
+		{[]string{"name=seccomp,profile=default"}, "selinux", false},
+		{[]string{"selinux-disabled"}, "selinux", false},
+	}
+	for _, test := range tests {
+		if got := hasSecurityOption(test.options, test.name); got != test.want {
+			t.Errorf("hasSecurityOption(%v, %q) = %v, want %v", test.options, test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckControlPlaneVIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		vip        string
+		ifaceFound string
+		addresses  string
+		status     string
+	}{
+		{"in the subnet", "10.0.0.100", "1", "10.0.0.1/24", PreflightStatusPass},
+		{"in the second subnet", "192.168.1.100", "1", "10.0.0.1/24 192.168.1.1/24 fe80::1/64", PreflightStatusPass},
+		{"held by the host", "10.0.0.100", "1", "10.0.0.1/24 10.0.0.100/32", PreflightStatusPass},
+		{"ipv6 in the subnet", "fd00::100", "1", "10.0.0.1/24 fd00::1/64", PreflightStatusPass},
+		{"outside of the subnet", "10.0.1.100", "1", "10.0.0.1/24", PreflightStatusFail},
+		{"outside of every subnet", "172.16.0.100", "1", "10.0.0.1/24 fd00::1/64", PreflightStatusFail},
+		{"interface without address", "10.0.0.100", "1", "", PreflightStatusFail},
+		{"missing interface", "10.0.0.100", "0", "", PreflightStatusFail},
+		{"not reported", "10.0.0.100", "", "", PreflightStatusFail},
+	}
+	for _, test := range tests {
+		builder := &preflightReportBuilder{}
+		checkControlPlaneVIP("1.1.1.1", test.vip, "eth0", test.ifaceFound, test.addresses, builder)
+		if len(builder.results) != 1 {
+			t.Fatalf("%s: reported %d results, want 1", test.name, len(builder.results))
+		}
+		if status := builder.results[0].Status; status != test.status {
+			t.Errorf("%s: status %s, want %s: %s", test.name, status, test.status, builder.results[0].Message)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package cluster
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/docker"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/types"
+	"yunion.io/x/yke/pkg/util"
+)
+
+const (
+	SecretsEncryptionConfigWriter  = "secrets-encryption-config-writer"
+	SecretsEncryptionConfigFetcher = "secrets-encryption-config-fetcher"
+	SecretsEncryptionConfigPath    = "/etc/kubernetes/encryption-provider-config.yaml"
+	SecretsEncryptionSecretName    = "kube-secrets-encryption-config"
+	SecretsEncryptionSumEnv        = "YKE_SECRETS_ENCRYPTION_CHECKSUM"
+	SecretsEncryptionServiceName   = "secrets-encryption"
+
+	AESCBCEncryptionProvider    = "aescbc"
+	SecretboxEncryptionProvider = "secretbox"
+	KMSEncryptionProvider       = "kms"
+
+	DefaultKMSCacheSize = 1000
+	DefaultKMSTimeout   = "3s"
+
+	// the encryption provider config isn't experimental anymore since v1.13
+	EncryptionConfigGAMinorVersion = 13
+	// aescbc and secretbox both take 32 bytes keys
+	encryptionKeySize = 32
+)
+
+// encryptionConfig is the EncryptionConfiguration read by kube-apiserver,
+// the config deployed to the control plane hosts is the state of the keys.
+type encryptionConfig struct {
+	APIVersion string                     `yaml:"apiVersion"`
+	Kind       string                     `yaml:"kind"`
+	Resources  []encryptionResourceConfig `yaml:"resources"`
+}
+
+type encryptionResourceConfig struct {
+	Resources []string                   `yaml:"resources"`
+	Providers []encryptionProviderConfig `yaml:"providers"`
+}
+
+// encryptionProviderConfig has exactly one of its fields set.
+type encryptionProviderConfig struct {
+	AESCBC    *encryptionKeysConfig `yaml:"aescbc,omitempty"`
+	Secretbox *encryptionKeysConfig `yaml:"secretbox,omitempty"`
+	KMS       *encryptionKMSConfig  `yaml:"kms,omitempty"`
+	Identity  *struct{}             `yaml:"identity,omitempty"`
+}
+
+type encryptionKeysConfig struct {
+	Keys []encryptionKey `yaml:"keys"`
+}
+
+type encryptionKey struct {
+	Name   string `yaml:"name"`
+	Secret string `yaml:"secret"`
+}
+
+type encryptionKMSConfig struct {
+	Name      string `yaml:"name"`
+	Endpoint  string `yaml:"endpoint"`
+	CacheSize int    `yaml:"cachesize,omitempty"`
+	Timeout   string `yaml:"timeout,omitempty"`
+}
+
+func (p encryptionProviderConfig) name() string {
+	switch {
+	case p.AESCBC != nil:
+		return AESCBCEncryptionProvider
+	case p.Secretbox != nil:
+		return SecretboxEncryptionProvider
+	case p.KMS != nil:
+		return KMSEncryptionProvider
+	}
+	return "identity"
+}
+
+func (p encryptionProviderConfig) keys() *encryptionKeysConfig {
+	if p.AESCBC != nil {
+		return p.AESCBC
+	}
+	return p.Secretbox
+}
+
+func (c *Cluster) setSecretsEncryptionDefaults() {
+	encryption := &c.Services.KubeAPI.SecretsEncryption
+	if !encryption.Enabled {
+		return
+	}
+	setDefaultIfEmpty(&encryption.Provider, AESCBCEncryptionProvider)
+	if encryption.Provider != KMSEncryptionProvider {
+		return
+	}
+	setDefaultIfEmpty(&encryption.KMS.Timeout, DefaultKMSTimeout)
+	if encryption.KMS.CacheSize == 0 {
+		encryption.KMS.CacheSize = DefaultKMSCacheSize
+	}
+}
+
+func validateSecretsEncryption(c *Cluster) error {
+	encryption := c.Services.KubeAPI.SecretsEncryption
+	if !encryption.Enabled {
+		return nil
+	}
+	switch encryption.Provider {
+	case AESCBCEncryptionProvider, SecretboxEncryptionProvider:
+		return nil
+	case KMSEncryptionProvider:
+	default:
+		return fmt.Errorf("Secrets encryption provider [%s] is not supported, must be %s, %s or %s", encryption.Provider, AESCBCEncryptionProvider, SecretboxEncryptionProvider, KMSEncryptionProvider)
+	}
+	if len(encryption.KMS.Name) == 0 {
+		return fmt.Errorf("Secrets encryption kms name can't be empty")
+	}
+	if !strings.HasPrefix(encryption.KMS.Endpoint, "unix://") {
+		return fmt.Errorf("Secrets encryption kms endpoint [%s] must be a unix:// socket", encryption.KMS.Endpoint)
+	}
+	if encryption.KMS.CacheSize < 0 {
+		return fmt.Errorf("Secrets encryption kms cache_size can't be negative")
+	}
+	if _, err := time.ParseDuration(encryption.KMS.Timeout); err != nil {
+		return fmt.Errorf("Secrets encryption kms timeout [%s] is not valid: %v", encryption.KMS.Timeout, err)
+	}
+	return nil
+}
+
+// SetUpSecretsEncryption loads the encryption config of the cluster and
+// updates it to the provider of the cluster file, the keys already in use
+// are kept so that the stored Secrets can still be read. The Secrets are
+// rewritten by RewriteSecrets when the provider encrypting them changed,
+// the first time the encryption is enabled included.
+func SetUpSecretsEncryption(ctx context.Context, kubeCluster, currentCluster *Cluster) error {
+	current, err := kubeCluster.getSecretsEncryptionConfig(ctx, currentCluster != nil)
+	if err != nil {
+		return err
+	}
+	config, err := kubeCluster.buildSecretsEncryptionConfig(current)
+	if err != nil {
+		return err
+	}
+	kubeCluster.SecretsEncryptionChanged = getPrimaryEncryptionProvider(current) != getPrimaryEncryptionProvider(config)
+	return kubeCluster.setSecretsEncryptionConfig(config)
+}
+
+// RewriteSecrets stores the Secrets again once the control plane runs a new
+// primary encryption provider, the Secrets written before it are left as
+// they are by kube-apiserver otherwise.
+func (c *Cluster) RewriteSecrets(ctx context.Context) error {
+	if !c.SecretsEncryptionChanged || c.KubeClient == nil {
+		return nil
+	}
+	log.Infof("[%s] Rewriting Secrets with the %s provider", SecretsEncryptionServiceName, c.Services.KubeAPI.SecretsEncryption.Provider)
+	if err := k8s.RewriteSecrets(c.KubeClient); err != nil {
+		return fmt.Errorf("[%s] Failed to rewrite Secrets: %v", SecretsEncryptionServiceName, err)
+	}
+	c.SecretsEncryptionChanged = false
+	return nil
+}
+
+// getPrimaryEncryptionProvider identifies the provider and key encrypting
+// the Secrets written with config.
+func getPrimaryEncryptionProvider(config *encryptionConfig) string {
+	if config == nil || len(config.Resources) == 0 || len(config.Resources[0].Providers) == 0 {
+		return "identity"
+	}
+	primary := config.Resources[0].Providers[0]
+	switch {
+	case primary.KMS != nil:
+		return fmt.Sprintf("%s/%s", primary.name(), primary.KMS.Name)
+	case primary.keys() != nil && len(primary.keys().Keys) > 0:
+		return fmt.Sprintf("%s/%s", primary.name(), primary.keys().Keys[0].Name)
+	}
+	return primary.name()
+}
+
+// getSecretsEncryptionConfig fetches the encryption config saved in
+// kubernetes, or its copy on the control plane hosts.
+func (c *Cluster) getSecretsEncryptionConfig(ctx context.Context, clusterExists bool) (*encryptionConfig, error) {
+	var configStr string
+	var kubeErr error
+	if clusterExists && c.KubeClient != nil {
+		secret, err := k8s.GetSecret(c.KubeClient, SecretsEncryptionSecretName)
+		if err == nil {
+			configStr = string(secret.Data["Config"])
+		} else if !apierrors.IsNotFound(err) {
+			kubeErr = err
+		}
+	}
+	// the copy on the hosts is only read to enable the encryption, or to
+	// keep the keys in use when kubernetes can't tell
+	if len(configStr) == 0 && (c.Services.KubeAPI.SecretsEncryption.Enabled || kubeErr != nil) {
+		configStr = c.fetchBackupSecretsEncryptionConfig(ctx)
+	}
+	if len(configStr) == 0 {
+		if kubeErr != nil {
+			// generating new keys would leave the stored Secrets unreadable
+			return nil, fmt.Errorf("[%s] Failed to get the secrets encryption config from kubernetes: %v", SecretsEncryptionServiceName, kubeErr)
+		}
+		return nil, nil
+	}
+	config := &encryptionConfig{}
+	if err := yaml.Unmarshal([]byte(configStr), config); err != nil {
+		return nil, fmt.Errorf("[%s] Failed to parse the secrets encryption config: %v", SecretsEncryptionServiceName, err)
+	}
+	if len(config.Resources) == 0 {
+		return nil, fmt.Errorf("[%s] The secrets encryption config has no resources", SecretsEncryptionServiceName)
+	}
+	return config, nil
+}
+
+func (c *Cluster) fetchBackupSecretsEncryptionConfig(ctx context.Context) string {
+	for _, host := range c.ControlPlaneHosts {
+		config, err := pki.FetchFileFromHost(ctx, SecretsEncryptionConfigPath, c.SystemImages.Alpine, host, c.PrivateRegistriesMap, SecretsEncryptionConfigFetcher, SecretsEncryptionServiceName)
+		if rmErr := docker.DoRemoveContainer(ctx, host.DClient, SecretsEncryptionConfigFetcher, host.Address); rmErr != nil {
+			log.Warningf("[%s] Failed to remove container [%s] on host [%s]: %v", SecretsEncryptionServiceName, SecretsEncryptionConfigFetcher, host.Address, rmErr)
+		}
+		if err != nil {
+			log.Debugf("[%s] No secrets encryption config found on host [%s]: %v", SecretsEncryptionServiceName, host.Address, err)
+			continue
+		}
+		if len(strings.TrimSpace(config)) > 0 {
+			log.Infof("[%s] Found secrets encryption config on host [%s]", SecretsEncryptionServiceName, host.Address)
+			return config
+		}
+	}
+	return ""
+}
+
+// buildSecretsEncryptionConfig puts the provider of the cluster file first,
+// it encrypts the Secrets written from now on. The providers of current are
+// kept after it to decrypt the Secrets already stored.
+func (c *Cluster) buildSecretsEncryptionConfig(current *encryptionConfig) (*encryptionConfig, error) {
+	encryption := c.Services.KubeAPI.SecretsEncryption
+	oldProviders := []encryptionProviderConfig{}
+	if current != nil {
+		for _, provider := range current.Resources[0].Providers {
+			if provider.Identity == nil {
+				oldProviders = append(oldProviders, provider)
+			}
+		}
+	}
+	identity := encryptionProviderConfig{Identity: &struct{}{}}
+	if !encryption.Enabled {
+		if len(oldProviders) == 0 {
+			return nil, nil
+		}
+		log.Warningf("[%s] Secrets encryption is disabled, the Secrets written from now on are stored in plaintext", SecretsEncryptionServiceName)
+		return newEncryptionConfig(append([]encryptionProviderConfig{identity}, oldProviders...)), nil
+	}
+
+	kms := &encryptionKMSConfig{
+		Name:      encryption.KMS.Name,
+		Endpoint:  encryption.KMS.Endpoint,
+		CacheSize: encryption.KMS.CacheSize,
+		Timeout:   encryption.KMS.Timeout,
+	}
+	var primary *encryptionProviderConfig
+	providers := []encryptionProviderConfig{}
+	for i, provider := range oldProviders {
+		if primary == nil && provider.keys() != nil && provider.name() == encryption.Provider {
+			// the keys in use keep encrypting the Secrets
+			primary = &oldProviders[i]
+			continue
+		}
+		if provider.KMS != nil && provider.KMS.Name == kms.Name && provider.KMS.Endpoint == kms.Endpoint && encryption.Provider == KMSEncryptionProvider {
+			// replaced by the kms settings of the cluster file
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	if primary == nil {
+		switch encryption.Provider {
+		case KMSEncryptionProvider:
+			primary = &encryptionProviderConfig{KMS: kms}
+		default:
+			key, err := newEncryptionKey()
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("[%s] Generated %s encryption key [%s]", SecretsEncryptionServiceName, encryption.Provider, key.Name)
+			keys := &encryptionKeysConfig{Keys: []encryptionKey{key}}
+			if encryption.Provider == AESCBCEncryptionProvider {
+				primary = &encryptionProviderConfig{AESCBC: keys}
+			} else {
+				primary = &encryptionProviderConfig{Secretbox: keys}
+			}
+		}
+	}
+	providers = append([]encryptionProviderConfig{*primary}, providers...)
+	return newEncryptionConfig(append(providers, identity)), nil
+}
+
+func newEncryptionConfig(providers []encryptionProviderConfig) *encryptionConfig {
+	return &encryptionConfig{
+		Resources: []encryptionResourceConfig{
+			{
+				Resources: []string{"secrets"},
+				Providers: providers,
+			},
+		},
+	}
+}
+
+func newEncryptionKey() (encryptionKey, error) {
+	secret := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return encryptionKey{}, fmt.Errorf("Failed to generate secrets encryption key: %v", err)
+	}
+	return encryptionKey{
+		Name:   fmt.Sprintf("key-%s", time.Now().UTC().Format("20060102150405.000")),
+		Secret: base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
+
+func (c *Cluster) isEncryptionConfigGA() bool {
+	v, err := util.StrToSemVer(c.Version)
+	if err != nil {
+		return true
+	}
+	return v.Major > 1 || v.Minor >= EncryptionConfigGAMinorVersion
+}
+
+// getEncryptionProviderConfigArg returns the kube-apiserver flag reading the
+// encryption config.
+func (c *Cluster) getEncryptionProviderConfigArg() string {
+	if c.isEncryptionConfigGA() {
+		return "encryption-provider-config"
+	}
+	return "experimental-encryption-provider-config"
+}
+
+func (c *Cluster) setSecretsEncryptionConfig(config *encryptionConfig) error {
+	if config == nil {
+		c.SecretsEncryptionConfig = ""
+		return nil
+	}
+	if c.isEncryptionConfigGA() {
+		config.APIVersion = "apiserver.config.k8s.io/v1"
+		config.Kind = "EncryptionConfiguration"
+	} else {
+		config.APIVersion = "v1"
+		config.Kind = "EncryptionConfig"
+	}
+	buff, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal the secrets encryption config: %v", err)
+	}
+	c.SecretsEncryptionConfig = string(buff)
+	return nil
+}
+
+// getSecretsEncryptionChecksum is set in the kube-apiserver environment so
+// that a new encryption config restarts it.
+func getSecretsEncryptionChecksum(config string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(config)))
+}
+
+// getKMSSocketDir returns the directory of the kms plugin socket bind
+// mounted into kube-apiserver.
+func (c *Cluster) getKMSSocketDir() string {
+	encryption := c.Services.KubeAPI.SecretsEncryption
+	if !encryption.Enabled || encryption.Provider != KMSEncryptionProvider {
+		return ""
+	}
+	return path.Dir(strings.TrimPrefix(encryption.KMS.Endpoint, "unix://"))
+}
+
+func deploySecretsEncryptionConfig(ctx context.Context, controlHosts []*hosts.Host, alpineImage string, config string, prsMap map[string]types.PrivateRegistry) error {
+	for _, host := range controlHosts {
+		log.Infof("[%s] Deploying secrets encryption config file to node [%s]", SecretsEncryptionServiceName, host.Address)
+		if err := host.WriteHostFile(ctx, SecretsEncryptionConfigWriter, path.Join(host.PrefixPath, SecretsEncryptionConfigPath), config, alpineImage, prsMap); err != nil {
+			return fmt.Errorf("Failed to deploy secrets encryption config file on node [%s]: %v", host.Address, err)
+		}
+	}
+	return nil
+}
+
+func saveSecretsEncryptionConfig(ctx context.Context, c *Cluster) error {
+	log.Infof("[%s] Saving secrets encryption config as kubernetes secret [%s]", SecretsEncryptionServiceName, SecretsEncryptionSecretName)
+	secretData := map[string][]byte{
+		"Config": []byte(c.SecretsEncryptionConfig),
+	}
+	if err := k8s.UpdateSecret(c.KubeClient, secretData, SecretsEncryptionSecretName); err != nil {
+		return fmt.Errorf("[%s] Failed to save secrets encryption config: %v", SecretsEncryptionServiceName, err)
+	}
+	return nil
+}
+
+// rolloutSecretsEncryptionConfig deploys config to the control plane hosts
+// and restarts the kube-apiservers one by one.
+func (c *Cluster) rolloutSecretsEncryptionConfig(ctx context.Context, config *encryptionConfig) error {
+	if err := c.setSecretsEncryptionConfig(config); err != nil {
+		return err
+	}
+	if err := deploySecretsEncryptionConfig(ctx, c.ControlPlaneHosts, c.SystemImages.Alpine, c.SecretsEncryptionConfig, c.PrivateRegistriesMap); err != nil {
+		return err
+	}
+	// the config is saved first, it holds the keys of the Secrets written
+	// by the restarted kube-apiservers
+	if err := saveSecretsEncryptionConfig(ctx, c); err != nil {
+		return err
+	}
+	return c.DeployControlPlane(ctx)
+}
+
+// RotateSecretsEncryptionKey replaces the key encrypting the Secrets. The new
+// key is added and made the primary key in two steps, so that every
+// kube-apiserver can read what the others write. Secrets are then rewritten
+// with the new key and the old keys are dropped.
+func RotateSecretsEncryptionKey(ctx context.Context, c *Cluster) error {
+	encryption := c.Services.KubeAPI.SecretsEncryption
+	if !encryption.Enabled {
+		return fmt.Errorf("Secrets encryption is not enabled")
+	}
+	if encryption.Provider == KMSEncryptionProvider {
+		return fmt.Errorf("Keys of the %s provider are rotated by the KMS plugin", KMSEncryptionProvider)
+	}
+	if c.KubeClient == nil || len(c.SecretsEncryptionConfig) == 0 {
+		return fmt.Errorf("Secrets encryption config not found, the cluster has to be brought up first")
+	}
+	config := &encryptionConfig{}
+	if err := yaml.Unmarshal([]byte(c.SecretsEncryptionConfig), config); err != nil {
+		return fmt.Errorf("Failed to parse the secrets encryption config: %v", err)
+	}
+	primary := config.Resources[0].Providers[0]
+	if primary.name() != encryption.Provider {
+		return fmt.Errorf("Secrets are encrypted by the %s provider, run yke up first to switch to %s", primary.name(), encryption.Provider)
+	}
+	newKey, err := newEncryptionKey()
+	if err != nil {
+		return err
+	}
+	steps := getKeyRotationSteps(config, newKey)
+
+	log.Infof("[%s] Adding encryption key [%s]", SecretsEncryptionServiceName, newKey.Name)
+	if err := c.rolloutSecretsEncryptionConfig(ctx, steps[0]); err != nil {
+		return err
+	}
+
+	log.Infof("[%s] Making [%s] the primary encryption key", SecretsEncryptionServiceName, newKey.Name)
+	if err := c.rolloutSecretsEncryptionConfig(ctx, steps[1]); err != nil {
+		return err
+	}
+
+	log.Infof("[%s] Rewriting Secrets with encryption key [%s]", SecretsEncryptionServiceName, newKey.Name)
+	if err := k8s.RewriteSecrets(c.KubeClient); err != nil {
+		return fmt.Errorf("[%s] Failed to rewrite Secrets: %v", SecretsEncryptionServiceName, err)
+	}
+
+	log.Infof("[%s] Dropping the old encryption keys", SecretsEncryptionServiceName)
+	if err := c.rolloutSecretsEncryptionConfig(ctx, steps[2]); err != nil {
+		return err
+	}
+	log.Infof("[%s] Successfully rotated the secrets encryption key", SecretsEncryptionServiceName)
+	return nil
+}
+
+// getKeyRotationSteps returns the configs rolled out one after the other to
+// rotate to newKey: the key is added, made the primary key, and the old keys
+// and providers are dropped once the Secrets were rewritten.
+func getKeyRotationSteps(config *encryptionConfig, newKey encryptionKey) []*encryptionConfig {
+	providers := config.Resources[0].Providers
+	primary := providers[0]
+	oldKeys := primary.keys().Keys
+	withKeys := func(keys []encryptionKey, others []encryptionProviderConfig) *encryptionConfig {
+		keysConfig := &encryptionKeysConfig{Keys: keys}
+		provider := encryptionProviderConfig{Secretbox: keysConfig}
+		if primary.AESCBC != nil {
+			provider = encryptionProviderConfig{AESCBC: keysConfig}
+		}
+		return newEncryptionConfig(append([]encryptionProviderConfig{provider}, others...))
+	}
+	return []*encryptionConfig{
+		withKeys(append(append([]encryptionKey{}, oldKeys...), newKey), providers[1:]),
+		withKeys(append([]encryptionKey{newKey}, oldKeys...), providers[1:]),
+		withKeys([]encryptionKey{newKey}, []encryptionProviderConfig{{Identity: &struct{}{}}}),
+	}
+}
@@ -0,0 +1,224 @@
+package cluster
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yunion.io/x/yke/pkg/types"
+)
+
+func newTestKeysProvider(name string, keyNames ...string) encryptionProviderConfig {
+	keys := &encryptionKeysConfig{}
+	for _, keyName := range keyNames {
+		keys.Keys = append(keys.Keys, encryptionKey{Name: keyName, Secret: "c2VjcmV0"})
+	}
+	if name == AESCBCEncryptionProvider {
+		return encryptionProviderConfig{AESCBC: keys}
+	}
+	return encryptionProviderConfig{Secretbox: keys}
+}
+
+func newTestKMSProvider(name, timeout string) encryptionProviderConfig {
+	return encryptionProviderConfig{KMS: &encryptionKMSConfig{
+		Name:      name,
+		Endpoint:  "unix:///var/run/kms.sock",
+		CacheSize: DefaultKMSCacheSize,
+		Timeout:   timeout,
+	}}
+}
+
+var testIdentityProvider = encryptionProviderConfig{Identity: &struct{}{}}
+
+// describeEncryptionConfig lists the providers of config with their keys,
+// the generated keys are listed as "generated".
+func describeEncryptionConfig(t *testing.T, config *encryptionConfig) []string {
+	if config == nil {
+		return nil
+	}
+	if len(config.Resources) != 1 || !reflect.DeepEqual(config.Resources[0].Resources, []string{"secrets"}) {
+		t.Fatalf("encryption config resources are %+v, want secrets only", config.Resources)
+	}
+	ret := []string{}
+	for _, provider := range config.Resources[0].Providers {
+		switch {
+		case provider.KMS != nil:
+			ret = append(ret, fmt.Sprintf("kms:%s:%s", provider.KMS.Name, provider.KMS.Timeout))
+		case provider.keys() != nil:
+			names := []string{}
+			for _, key := range provider.keys().Keys {
+				name := key.Name
+				if strings.HasPrefix(name, "key-") {
+					secret, err := base64.StdEncoding.DecodeString(key.Secret)
+					if err != nil || len(secret) != encryptionKeySize {
+						t.Fatalf("generated key [%s] is not %d bytes of base64", name, encryptionKeySize)
+					}
+					name = "generated"
+				}
+				names = append(names, name)
+			}
+			ret = append(ret, fmt.Sprintf("%s:%s", provider.name(), strings.Join(names, ",")))
+		default:
+			ret = append(ret, provider.name())
+		}
+	}
+	return ret
+}
+
+func TestBuildSecretsEncryptionConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption types.SecretsEncryption
+		current    []encryptionProviderConfig
+		providers  []string
+		changed    bool
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:      "disabled after being enabled",
+			current:   []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key1"), testIdentityProvider},
+			providers: []string{"identity", "aescbc:key1"},
+			changed:   true,
+		},
+		{
+			name:       "enabled the first time",
+			encryption: types.SecretsEncryption{Enabled: true, Provider: AESCBCEncryptionProvider},
+			providers:  []string{"aescbc:generated", "identity"},
+			changed:    true,
+		},
+		{
+			name:       "keys in use are kept",
+			encryption: types.SecretsEncryption{Enabled: true, Provider: AESCBCEncryptionProvider},
+			current:    []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key2", "key1"), testIdentityProvider},
+			providers:  []string{"aescbc:key2,key1", "identity"},
+		},
+		{
+			name:       "enabled again",
+			encryption: types.SecretsEncryption{Enabled: true, Provider: AESCBCEncryptionProvider},
+			current:    []encryptionProviderConfig{testIdentityProvider, newTestKeysProvider(AESCBCEncryptionProvider, "key1")},
+			providers:  []string{"aescbc:key1", "identity"},
+			changed:    true,
+		},
+		{
+			name:       "switched to secretbox",
+			encryption: types.SecretsEncryption{Enabled: true, Provider: SecretboxEncryptionProvider},
+			current:    []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key1"), testIdentityProvider},
+			providers:  []string{"secretbox:generated", "aescbc:key1", "identity"},
+			changed:    true,
+		},
+		{
+			name:       "switched back to the secretbox keys",
+			encryption: types.SecretsEncryption{Enabled: true, Provider: SecretboxEncryptionProvider},
+			current:    []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key2"), newTestKeysProvider(SecretboxEncryptionProvider, "key1"), testIdentityProvider},
+			providers:  []string{"secretbox:key1", "aescbc:key2", "identity"},
+			changed:    true,
+		},
+		{
+			name: "switched to kms",
+			encryption: types.SecretsEncryption{
+				Enabled:  true,
+				Provider: KMSEncryptionProvider,
+				KMS:      types.KMSConfig{Name: "vault", Endpoint: "unix:///var/run/kms.sock", CacheSize: DefaultKMSCacheSize, Timeout: "5s"},
+			},
+			current:   []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key1"), testIdentityProvider},
+			providers: []string{"kms:vault:5s", "aescbc:key1", "identity"},
+			changed:   true,
+		},
+		{
+			name: "kms settings updated",
+			encryption: types.SecretsEncryption{
+				Enabled:  true,
+				Provider: KMSEncryptionProvider,
+				KMS:      types.KMSConfig{Name: "vault", Endpoint: "unix:///var/run/kms.sock", CacheSize: DefaultKMSCacheSize, Timeout: "5s"},
+			},
+			current:   []encryptionProviderConfig{newTestKMSProvider("vault", "3s"), newTestKeysProvider(AESCBCEncryptionProvider, "key1"), testIdentityProvider},
+			providers: []string{"kms:vault:5s", "aescbc:key1", "identity"},
+		},
+		{
+			name: "other kms plugin",
+			encryption: types.SecretsEncryption{
+				Enabled:  true,
+				Provider: KMSEncryptionProvider,
+				KMS:      types.KMSConfig{Name: "vault2", Endpoint: "unix:///var/run/kms2.sock", CacheSize: DefaultKMSCacheSize, Timeout: "3s"},
+			},
+			current:   []encryptionProviderConfig{newTestKMSProvider("vault", "3s"), testIdentityProvider},
+			providers: []string{"kms:vault2:3s", "kms:vault:3s", "identity"},
+			changed:   true,
+		},
+	}
+	for _, test := range tests {
+		c := &Cluster{}
+		c.Services.KubeAPI.SecretsEncryption = test.encryption
+		var current *encryptionConfig
+		if len(test.current) > 0 {
+			current = newEncryptionConfig(test.current)
+		}
+		config, err := c.buildSecretsEncryptionConfig(current)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if providers := describeEncryptionConfig(t, config); !reflect.DeepEqual(providers, test.providers) {
+			t.Errorf("%s: got providers %q, want %q", test.name, providers, test.providers)
+		}
+		if changed := getPrimaryEncryptionProvider(current) != getPrimaryEncryptionProvider(config); changed != test.changed {
+			t.Errorf("%s: primary provider changed = %v, want %v", test.name, changed, test.changed)
+		}
+	}
+}
+
+func TestGetKeyRotationSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []encryptionProviderConfig
+		steps   [][]string
+	}{
+		{
+			name:    "aescbc",
+			current: []encryptionProviderConfig{newTestKeysProvider(AESCBCEncryptionProvider, "key1"), testIdentityProvider},
+			steps: [][]string{
+				{"aescbc:key1,new", "identity"},
+				{"aescbc:new,key1", "identity"},
+				{"aescbc:new", "identity"},
+			},
+		},
+		{
+			name: "secretbox with old keys and providers",
+			current: []encryptionProviderConfig{
+				newTestKeysProvider(SecretboxEncryptionProvider, "key2", "key1"),
+				newTestKeysProvider(AESCBCEncryptionProvider, "key0"),
+				testIdentityProvider,
+			},
+			steps: [][]string{
+				{"secretbox:key2,key1,new", "aescbc:key0", "identity"},
+				{"secretbox:new,key2,key1", "aescbc:key0", "identity"},
+				{"secretbox:new", "identity"},
+			},
+		},
+	}
+	for _, test := range tests {
+		current := newEncryptionConfig(test.current)
+		before := describeEncryptionConfig(t, current)
+		steps := getKeyRotationSteps(current, encryptionKey{Name: "new", Secret: "c2VjcmV0"})
+		if len(steps) != len(test.steps) {
+			t.Fatalf("%s: got %d steps, want %d", test.name, len(steps), len(test.steps))
+		}
+		for i, step := range steps {
+			if providers := describeEncryptionConfig(t, step); !reflect.DeepEqual(providers, test.steps[i]) {
+				t.Errorf("%s: step %d providers are %q, want %q", test.name, i, providers, test.steps[i])
+			}
+		}
+		// the steps are rolled out one after the other, none of them may
+		// change another one or the config in use
+		steps[0].Resources[0].Providers[0].keys().Keys[0].Name = "changed"
+		if providers := describeEncryptionConfig(t, steps[1]); !reflect.DeepEqual(providers, test.steps[1]) {
+			t.Errorf("%s: step 1 changed with step 0 to %q", test.name, providers)
+		}
+		if after := describeEncryptionConfig(t, current); !reflect.DeepEqual(after, before) {
+			t.Errorf("%s: the config in use changed from %q to %q", test.name, before, after)
+		}
+	}
+}
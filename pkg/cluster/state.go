@@ -2,9 +2,13 @@ package cluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -27,6 +31,8 @@ const (
 type YKEFullState struct {
 	DesiredState YKEState `json:"desiredState,omitempty"`
 	CurrentState YKEState `json:"currentState,omitempty"`
+	// SSH host keys trusted on first use indexed by ssh address
+	SSHHostKeys map[string]string `json:"sshHostKeys,omitempty"`
 }
 
 type YKEState struct {
@@ -46,6 +52,11 @@ func (c *Cluster) SaveClusterState(ctx context.Context, config *types.Kubernetes
 		if err != nil {
 			return fmt.Errorf("[certificates] Failed to Save Kubernetes certificates: %v", err)
 		}
+		if len(c.SecretsEncryptionConfig) > 0 {
+			if err := saveSecretsEncryptionConfig(ctx, c); err != nil {
+				return err
+			}
+		}
 		err = saveStateToKubernetes(ctx, c.KubeClient, c.LocalKubeConfigPath, config)
 		if err != nil {
 			return fmt.Errorf("[state] Failed to save configuration state: %v", err)
@@ -89,6 +100,8 @@ func (c *Cluster) GetClusterState(ctx context.Context) (*Cluster, error) {
 		}
 		// Get previous kubernetes certificates
 		if currentCluster != nil {
+			currentCluster.HostKeyVerifier = c.HostKeyVerifier
+			currentCluster.FallbackSSHKeyPassphrase = c.FallbackSSHKeyPassphrase
 			if err := currentCluster.InvertIndexHosts(); err != nil {
 				return nil, fmt.Errorf("Failed to classify hosts from fetched cluster: %v", err)
 			}
@@ -96,7 +109,7 @@ func (c *Cluster) GetClusterState(ctx context.Context) (*Cluster, error) {
 			for _, inactiveHost := range c.InactiveHosts {
 				activeEtcdHosts = removeFromHosts(inactiveHost, activeEtcdHosts)
 			}
-			currentCluster.Certificates, err = getClusterCerts(ctx, c.KubeClient, activeEtcdHosts)
+			currentCluster.Certificates, err = getClusterCerts(ctx, c.KubeClient, activeEtcdHosts, currentCluster.getKubeletHosts())
 			// if getting certificates from k8s failed then we attempt to fetch the backup certs
 			if err != nil {
 				backupHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, nil)
@@ -240,6 +253,73 @@ func getStateFromNodes(ctx context.Context, uniqueHosts []*hosts.Host, alpineIma
 	return &currentCluster
 }
 
+func GetStateFilePath(configPath, configDir string) string {
+	baseDir := filepath.Dir(configPath)
+	if len(configDir) > 0 {
+		baseDir = filepath.Dir(configDir)
+	}
+	fileName := filepath.Base(configPath)
+	fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + stateFileExt
+	return filepath.Join(baseDir, fileName)
+}
+
+// ReadStateFile returns an empty state if the state file doesn't exist yet.
+func ReadStateFile(ctx context.Context, statePath string) (*YKEFullState, error) {
+	ykeFullState := &YKEFullState{}
+	buf, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ykeFullState, nil
+		}
+		return nil, fmt.Errorf("Failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(buf, ykeFullState); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal the state file [%s]: %v", statePath, err)
+	}
+	return ykeFullState, nil
+}
+
+func (s *YKEFullState) WriteStateFile(ctx context.Context, statePath string) error {
+	stateFile, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal state object: %v", err)
+	}
+	if err := ioutil.WriteFile(statePath, stateFile, 0640); err != nil {
+		return fmt.Errorf("Failed to write state file: %v", err)
+	}
+	log.Infof("[state] Successfully wrote state file [%s]", statePath)
+	return nil
+}
+
+func (c *Cluster) setHostKeyVerifier(ctx context.Context) error {
+	ykeFullState, err := ReadStateFile(ctx, c.StateFilePath)
+	if err != nil {
+		return err
+	}
+	c.HostKeyVerifier, err = hosts.NewHostKeyVerifier(c.SSHKnownHostsPath, c.SSHTrustOnFirstUse, ykeFullState.SSHHostKeys)
+	if err != nil {
+		return fmt.Errorf("Failed to initialize SSH host key verification: %v", err)
+	}
+	return nil
+}
+
+// saveTrustedHostKeys records the host keys trusted on first use in the state
+// file, so that they are verified on the next runs.
+func (c *Cluster) saveTrustedHostKeys(ctx context.Context) error {
+	if c.HostKeyVerifier == nil || !c.HostKeyVerifier.Changed() {
+		return nil
+	}
+	ykeFullState, err := ReadStateFile(ctx, c.StateFilePath)
+	if err != nil {
+		return err
+	}
+	ykeFullState.SSHHostKeys = c.HostKeyVerifier.TrustedKeys()
+	if err := ykeFullState.WriteStateFile(ctx, c.StateFilePath); err != nil {
+		return fmt.Errorf("[state] Failed to save trusted SSH host keys: %v", err)
+	}
+	return nil
+}
+
 func GetK8sVersion(localConfigPath string, k8sWrapTransport k8s.WrapTransport) (string, error) {
 	log.Debugf("[version] Using %s to connect to Kubernetes cluster..", localConfigPath)
 	k8sClient, err := k8s.NewClient(localConfigPath, k8sWrapTransport)
@@ -0,0 +1,272 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/cert"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/yke/pkg/docker"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
+	"yunion.io/x/yke/pkg/pki"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/util"
+)
+
+const (
+	ContainerStateRunning = "running"
+	ContainerStateStopped = "stopped"
+	ContainerStateMissing = "missing"
+	ContainerStateUnknown = "unknown"
+
+	NodeReadyTrue     = "True"
+	NodeReadyFalse    = "False"
+	NodeReadyNotFound = "NotFound"
+	NodeReadyUnknown  = "Unknown"
+)
+
+type ClusterStatus struct {
+	Nodes  []NodeStatus  `json:"nodes"`
+	Addons []AddonStatus `json:"addons"`
+}
+
+type NodeStatus struct {
+	Address         string            `json:"address"`
+	Hostname        string            `json:"hostname"`
+	Roles           []string          `json:"roles"`
+	DockerReachable bool              `json:"dockerReachable"`
+	Ready           string            `json:"ready"`
+	EtcdHealthy     *bool             `json:"etcdHealthy,omitempty"`
+	Containers      []ContainerStatus `json:"containers"`
+}
+
+type ContainerStatus struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Healthy *bool  `json:"healthy,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type AddonStatus struct {
+	Name      string `json:"name"`
+	Job       string `json:"job"`
+	Completed bool   `json:"completed"`
+}
+
+// IsHealthy reports whether every node, container and addon job is healthy.
+func (s *ClusterStatus) IsHealthy() bool {
+	for _, node := range s.Nodes {
+		if !node.DockerReachable || node.Ready != NodeReadyTrue {
+			return false
+		}
+		if node.EtcdHealthy != nil && !*node.EtcdHealthy {
+			return false
+		}
+		for _, container := range node.Containers {
+			if container.State != ContainerStateRunning {
+				return false
+			}
+			if container.Healthy != nil && !*container.Healthy {
+				return false
+			}
+		}
+	}
+	for _, addon := range s.Addons {
+		if !addon.Completed {
+			return false
+		}
+	}
+	return true
+}
+
+// GetClusterStatus checks every host of the cluster, including the ones that
+// could not be tunneled, and the addon jobs deployed to kubernetes. The
+// cluster certificates have to be loaded for the healthz checks.
+func (c *Cluster) GetClusterStatus(ctx context.Context) (*ClusterStatus, error) {
+	nodesReady := map[string]string{}
+	kubeClient, err := k8s.NewClient(c.LocalKubeConfigPath, c.K8sWrapTransport)
+	if err != nil {
+		log.Warningf("Failed to initialize new kubernetes client: %v", err)
+		kubeClient = nil
+	} else {
+		nodeList, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+		if err != nil {
+			log.Warningf("Failed to list kubernetes nodes: %v", err)
+			kubeClient = nil
+		} else {
+			for _, node := range nodeList.Items {
+				ready := NodeReadyFalse
+				if k8s.IsNodeReady(node) {
+					ready = NodeReadyTrue
+				}
+				nodesReady[strings.ToLower(node.Labels[k8s.HostnameLabel])] = ready
+			}
+		}
+	}
+
+	status := &ClusterStatus{}
+	activeHosts := hosts.GetUniqueHostList(c.EtcdHosts, c.ControlPlaneHosts, c.WorkerHosts)
+	nodeStatusCh := make(chan NodeStatus, len(activeHosts)+len(c.InactiveHosts))
+	var errgrp errgroup.Group
+	hostsQueue := util.GetObjectQueue(activeHosts)
+	for w := 0; w < WorkerThreads; w++ {
+		errgrp.Go(func() error {
+			for host := range hostsQueue {
+				nodeStatusCh <- c.getNodeStatus(ctx, host.(*hosts.Host))
+			}
+			return nil
+		})
+	}
+	if err := errgrp.Wait(); err != nil {
+		return nil, err
+	}
+	for _, host := range c.InactiveHosts {
+		nodeStatusCh <- NodeStatus{
+			Address:    host.Address,
+			Hostname:   host.HostnameOverride,
+			Roles:      host.Role,
+			Containers: []ContainerStatus{},
+		}
+	}
+	close(nodeStatusCh)
+	for nodeStatus := range nodeStatusCh {
+		nodeStatus.Ready = NodeReadyUnknown
+		if kubeClient != nil {
+			ready, ok := nodesReady[strings.ToLower(nodeStatus.Hostname)]
+			if !ok {
+				ready = NodeReadyNotFound
+			}
+			nodeStatus.Ready = ready
+		}
+		status.Nodes = append(status.Nodes, nodeStatus)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Address < status.Nodes[j].Address
+	})
+
+	status.Addons = []AddonStatus{}
+	if kubeClient != nil {
+		for _, name := range getAddonResourceNames() {
+			jobName := fmt.Sprintf("%s-deploy-job", name)
+			jobStatus, err := k8s.GetK8sJobStatus(kubeClient, jobName, metav1.NamespaceSystem)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get job [%s] status: %v", jobName, err)
+			}
+			if !jobStatus.Created {
+				continue
+			}
+			status.Addons = append(status.Addons, AddonStatus{
+				Name:      name,
+				Job:       jobName,
+				Completed: jobStatus.Completed,
+			})
+		}
+	}
+	return status, nil
+}
+
+func (c *Cluster) getNodeStatus(ctx context.Context, host *hosts.Host) NodeStatus {
+	nodeStatus := NodeStatus{
+		Address:    host.Address,
+		Hostname:   host.HostnameOverride,
+		Roles:      host.Role,
+		Containers: []ContainerStatus{},
+	}
+	if host.DClient == nil {
+		log.Warningf("Failed to reach docker on host [%s]: no docker client", host.Address)
+		return nodeStatus
+	}
+	if _, err := host.DClient.Ping(ctx); err != nil {
+		log.Warningf("Failed to reach docker on host [%s]: %v", host.Address, err)
+		return nodeStatus
+	}
+	nodeStatus.DockerReachable = true
+
+	nodePlan := BuildKEConfigNodePlan(ctx, c, host, host.DockerInfo)
+	for _, name := range c.getHostContainerNames(host) {
+		containerStatus := ContainerStatus{
+			Name:  name,
+			State: ContainerStateUnknown,
+		}
+		running, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, name, false)
+		if err != nil {
+			containerStatus.Error = err.Error()
+			nodeStatus.Containers = append(nodeStatus.Containers, containerStatus)
+			continue
+		}
+		if !running {
+			containerStatus.State = ContainerStateMissing
+			if exists, err := docker.IsContainerRunning(ctx, host.DClient, host.Address, name, true); err == nil && exists {
+				containerStatus.State = ContainerStateStopped
+			}
+			nodeStatus.Containers = append(nodeStatus.Containers, containerStatus)
+			continue
+		}
+		containerStatus.State = ContainerStateRunning
+		_, _, healthCheckURL := services.GetProcessConfig(nodePlan.Processes[name])
+		if len(healthCheckURL) > 0 {
+			healthy := true
+			if name == services.EtcdContainerName {
+				clientCert := cert.EncodeCertPEM(c.Certificates[pki.KubeNodeCertName].Certificate)
+				clientKey := cert.EncodePrivateKeyPEM(c.Certificates[pki.KubeNodeCertName].Key)
+				healthy = services.IsEtcdHealthy(ctx, c.LocalConnDialerFactory, host, clientCert, clientKey, healthCheckURL)
+				nodeStatus.EtcdHealthy = &healthy
+			} else if err := services.CheckServiceHealth(ctx, host, name, c.LocalConnDialerFactory, healthCheckURL, c.Certificates); err != nil {
+				healthy = false
+				containerStatus.Error = err.Error()
+			}
+			containerStatus.Healthy = &healthy
+		}
+		nodeStatus.Containers = append(nodeStatus.Containers, containerStatus)
+	}
+	return nodeStatus
+}
+
+func (c *Cluster) getHostContainerNames(host *hosts.Host) []string {
+	names := []string{}
+	if host.IsEtcd {
+		names = append(names, services.EtcdContainerName)
+	}
+	if host.IsControl {
+		names = append(names,
+			services.KubeAPIContainerName,
+			services.KubeControllerContainerName,
+			services.SchedulerContainerName)
+		if c.isControlPlaneVIP() {
+			names = append(names,
+				services.HAProxyContainerName,
+				services.KeepalivedContainerName)
+		}
+	} else if len(c.ControlPlaneEndpoint.Address) == 0 {
+		names = append(names, services.NginxProxyContainerName)
+	}
+	// the sidekick container only provides volumes and never keeps running
+	return append(names,
+		services.KubeletContainerName,
+		services.KubeproxyContainerName)
+}
+
+func getAddonResourceNames() []string {
+	names := []string{NetworkPluginResourceName}
+	for _, provider := range DNSProviders {
+		names = append(names, getAddonResourceName(provider))
+	}
+	return append(names,
+		MetricsServerAddonResourceName,
+		IngressAddonResourceName,
+		TillerAddonResourceName,
+		HeapsterAddonResourceName,
+		YunionCSIAddonResourceName,
+		YunionCloudMonResourceName,
+		YunionCloudProviderResourceName,
+		OnecloudClusterapiResourceName,
+		UserAddonResourceName,
+		UserAddonsIncludeResourceName)
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
+)
+
+var (
+	controlPlaneUpgradeContainers = []string{
+		services.KubeAPIContainerName,
+		services.KubeControllerContainerName,
+		services.SchedulerContainerName,
+	}
+	workerPlaneUpgradeContainers = []string{
+		services.KubeletContainerName,
+		services.KubeproxyContainerName,
+	}
+)
+
+// getMaxUnavailable resolves upgrade_strategy.max_unavailable, either a number
+// or a percentage of the worker hosts, to a batch size of at least one host.
+func getMaxUnavailable(maxUnavailable string, total int) (int, error) {
+	value := strings.TrimSpace(maxUnavailable)
+	isPercent := strings.HasSuffix(value, "%")
+	n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid upgrade strategy max_unavailable [%s], must be a positive number or percentage", maxUnavailable)
+	}
+	if isPercent {
+		if n > 100 {
+			return 0, fmt.Errorf("Invalid upgrade strategy max_unavailable [%s], percentage can't be greater than 100%%", maxUnavailable)
+		}
+		n = total * n / 100
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n, nil
+}
+
+// splitUpgradeHosts returns the hosts already running one of the given
+// containers with an outdated configuration, and the remaining hosts.
+func splitUpgradeHosts(ctx context.Context, hostList []*hosts.Host, nodePlanMap map[string]types.ConfigNodePlan, containerNames ...string) ([]*hosts.Host, []*hosts.Host, error) {
+	upgradeHosts := []*hosts.Host{}
+	otherHosts := []*hosts.Host{}
+	for _, host := range hostList {
+		upgrade := false
+		for _, name := range containerNames {
+			process, ok := nodePlanMap[host.Address].Processes[name]
+			if !ok {
+				continue
+			}
+			action, err := getProcessAction(ctx, host, name, process)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Failed to check container [%s] on host [%s]: %v", name, host.Address, err)
+			}
+			if action == ProcessActionRecreate {
+				upgrade = true
+				break
+			}
+		}
+		if upgrade {
+			upgradeHosts = append(upgradeHosts, host)
+		} else {
+			otherHosts = append(otherHosts, host)
+		}
+	}
+	return upgradeHosts, otherHosts, nil
+}
@@ -1,86 +1,195 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/docker/distribution/reference"
+	"gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/util/validation"
+
+	"yunion.io/x/yke/pkg/pki"
 	"yunion.io/x/yke/pkg/services"
+	"yunion.io/x/yke/pkg/types"
 )
 
 func (c *Cluster) ValidateCluster() error {
+	if errs := c.getValidationErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// getValidationErrors runs every cluster validation and returns all the
+// problems found instead of stopping at the first one.
+func (c *Cluster) getValidationErrors() []error {
+	errs := []error{}
 	// make sure cluster has at least one controlplane/etcd host
 	if err := ValidateHostCount(c); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	// validate duplicate nodes
-	if err := validateDuplicateNodes(c); err != nil {
-		return err
-	}
+	errs = append(errs, validateDuplicateNodes(c)...)
 
 	// validate hosts options
-	if err := validateHostsOptions(c); err != nil {
-		return err
-	}
+	errs = append(errs, validateHostsOptions(c)...)
 
 	// validate Auth options
 	if err := validateAuthOptions(c); err != nil {
-		return err
+		errs = append(errs, err)
+	}
+	if err := validateAuthzOptions(c); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateKubeletClientCertMode(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	// validate certificates options
+	if len(c.CertificatesConfig.AutoRenewBefore) > 0 {
+		if _, err := parseCertRenewBefore(c.CertificatesConfig.AutoRenewBefore); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// validate upgrade strategy
+	if _, err := getMaxUnavailable(c.UpgradeStrategy.MaxUnavailable, 1); err != nil {
+		errs = append(errs, err)
 	}
 
 	// validate Network options
 	if err := validateNetworkOptions(c); err != nil {
-		return err
+		errs = append(errs, err)
+	}
+	errs = append(errs, validateNetworkRanges(c)...)
+
+	// validate the control plane endpoint
+	if err := validateControlPlaneEndpoint(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	// validate the kube-api audit log
+	if err := validateAuditLog(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	// validate the encryption of Secrets
+	if err := validateSecretsEncryption(c); err != nil {
+		errs = append(errs, err)
 	}
 
 	// validate Ingress options
 	if err := validateIngressOptions(c); err != nil {
-		return err
+		errs = append(errs, err)
 	}
 
 	// validate services options
-	return validateServicesOptions(c)
+	errs = append(errs, validateServicesOptions(c)...)
+
+	// validate image references
+	return append(errs, validateImages(c)...)
 }
 
-func validateAuthOptions(c *Cluster) error {
-	if c.Authentication.Strategy != DefaultAuthStrategy {
-		return fmt.Errorf("Authentication strategy [%s] is not supported", c.Authentication.Strategy)
+// ValidateClusterFile validates a cluster file without connecting to any
+// host. Unknown keys are reported along with every semantic problem found
+// once the defaults are applied.
+func ValidateClusterFile(ctx context.Context, clusterFile string) []error {
+	errs := []error{}
+	var strictConfig types.KubernetesEngineConfig
+	if err := yaml.UnmarshalStrict([]byte(clusterFile), &strictConfig); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return append(errs, err)
+		}
+		for _, e := range typeErr.Errors {
+			errs = append(errs, fmt.Errorf("%s", e))
+		}
 	}
-	return nil
+	config, err := ParseConfig(clusterFile)
+	if err != nil {
+		return append(errs, err)
+	}
+	c := &Cluster{
+		KubernetesEngineConfig: *config,
+		PrivateRegistriesMap:   make(map[string]types.PrivateRegistry),
+	}
+	c.setClusterDefaults(ctx)
+	// unknown roles are reported by the hosts options validation
+	c.InvertIndexHosts()
+	if err := c.parseWebhookConfig(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to parse webhook config: %v", err))
+	}
+	if err := c.parseAuthzWebhookConfig(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to parse authorization webhook config: %v", err))
+	}
+	if err := c.parseSchedulerConfig(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to parse scheduler config: %v", err))
+	}
+	if err := c.parseAuditPolicy(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("Failed to parse audit policy: %v", err))
+	}
+	return append(errs, c.getValidationErrors()...)
 }
 
 func validateNetworkOptions(c *Cluster) error {
-	if c.Network.Plugin != YunionNetworkPlugin {
-		return fmt.Errorf("Network plugin [%s] is not supported", c.Network.Plugin)
+	plugin, err := GetNetworkPlugin(c.Network.Plugin)
+	if err != nil {
+		return err
 	}
-	return nil
+	return plugin.ValidateOptions(c)
 }
 
-func validateHostsOptions(c *Cluster) error {
+func validateHostsOptions(c *Cluster) []error {
+	errs := []error{}
 	for i, host := range c.Nodes {
 		if len(host.Address) == 0 {
-			return fmt.Errorf("Address for host (%d) is not provided", i+1)
+			errs = append(errs, fmt.Errorf("Address for host (%d) is not provided", i+1))
 		}
 		if len(host.User) == 0 {
-			return fmt.Errorf("User for host (%d) is not provided", i+1)
+			errs = append(errs, fmt.Errorf("User for host (%d) is not provided", i+1))
 		}
 		if len(host.Role) == 0 {
-			return fmt.Errorf("Role for host (%d) is not provided", i+1)
+			errs = append(errs, fmt.Errorf("Role for host (%d) is not provided", i+1))
 		}
-		if errs := validation.IsDNS1123Subdomain(host.HostnameOverride); len(errs) > 0 {
-			return fmt.Errorf("Hostname_override [%s] for host (%d) is not valid: %v", host.HostnameOverride, i+1, errs)
+		if verrs := validation.IsDNS1123Subdomain(host.HostnameOverride); len(verrs) > 0 {
+			errs = append(errs, fmt.Errorf("Hostname_override [%s] for host (%d) is not valid: %v", host.HostnameOverride, i+1, verrs))
 		}
 		for _, role := range host.Role {
 			if role != services.ETCDRole && role != services.ControlRole && role != services.WorkerRole {
-				return fmt.Errorf("Role [%s] for host (%d) is not recognized", role, i+1)
+				errs = append(errs, fmt.Errorf("Role [%s] for host (%d) is not recognized", role, i+1))
 			}
 		}
+		if len(host.SSHHostKey) > 0 && !strings.HasPrefix(host.SSHHostKey, SSHHostKeyFingerprintPrefix) {
+			errs = append(errs, fmt.Errorf("SSH host key [%s] for host (%d) is not a %s fingerprint", host.SSHHostKey, i+1, SSHHostKeyFingerprintPrefix))
+		}
+		errs = append(errs, validateBastionHosts(host.BastionHost, fmt.Sprintf("host (%d)", i+1))...)
 	}
-	return nil
+	return append(errs, validateBastionHosts(c.BastionHost, "cluster")...)
+}
+
+func validateBastionHosts(bastionHosts types.BastionHosts, owner string) []error {
+	errs := []error{}
+	for i, bastionHost := range bastionHosts {
+		if len(bastionHost.Address) == 0 {
+			errs = append(errs, fmt.Errorf("Address for bastion host (%d) of %s is not provided", i+1, owner))
+		}
+		if len(bastionHost.User) == 0 {
+			errs = append(errs, fmt.Errorf("User for bastion host (%d) of %s is not provided", i+1, owner))
+		}
+		if len(bastionHost.SSHHostKey) > 0 && !strings.HasPrefix(bastionHost.SSHHostKey, SSHHostKeyFingerprintPrefix) {
+			errs = append(errs, fmt.Errorf("SSH host key [%s] for bastion host (%d) of %s is not a %s fingerprint", bastionHost.SSHHostKey, i+1, owner, SSHHostKeyFingerprintPrefix))
+		}
+	}
+	return errs
 }
 
-func validateServicesOptions(c *Cluster) error {
+func validateServicesOptions(c *Cluster) []error {
+	errs := []error{}
 	servicesOptions := map[string]string{
 		"etcd_image":                               c.Services.Etcd.Image,
 		"kube_api_image":                           c.Services.KubeAPI.Image,
@@ -95,33 +204,47 @@ func validateServicesOptions(c *Cluster) error {
 		"kubelet_infra_container_image":            c.Services.Kubelet.InfraContainerImage,
 		"kubeproxy_image":                          c.Services.Kubeproxy.Image,
 	}
-	for optionName, OptionValue := range servicesOptions {
-		if len(OptionValue) == 0 {
-			return fmt.Errorf("%s can't be empty", strings.Join(strings.Split(optionName, "_"), " "))
+	optionNames := []string{}
+	for optionName := range servicesOptions {
+		optionNames = append(optionNames, optionName)
+	}
+	sort.Strings(optionNames)
+	for _, optionName := range optionNames {
+		if len(servicesOptions[optionName]) == 0 {
+			errs = append(errs, fmt.Errorf("%s can't be empty", strings.Join(strings.Split(optionName, "_"), " ")))
 		}
 	}
 	// Validate external etcd information
 	if len(c.Services.Etcd.ExternalURLs) > 0 {
 		if len(c.Services.Etcd.CACert) == 0 {
-			return fmt.Errorf("External CA Certificate for etcd can't be empty")
+			errs = append(errs, fmt.Errorf("External CA Certificate for etcd can't be empty"))
 		}
 		if len(c.Services.Etcd.Cert) == 0 {
-			return fmt.Errorf("External Client Certificate for etcd can't be empty")
+			errs = append(errs, fmt.Errorf("External Client Certificate for etcd can't be empty"))
 		}
 		if len(c.Services.Etcd.Key) == 0 {
-			return fmt.Errorf("External Client Key for etcd can't be empty")
+			errs = append(errs, fmt.Errorf("External Client Key for etcd can't be empty"))
 		}
 		if len(c.Services.Etcd.Path) == 0 {
-			return fmt.Errorf("External etcd path can't be empty")
+			errs = append(errs, fmt.Errorf("External etcd path can't be empty"))
+		}
+	}
+	// Validate etcd snapshot S3 backup config
+	if s3Config := c.Services.Etcd.S3BackupConfig; s3Config != nil {
+		if len(s3Config.Endpoint) == 0 {
+			errs = append(errs, fmt.Errorf("Etcd S3 backup endpoint can't be empty"))
+		}
+		if len(s3Config.BucketName) == 0 {
+			errs = append(errs, fmt.Errorf("Etcd S3 backup bucket name can't be empty"))
 		}
 	}
 	// Validate kube apiserver webhook config
 	if c.Services.KubeAPI.ExtraArgs["authentication-token-webhook-config-file"] != "" {
 		if c.WebhookConfig == "" {
-			return fmt.Errorf("Webhook config can't be empty")
+			errs = append(errs, fmt.Errorf("Webhook config can't be empty"))
 		}
 	}
-	return nil
+	return errs
 }
 
 func validateIngressOptions(c *Cluster) error {
@@ -149,19 +272,86 @@ func ValidateHostCount(c *Cluster) error {
 	return nil
 }
 
-func validateDuplicateNodes(c *Cluster) error {
+func validateDuplicateNodes(c *Cluster) []error {
+	errs := []error{}
 	for i := range c.Nodes {
-		for j := range c.Nodes {
-			if i == j {
-				continue
-			}
+		for j := i + 1; j < len(c.Nodes); j++ {
 			if c.Nodes[i].Address == c.Nodes[j].Address {
-				return fmt.Errorf("Cluster can't have duplicate node: %s", c.Nodes[i].Address)
+				errs = append(errs, fmt.Errorf("Cluster can't have duplicate node: %s", c.Nodes[i].Address))
+				continue
 			}
 			if c.Nodes[i].HostnameOverride == c.Nodes[j].HostnameOverride {
-				return fmt.Errorf("Cluster can't have duplicate node: %s", c.Nodes[i].HostnameOverride)
+				errs = append(errs, fmt.Errorf("Cluster can't have duplicate node: %s", c.Nodes[i].HostnameOverride))
+				continue
+			}
+			// the certificate names replace the dots of the node names
+			if crtName := pki.GetKubeletCrtName(pki.GetNodeName(c.Nodes[i])); crtName == pki.GetKubeletCrtName(pki.GetNodeName(c.Nodes[j])) {
+				errs = append(errs, fmt.Errorf("Hostname_override [%s] and [%s] both map to the certificate name [%s], use node names which don't only differ by dots and dashes", c.Nodes[i].HostnameOverride, c.Nodes[j].HostnameOverride, crtName))
 			}
 		}
 	}
-	return nil
+	return errs
+}
+
+func validateNetworkRanges(c *Cluster) []error {
+	errs := []error{}
+	if err := c.validateSingleStackRange("Cluster CIDR", c.Services.KubeController.ClusterCIDR); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateSingleStackRange("Service cluster IP range", c.Services.KubeAPI.ServiceClusterIPRange); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	_, clusterCIDR, err := net.ParseCIDR(c.Services.KubeController.ClusterCIDR)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Cluster CIDR [%s] is not valid: %v", c.Services.KubeController.ClusterCIDR, err))
+	}
+	_, serviceRange, err := net.ParseCIDR(c.Services.KubeAPI.ServiceClusterIPRange)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Service cluster IP range [%s] is not valid: %v", c.Services.KubeAPI.ServiceClusterIPRange, err))
+	}
+	if c.Services.KubeController.ServiceClusterIPRange != c.Services.KubeAPI.ServiceClusterIPRange {
+		errs = append(errs, fmt.Errorf("Kube controller service cluster IP range [%s] doesn't match kube api service cluster IP range [%s]",
+			c.Services.KubeController.ServiceClusterIPRange, c.Services.KubeAPI.ServiceClusterIPRange))
+	}
+	if clusterCIDR != nil && serviceRange != nil {
+		if clusterCIDR.Contains(serviceRange.IP) || serviceRange.Contains(clusterCIDR.IP) {
+			errs = append(errs, fmt.Errorf("Cluster CIDR [%s] overlaps with service cluster IP range [%s]", clusterCIDR, serviceRange))
+		}
+		errs = append(errs, validateIPv6Ranges(clusterCIDR, serviceRange)...)
+	}
+	dnsServer := net.ParseIP(c.Services.Kubelet.ClusterDNSServer)
+	if dnsServer == nil {
+		errs = append(errs, fmt.Errorf("Cluster DNS server [%s] is not a valid IP address", c.Services.Kubelet.ClusterDNSServer))
+	} else if serviceRange != nil && !serviceRange.Contains(dnsServer) {
+		errs = append(errs, fmt.Errorf("Cluster DNS server [%s] is not in service cluster IP range [%s]", dnsServer, serviceRange))
+	}
+	return errs
+}
+
+func validateImages(c *Cluster) []error {
+	errs := []error{}
+	images := map[string]string{}
+	v := reflect.ValueOf(c.SystemImages)
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		images["system_images "+name] = v.Field(i).String()
+	}
+	names := []string{}
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		image := images[name]
+		if len(image) == 0 {
+			continue
+		}
+		if _, err := reference.ParseNormalizedNamed(image); err != nil {
+			errs = append(errs, fmt.Errorf("Image reference [%s] of %s is not valid: %v", image, name, err))
+		}
+	}
+	return errs
 }
@@ -0,0 +1,83 @@
+package cluster
+
+import (
+	"testing"
+
+	"yunion.io/x/yke/pkg/types"
+)
+
+func TestValidateDuplicateNodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []types.ConfigNode
+		errs  int
+	}{
+		{
+			name: "different nodes",
+			nodes: []types.ConfigNode{
+				{Address: "1.1.1.1", HostnameOverride: "node-a"},
+				{Address: "1.1.1.2", HostnameOverride: "node-b"},
+			},
+		},
+		{
+			name: "same address",
+			nodes: []types.ConfigNode{
+				{Address: "1.1.1.1", HostnameOverride: "node-a"},
+				{Address: "1.1.1.1", HostnameOverride: "node-b"},
+			},
+			errs: 1,
+		},
+		{
+			name: "same hostname override",
+			nodes: []types.ConfigNode{
+				{Address: "1.1.1.1", HostnameOverride: "node-a"},
+				{Address: "1.1.1.2", HostnameOverride: "node-a"},
+			},
+			errs: 1,
+		},
+		{
+			name: "same certificate name",
+			nodes: []types.ConfigNode{
+				{Address: "1.1.1.1", HostnameOverride: "node.a"},
+				{Address: "1.1.1.2", HostnameOverride: "node-a"},
+			},
+			errs: 1,
+		},
+	}
+	for _, test := range tests {
+		c := &Cluster{KubernetesEngineConfig: types.KubernetesEngineConfig{Nodes: test.nodes}}
+		if errs := validateDuplicateNodes(c); len(errs) != test.errs {
+			t.Errorf("%s: validateDuplicateNodes() = %v, want %d errors", test.name, errs, test.errs)
+		}
+	}
+}
+
+func TestValidateNetworkRanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		clusterCIDR  string
+		serviceRange string
+		dnsServer    string
+		errs         int
+	}{
+		{"ipv4", "10.42.0.0/16", "10.43.0.0/16", "10.43.0.10", 0},
+		{"ipv6", "fd00:42::/56", "fd00:43::/112", "fd00:43::a", 0},
+		{"dual-stack cluster cidr", "10.42.0.0/16,fd00:42::/56", "10.43.0.0/16", "10.43.0.10", 1},
+		{"dual-stack ranges", "10.42.0.0/16,fd00:42::/56", "10.43.0.0/16,fd00:43::/112", "10.43.0.10", 2},
+		{"mixed families", "fd00:42::/56", "10.43.0.0/16", "10.43.0.10", 1},
+		{"ipv6 cluster cidr too small", "fd00:42::/64", "fd00:43::/112", "fd00:43::a", 1},
+		{"ipv6 service range too large", "fd00:42::/56", "fd00:43::/64", "fd00:43::a", 1},
+		{"dns server out of range", "fd00:42::/56", "fd00:43::/112", "10.43.0.10", 1},
+	}
+	for _, test := range tests {
+		c := &Cluster{}
+		c.Version = "v1.12.3"
+		c.Services.KubeController.ClusterCIDR = test.clusterCIDR
+		c.Services.KubeController.ServiceClusterIPRange = test.serviceRange
+		c.Services.KubeAPI.ServiceClusterIPRange = test.serviceRange
+		c.Services.Kubelet.ClusterDNSServer = test.dnsServer
+		if errs := validateNetworkRanges(c); len(errs) != test.errs {
+			t.Errorf("%s: validateNetworkRanges() = %v, want %d errors", test.name, errs, test.errs)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"path"
 
 	"yunion.io/x/log"
 
@@ -62,7 +63,7 @@ func deployWebhookConfig(ctx context.Context, uniqueHosts []*hosts.Host, alpineI
 }
 
 func doDeployWebhookConfigFile(ctx context.Context, host *hosts.Host, webhookConfig string, alpineImage string, prsMap map[string]types.PrivateRegistry) error {
-	return host.WriteHostFile(ctx, WebhookConfigDeployer, WebhookConfigPath, webhookConfig, alpineImage, prsMap)
+	return host.WriteHostFile(ctx, WebhookConfigDeployer, path.Join(host.PrefixPath, WebhookConfigPath), webhookConfig, alpineImage, prsMap)
 }
 
 func deploySchedulerConfig(ctx context.Context, uniqueHosts []*hosts.Host, alpineImage string, schedulerConfig string, prsMap map[string]types.PrivateRegistry) error {
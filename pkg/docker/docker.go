@@ -438,6 +438,33 @@ func GetContainerLogsStdoutStderr(ctx context.Context, dClient *client.Client, c
 	return containerLog, nil
 }
 
+func GetContainerLogsStdout(ctx context.Context, dClient *client.Client, containerName, tail string, follow bool) (string, error) {
+	var containerStderr bytes.Buffer
+	var containerStdout bytes.Buffer
+	clogs, logserr := ReadContainerLogs(ctx, dClient, containerName, follow, tail)
+	if logserr != nil {
+		return "", fmt.Errorf("Failed to get gather logs from contaienr [%s]: %v", containerName, logserr)
+	}
+	defer clogs.Close()
+	stdcopy.StdCopy(&containerStdout, &containerStderr, clogs)
+	return containerStdout.String(), nil
+}
+
+// GetContainerLogs returns stdout and stderr of the container interleaved in
+// the order they were written.
+func GetContainerLogs(ctx context.Context, dClient *client.Client, containerName, tail string) (string, error) {
+	var containerLog bytes.Buffer
+	clogs, logserr := ReadContainerLogs(ctx, dClient, containerName, false, tail)
+	if logserr != nil {
+		return "", fmt.Errorf("Failed to get gather logs from contaienr [%s]: %v", containerName, logserr)
+	}
+	defer clogs.Close()
+	if _, err := stdcopy.StdCopy(&containerLog, &containerLog, clogs); err != nil {
+		return containerLog.String(), fmt.Errorf("Failed to read logs from container [%s]: %v", containerName, err)
+	}
+	return containerLog.String(), nil
+}
+
 func tryRegistryAuth(pr ytypes.PrivateRegistry) types.RequestPrivilegeFunc {
 	return func() (string, error) {
 		return getRegistryAuth(pr)
@@ -9,6 +9,8 @@ import (
 
 	"golang.org/x/crypto/ssh"
 
+	"yunion.io/x/log"
+
 	"yunion.io/x/yke/pkg/k8s"
 	"yunion.io/x/yke/pkg/types"
 )
@@ -17,56 +19,64 @@ const (
 	DockerDialerTimeout = 50
 )
 
+func getSSHKeyPassphrase(passphrase, fallbackPassphrase string) string {
+	if len(passphrase) > 0 {
+		return passphrase
+	}
+	return fallbackPassphrase
+}
+
 type DialerFactory func(h *Host) (func(network, address string) (net.Conn, error), error)
 
 type dialer struct {
-	signer          ssh.Signer
-	sshKeyString    string
-	sshAddress      string
-	username        string
-	netConn         string
-	dockerSocket    string
-	useSSHAgentAuth bool
-	bastionDialer   *dialer
+	signer           ssh.Signer
+	sshKeyString     string
+	sshKeyPassphrase string
+	sshCertString    string
+	sshAddress       string
+	username         string
+	netConn          string
+	dockerSocket     string
+	useSSHAgentAuth  bool
+	sshHostKey       string
+	hostKeyVerifier  *HostKeyVerifier
+	bastionDialer    *dialer
 }
 
 func newDialer(h *Host, kind string) (*dialer, error) {
+	hostKeyVerifier, err := getHostKeyVerifier(h.HostKeyVerifier)
+	if err != nil {
+		return nil, err
+	}
 	// Check for Bastion host connection
-	var bastionDialer *dialer
-	if len(h.BastionHost.Address) > 0 {
-		bastionDialer = &dialer{
-			sshAddress:      fmt.Sprintf("%s:%s", h.BastionHost.Address, h.BastionHost.Port),
-			username:        h.BastionHost.User,
-			sshKeyString:    h.BastionHost.SSHKey,
-			netConn:         "tcp",
-			useSSHAgentAuth: h.SSHAgentAuth,
-		}
-		if bastionDialer.sshKeyString == "" && !bastionDialer.useSSHAgentAuth {
-			var err error
-			bastionDialer.sshKeyString, err = privateKeyPath(h.BastionHost.SSHKeyPath)
-			if err != nil {
-				return nil, err
-			}
-		}
+	bastionDialer, err := newBastionDialer(h.BastionHost, hostKeyVerifier, h.FallbackSSHKeyPassphrase)
+	if err != nil {
+		return nil, err
 	}
 
 	dialer := &dialer{
-		sshAddress:      fmt.Sprintf("%s:%s", h.Address, h.Port),
-		username:        h.User,
-		dockerSocket:    h.DockerSocket,
-		sshKeyString:    h.SSHKey,
-		netConn:         "unix",
-		useSSHAgentAuth: h.SSHAgentAuth,
-		bastionDialer:   bastionDialer,
+		sshAddress:       fmt.Sprintf("%s:%s", h.Address, h.Port),
+		username:         h.User,
+		dockerSocket:     h.DockerSocket,
+		sshKeyString:     h.SSHKey,
+		sshKeyPassphrase: getSSHKeyPassphrase(h.SSHKeyPassphrase, h.FallbackSSHKeyPassphrase),
+		sshCertString:    h.SSHCert,
+		netConn:          "unix",
+		useSSHAgentAuth:  h.SSHAgentAuth,
+		sshHostKey:       h.SSHHostKey,
+		hostKeyVerifier:  hostKeyVerifier,
+		bastionDialer:    bastionDialer,
 	}
 
 	if dialer.sshKeyString == "" && !dialer.useSSHAgentAuth {
-		var err error
 		dialer.sshKeyString, err = privateKeyPath(h.SSHKeyPath)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if err := dialer.loadCertificate(h.SSHCertPath); err != nil {
+		return nil, err
+	}
 
 	switch kind {
 	case "network", "health":
@@ -80,6 +90,55 @@ func newDialer(h *Host, kind string) (*dialer, error) {
 	return dialer, nil
 }
 
+// newBastionDialer chains the dialers of the bastion hosts, the returned
+// dialer is the last hop which is dialed through all the previous ones.
+// fallbackPassphrase is used for the encrypted keys without passphrase.
+func newBastionDialer(bastionHosts types.BastionHosts, hostKeyVerifier *HostKeyVerifier, fallbackPassphrase string) (*dialer, error) {
+	var bastionDialer *dialer
+	for _, bastionHost := range bastionHosts {
+		hopDialer := &dialer{
+			sshAddress:       fmt.Sprintf("%s:%s", bastionHost.Address, bastionHost.Port),
+			username:         bastionHost.User,
+			sshKeyString:     bastionHost.SSHKey,
+			sshKeyPassphrase: getSSHKeyPassphrase(bastionHost.SSHKeyPassphrase, fallbackPassphrase),
+			sshCertString:    bastionHost.SSHCert,
+			netConn:          "tcp",
+			useSSHAgentAuth:  bastionHost.SSHAgentAuth,
+			sshHostKey:       bastionHost.SSHHostKey,
+			hostKeyVerifier:  hostKeyVerifier,
+			bastionDialer:    bastionDialer,
+		}
+		if hopDialer.sshKeyString == "" && !hopDialer.useSSHAgentAuth {
+			var err error
+			hopDialer.sshKeyString, err = privateKeyPath(bastionHost.SSHKeyPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := hopDialer.loadCertificate(bastionHost.SSHCertPath); err != nil {
+			return nil, err
+		}
+		bastionDialer = hopDialer
+	}
+	return bastionDialer, nil
+}
+
+func getHostKeyVerifier(hostKeyVerifier *HostKeyVerifier) (*HostKeyVerifier, error) {
+	if hostKeyVerifier != nil {
+		return hostKeyVerifier, nil
+	}
+	return NewHostKeyVerifier("", false, nil)
+}
+
+func (d *dialer) loadCertificate(sshCertPath string) error {
+	if d.sshCertString != "" || d.useSSHAgentAuth || sshCertPath == "" {
+		return nil
+	}
+	var err error
+	d.sshCertString, err = certificatePath(sshCertPath)
+	return err
+}
+
 func SSHFactory(h *Host) (func(network, address string) (net.Conn, error), error) {
 	dialer, err := newDialer(h, "docker")
 	return dialer.Dial, err
@@ -99,20 +158,14 @@ func (d *dialer) DialLocalConn(network, addr string) (net.Conn, error) {
 }
 
 func (d *dialer) Dial(network, addr string) (net.Conn, error) {
-	var conn *ssh.Client
-	var err error
-	if d.bastionDialer != nil {
-		conn, err = d.getBastionHostTunnelConn()
-	} else {
-		conn, err = d.getSSHTunnelConnection()
-	}
+	conn, err := d.getSSHClient()
 	if err != nil {
 		if strings.Contains(err.Error(), "no key found") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH, Please check if the configured key or specified key file is a valid SSH Private Key. Error: %v", d.sshAddress, err)
 		} else if strings.Contains(err.Error(), "no supported methods remain") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check if you are able to SSH to the node using the specified SSH Private Key and if you have configured the correct SSH username. Error: %v", d.sshAddress, err)
 		} else if strings.Contains(err.Error(), "cannot decode encrypted private keys") {
-			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Using encrypted private keys is only supported using ssh-agent. Please configure the option `ssh_agent_auth: true` in the configuration file or use --ssh-agent-auth as a parameter when running YKE. This will use the `SSH_AUTH_SOCK` environment variable. Error: %v", d.sshAddress, err)
+			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. The private key is encrypted, please configure the option `ssh_key_passphrase` in the configuration file or set the `YKE_SSH_KEY_PASSPHRASE` environment variable, or use ssh-agent with the option `ssh_agent_auth: true` or --ssh-agent-auth. Error: %v", d.sshAddress, err)
 		} else if strings.Contains(err.Error(), "operation timed out") {
 			return nil, fmt.Errorf("Unable to access node with address [%s] using SSH. Please check if the node is up and is accepting SSH connections or check network policies and firewall rules. Error: %v", d.sshAddress, err)
 		}
@@ -126,6 +179,15 @@ func (d *dialer) Dial(network, addr string) (net.Conn, error) {
 	}
 
 	remote, err := conn.Dial(network, addr)
+	if err != nil && isBrokenConnection(err) {
+		// the cached connection broke, reconnect once
+		log.Debugf("[dialer] SSH connection to [%s] is broken, reconnecting: %v", d.sshAddress, err)
+		d.evictSSHClient(conn)
+		if conn, err = d.getSSHClient(); err != nil {
+			return nil, fmt.Errorf("Failed to dial ssh using address [%s]: %v", d.sshAddress, err)
+		}
+		remote, err = conn.Dial(network, addr)
+	}
 	if err != nil {
 		if strings.Contains(err.Error(), "connect failed") {
 			return nil, fmt.Errorf("Unable to access the service on %s. The service might be still starting up. Error: %v", addr, err)
@@ -138,7 +200,7 @@ func (d *dialer) Dial(network, addr string) (net.Conn, error) {
 }
 
 func (d *dialer) getSSHTunnelConnection() (*ssh.Client, error) {
-	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.useSSHAgentAuth)
+	cfg, err := d.getSSHConfig()
 	if err != nil {
 		return nil, fmt.Errorf("Error configuring SSH: %v", err)
 	}
@@ -147,6 +209,18 @@ func (d *dialer) getSSHTunnelConnection() (*ssh.Client, error) {
 	return ssh.Dial("tcp", d.sshAddress, cfg)
 }
 
+func (d *dialer) getSSHConfig() (*ssh.ClientConfig, error) {
+	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.sshKeyPassphrase, d.sshCertString, d.useSSHAgentAuth)
+	if err != nil {
+		return nil, err
+	}
+	cfg.HostKeyCallback = d.hostKeyVerifier.HostKeyCallback(d.sshHostKey)
+	if len(d.sshHostKey) == 0 {
+		cfg.HostKeyAlgorithms = d.hostKeyVerifier.HostKeyAlgorithms(d.sshAddress)
+	}
+	return cfg, nil
+}
+
 func (h *Host) newHTTPClient(dialerFactory DialerFactory) (*http.Client, error) {
 	factory := dialerFactory
 	if factory == nil {
@@ -168,50 +242,69 @@ func (h *Host) newHTTPClient(dialerFactory DialerFactory) (*http.Client, error)
 }
 
 func (d *dialer) getBastionHostTunnelConn() (*ssh.Client, error) {
-	bastionCfg, err := getSSHConfig(d.bastionDialer.username, d.bastionDialer.sshKeyString, d.bastionDialer.useSSHAgentAuth)
-	if err != nil {
-		return nil, fmt.Errorf("Error configuring SSH for bastion host [%s]: %v", d.bastionDialer.sshAddress, err)
-	}
-	bastionClient, err := ssh.Dial("tcp", d.bastionDialer.sshAddress, bastionCfg)
+	bastionClient, err := d.bastionDialer.getSSHClient()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to the bastion host [%s]: %v", d.bastionDialer.sshAddress, err)
 	}
 	conn, err := bastionClient.Dial(d.bastionDialer.netConn, d.sshAddress)
+	if err != nil && isBrokenConnection(err) {
+		d.bastionDialer.evictSSHClient(bastionClient)
+		if bastionClient, err = d.bastionDialer.getSSHClient(); err != nil {
+			return nil, fmt.Errorf("Failed to connect to the bastion host [%s]: %v", d.bastionDialer.sshAddress, err)
+		}
+		conn, err = bastionClient.Dial(d.bastionDialer.netConn, d.sshAddress)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to the host [%s]: %v", d.sshAddress, err)
 	}
-	cfg, err := getSSHConfig(d.username, d.sshKeyString, d.useSSHAgentAuth)
+	cfg, err := d.getSSHConfig()
 	if err != nil {
 		return nil, fmt.Errorf("Error configuring SSH for host [%s]: %v", d.sshAddress, err)
 	}
 	newClientConn, channels, sshRequest, err := ssh.NewClientConn(conn, d.sshAddress, cfg)
 	if err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("Failed to establish new ssh client conn [%s]: %v", d.sshAddress, err)
 	}
 	return ssh.NewClient(newClientConn, channels, sshRequest), nil
 }
 
-func BastionHostWrapTransport(bastionHost types.BastionHost) (k8s.WrapTransport, error) {
-	bastionDialer := &dialer{
-		sshAddress:      fmt.Sprintf("%s:%s", bastionHost.Address, bastionHost.Port),
-		username:        bastionHost.User,
-		sshKeyString:    bastionHost.SSHKey,
-		netConn:         "tcp",
-		useSSHAgentAuth: bastionHost.SSHAgentAuth,
+// BastionHostWrapTransport routes the Kubernetes API traffic through the
+// bastion chain of the control plane host it's sent to, hostBastionHosts is
+// indexed by host address and bastionHosts is used for other addresses.
+// fallbackPassphrase is used for the encrypted keys without passphrase.
+func BastionHostWrapTransport(bastionHosts types.BastionHosts, hostBastionHosts map[string]types.BastionHosts, hostKeyVerifier *HostKeyVerifier, fallbackPassphrase string) (k8s.WrapTransport, error) {
+	hostKeyVerifier, err := getHostKeyVerifier(hostKeyVerifier)
+	if err != nil {
+		return nil, err
 	}
-
-	if bastionDialer.sshKeyString == "" {
-		var err error
-		bastionDialer.sshKeyString, err = privateKeyPath(bastionHost.SSHKeyPath)
-		if err != nil {
+	bastionDialer, err := newBastionDialer(bastionHosts, hostKeyVerifier, fallbackPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	hostDialers := map[string]*dialer{}
+	for address, hops := range hostBastionHosts {
+		if hostDialers[address], err = newBastionDialer(hops, hostKeyVerifier, fallbackPassphrase); err != nil {
 			return nil, err
 		}
 	}
+	dial := func(network, addr string) (net.Conn, error) {
+		d := bastionDialer
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			if hostDialer, ok := hostDialers[host]; ok {
+				d = hostDialer
+			}
+		}
+		if d == nil {
+			return net.Dial(network, addr)
+		}
+		return d.Dial(network, addr)
+	}
 	return func(rt http.RoundTripper) http.RoundTripper {
 		if ht, ok := rt.(*http.Transport); ok {
 			ht.DialContext = nil
 			ht.DialTLS = nil
-			ht.Dial = bastionDialer.Dial
+			ht.Dial = dial
 		}
 		return rt
 	}, nil
@@ -48,3 +48,32 @@ func (h *Host) WriteHostFile(ctx context.Context, contName, absPath, content, al
 	log.Debugf("[%s] Successfully write config %s on node [%s]", contName, absPath, h.Address)
 	return nil
 }
+
+// DeleteHostFile removes a file written with WriteHostFile from the host.
+func (h *Host) DeleteHostFile(ctx context.Context, contName, absPath, alpineImage string, prsMap map[string]types.PrivateRegistry) error {
+	if err := docker.DoRemoveContainer(ctx, h.DClient, contName, h.Address); err != nil {
+		return err
+	}
+	imageCfg := &container.Config{
+		Image: alpineImage,
+		Cmd:   []string{"rm", "-f", absPath},
+	}
+	dir := filepath.Dir(absPath)
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:%s", dir, dir),
+		},
+		Privileged: true,
+	}
+	if err := docker.DoRunContainer(ctx, h.DClient, imageCfg, hostCfg, contName, h.Address, WriteService, prsMap); err != nil {
+		return err
+	}
+	if _, err := docker.WaitForContainer(ctx, h.DClient, h.Address, contName); err != nil {
+		return err
+	}
+	if err := docker.DoRemoveContainer(ctx, h.DClient, contName, h.Address); err != nil {
+		return err
+	}
+	log.Debugf("[%s] Successfully deleted %s on node [%s]", contName, absPath, h.Address)
+	return nil
+}
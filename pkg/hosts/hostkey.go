@@ -0,0 +1,296 @@
+package hosts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+
+	"yunion.io/x/log"
+)
+
+const (
+	// HostKeyVerificationFailed is contained in every host key error, it's
+	// used to tell them apart from connectivity problems
+	HostKeyVerificationFailed = "Host key verification failed"
+	DefaultKnownHostsPath     = "~/.ssh/known_hosts"
+
+	knownHostsRevokedMarker = "revoked"
+	knownHostsHashMagic     = "|1|"
+)
+
+type knownHostsLine struct {
+	marker   string
+	patterns []string
+	key      ssh.PublicKey
+}
+
+// HostKeyVerifier checks the SSH host keys of the nodes and the bastion host
+// against a known_hosts file, the ssh_host_key fingerprints of the cluster
+// file and the keys trusted on first use.
+type HostKeyVerifier struct {
+	knownHostsPath  string
+	knownHosts      []knownHostsLine
+	trustOnFirstUse bool
+	trustedKeys     map[string]string
+	changed         bool
+	lock            sync.Mutex
+}
+
+// NewHostKeyVerifier loads the known_hosts file, ~/.ssh/known_hosts is used
+// when knownHostsPath is empty and it's fine for it to not exist. trustedKeys
+// are the keys trusted on first use in previous runs indexed by ssh address.
+func NewHostKeyVerifier(knownHostsPath string, trustOnFirstUse bool, trustedKeys map[string]string) (*HostKeyVerifier, error) {
+	v := &HostKeyVerifier{
+		knownHostsPath:  knownHostsPath,
+		trustOnFirstUse: trustOnFirstUse,
+		trustedKeys:     map[string]string{},
+	}
+	for address, key := range trustedKeys {
+		v.trustedKeys[address] = key
+	}
+	if len(v.knownHostsPath) == 0 {
+		v.knownHostsPath = DefaultKnownHostsPath
+	}
+	path := v.knownHostsPath
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(userHome(), path[2:])
+	}
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && len(knownHostsPath) == 0 {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Error while reading SSH known hosts file: %v", err)
+	}
+	v.knownHosts = parseKnownHosts(buff)
+	return v, nil
+}
+
+// TrustedKeys returns the host keys trusted on first use in authorized_keys
+// format indexed by ssh address.
+func (v *HostKeyVerifier) TrustedKeys() map[string]string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	keys := map[string]string{}
+	for address, key := range v.trustedKeys {
+		keys[address] = key
+	}
+	return keys
+}
+
+// Changed reports whether new keys were trusted on first use.
+func (v *HostKeyVerifier) Changed() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.changed
+}
+
+// HostKeyCallback returns the callback used for the ssh connection of a
+// single host, fingerprint is its ssh_host_key and takes precedence over the
+// known_hosts file when it's set.
+func (v *HostKeyVerifier) HostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return v.verify(hostname, remote, key, fingerprint)
+	}
+}
+
+// HostKeyAlgorithms returns the key types known for the host, so that the
+// server offers a key that can be verified instead of a different type.
+func (v *HostKeyVerifier) HostKeyAlgorithms(hostname string) []string {
+	algorithms := []string{}
+	addresses := []string{knownHostsAddress(hostname)}
+	for _, line := range v.knownHosts {
+		if len(line.marker) == 0 && matchKnownHostsPatterns(line.patterns, addresses) {
+			algorithms = appendAlgorithm(algorithms, line.key.Type())
+		}
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if trusted, ok := v.trustedKeys[hostname]; ok {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(trusted)); err == nil {
+			algorithms = appendAlgorithm(algorithms, key.Type())
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil
+	}
+	return algorithms
+}
+
+func (v *HostKeyVerifier) verify(hostname string, remote net.Addr, key ssh.PublicKey, fingerprint string) error {
+	keyFingerprint := ssh.FingerprintSHA256(key)
+	if len(fingerprint) > 0 {
+		if keyFingerprint != fingerprint {
+			return fmt.Errorf("%s for [%s]: the host presented key %s but ssh_host_key is %s", HostKeyVerificationFailed, hostname, keyFingerprint, fingerprint)
+		}
+		return nil
+	}
+
+	addresses := []string{knownHostsAddress(hostname)}
+	if remote != nil && remote.String() != hostname {
+		addresses = append(addresses, knownHostsAddress(remote.String()))
+	}
+	known, found := false, false
+	for _, line := range v.knownHosts {
+		if !matchKnownHostsPatterns(line.patterns, addresses) {
+			continue
+		}
+		keysEqual := bytes.Equal(line.key.Marshal(), key.Marshal())
+		if line.marker == knownHostsRevokedMarker {
+			if keysEqual {
+				return fmt.Errorf("%s for [%s]: the host key %s is marked as revoked in %s", HostKeyVerificationFailed, hostname, keyFingerprint, v.knownHostsPath)
+			}
+			continue
+		}
+		if len(line.marker) > 0 || line.key.Type() != key.Type() {
+			continue
+		}
+		known = true
+		if keysEqual {
+			found = true
+		}
+	}
+	if found {
+		return nil
+	}
+	if known {
+		return fmt.Errorf("%s for [%s]: the host presented key %s which does not match the key in %s, the host may have been reinstalled or the connection may be intercepted", HostKeyVerificationFailed, hostname, keyFingerprint, v.knownHostsPath)
+	}
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if trusted, ok := v.trustedKeys[hostname]; ok {
+		if trusted != authorizedKey {
+			return fmt.Errorf("%s for [%s]: the host presented key %s which does not match the key trusted on first use, the host may have been reinstalled or the connection may be intercepted", HostKeyVerificationFailed, hostname, keyFingerprint)
+		}
+		return nil
+	}
+	if !v.trustOnFirstUse {
+		return fmt.Errorf("%s for [%s]: the host key %s is unknown, add it to %s, set ssh_host_key of the node or enable ssh_trust_on_first_use", HostKeyVerificationFailed, hostname, keyFingerprint, v.knownHostsPath)
+	}
+	log.Warningf("[dialer] Trusting host key %s of [%s] on first use", keyFingerprint, hostname)
+	v.trustedKeys[hostname] = authorizedKey
+	v.changed = true
+	return nil
+}
+
+func parseKnownHosts(buff []byte) []knownHostsLine {
+	lines := []knownHostsLine{}
+	for i, line := range bytes.Split(buff, []byte("\n")) {
+		marker, patterns, key, _, _, err := ssh.ParseKnownHosts(line)
+		if err == io.EOF {
+			// blank line or comment
+			continue
+		}
+		if err != nil {
+			// same as ssh, entries with unsupported key types are skipped
+			log.Debugf("Skipping line %d of known hosts file: %v", i+1, err)
+			continue
+		}
+		lines = append(lines, knownHostsLine{
+			marker:   marker,
+			patterns: patterns,
+			key:      key,
+		})
+	}
+	return lines
+}
+
+// knownHostsAddress converts host:port to the format used in known_hosts
+// files, where the default port is omitted.
+func knownHostsAddress(hostport string) string {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	if port == "22" {
+		return host
+	}
+	return fmt.Sprintf("[%s]:%s", host, port)
+}
+
+func matchKnownHostsPatterns(patterns []string, addresses []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		for _, address := range addresses {
+			if !matchKnownHostsPattern(pattern, address) {
+				continue
+			}
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+func matchKnownHostsPattern(pattern, address string) bool {
+	if strings.HasPrefix(pattern, knownHostsHashMagic) {
+		parts := strings.Split(pattern[len(knownHostsHashMagic):], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(address))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return matchWildcard(pattern, address)
+}
+
+// matchWildcard matches the * and ? wildcards of known_hosts patterns.
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+func appendAlgorithm(algorithms []string, algorithm string) []string {
+	for _, a := range algorithms {
+		if a == algorithm {
+			return algorithms
+		}
+	}
+	return append(algorithms, algorithm)
+}
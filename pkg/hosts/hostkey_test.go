@@ -0,0 +1,293 @@
+package hosts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestPublicKey(t *testing.T, curve elliptic.Curve) ssh.PublicKey {
+	priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// hashKnownHostsAddress hashes address like ssh-keygen -H.
+func hashKnownHostsAddress(address string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(address))
+	return knownHostsHashMagic + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func knownHostsEntry(marker, patterns string, key ssh.PublicKey) string {
+	line := fmt.Sprintf("%s %s", patterns, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	if len(marker) > 0 {
+		line = fmt.Sprintf("@%s %s", marker, line)
+	}
+	return line
+}
+
+func TestKnownHostsAddress(t *testing.T) {
+	tests := []struct {
+		hostport string
+		address  string
+	}{
+		{"1.1.1.1:22", "1.1.1.1"},
+		{"1.1.1.1:2222", "[1.1.1.1]:2222"},
+		{"node1.example.com:22", "node1.example.com"},
+		{"node1.example.com:2222", "[node1.example.com]:2222"},
+		{"[fd00::1]:22", "fd00::1"},
+		{"[fd00::1]:2222", "[fd00::1]:2222"},
+		{"1.1.1.1", "1.1.1.1"},
+	}
+	for _, test := range tests {
+		if address := knownHostsAddress(test.hostport); address != test.address {
+			t.Errorf("knownHostsAddress(%q) = %q, want %q", test.hostport, address, test.address)
+		}
+	}
+}
+
+func TestMatchKnownHostsPatterns(t *testing.T) {
+	tests := []struct {
+		name      string
+		patterns  []string
+		addresses []string
+		match     bool
+	}{
+		{"exact", []string{"1.1.1.1"}, []string{"1.1.1.1"}, true},
+		{"mismatch", []string{"1.1.1.1"}, []string{"1.1.1.2"}, false},
+		{"prefix is no match", []string{"1.1.1.1"}, []string{"1.1.1.10"}, false},
+		{"second pattern", []string{"node1", "1.1.1.1"}, []string{"1.1.1.1"}, true},
+		{"second address", []string{"1.1.1.1"}, []string{"node1", "1.1.1.1"}, true},
+		{"star wildcard", []string{"10.0.*"}, []string{"10.0.3.4"}, true},
+		{"star wildcard mismatch", []string{"10.0.*"}, []string{"10.1.3.4"}, false},
+		{"question mark wildcard", []string{"node?.example.com"}, []string{"node1.example.com"}, true},
+		{"question mark matches one character", []string{"node?.example.com"}, []string{"node12.example.com"}, false},
+		{"negated", []string{"10.0.*", "!10.0.0.5"}, []string{"10.0.0.5"}, false},
+		{"negated other host", []string{"10.0.*", "!10.0.0.5"}, []string{"10.0.0.6"}, true},
+		{"negated first", []string{"!10.0.0.5", "10.0.*"}, []string{"10.0.0.5"}, false},
+		{"negated only", []string{"!10.0.0.5"}, []string{"10.0.0.6"}, false},
+		{"negated remote address", []string{"node1", "!10.0.0.5"}, []string{"node1", "10.0.0.5"}, false},
+		{"port", []string{"[1.1.1.1]:2222"}, []string{"[1.1.1.1]:2222"}, true},
+		{"port mismatch", []string{"[1.1.1.1]:2222"}, []string{"[1.1.1.1]:2200"}, false},
+		{"port is not the default one", []string{"1.1.1.1"}, []string{"[1.1.1.1]:2222"}, false},
+		{"hashed", []string{hashKnownHostsAddress("1.1.1.1")}, []string{"1.1.1.1"}, true},
+		{"hashed mismatch", []string{hashKnownHostsAddress("1.1.1.1")}, []string{"1.1.1.2"}, false},
+		{"hashed port", []string{hashKnownHostsAddress("[1.1.1.1]:2222")}, []string{"[1.1.1.1]:2222"}, true},
+		{"hashed negated", []string{"1.1.1.*", "!" + hashKnownHostsAddress("1.1.1.1")}, []string{"1.1.1.1"}, false},
+		{"malformed hash", []string{knownHostsHashMagic + "not base64|!"}, []string{"1.1.1.1"}, false},
+	}
+	for _, test := range tests {
+		if match := matchKnownHostsPatterns(test.patterns, test.addresses); match != test.match {
+			t.Errorf("%s: matchKnownHostsPatterns(%q, %q) = %v, want %v", test.name, test.patterns, test.addresses, match, test.match)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestPublicKey(t, elliptic.P256())
+	otherKey := newTestPublicKey(t, elliptic.P256())
+	otherTypeKey := newTestPublicKey(t, elliptic.P384())
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	otherAuthorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(otherKey)))
+	remote := &net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 22}
+
+	tests := []struct {
+		name            string
+		knownHosts      []string
+		trustedKeys     map[string]string
+		trustOnFirstUse bool
+		fingerprint     string
+		hostname        string
+		remote          net.Addr
+		key             ssh.PublicKey
+		err             string
+		trusted         bool
+	}{
+		{
+			name:       "known",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+		},
+		{
+			name:       "known among other keys",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", otherKey), knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+		},
+		{
+			name:       "hashed",
+			knownHosts: []string{knownHostsEntry("", hashKnownHostsAddress("1.1.1.1"), key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+		},
+		{
+			name:       "wildcard",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.*", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+		},
+		{
+			name:       "known by the remote address",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "node1:22",
+			remote:     remote,
+			key:        key,
+		},
+		{
+			name:       "non default port",
+			knownHosts: []string{knownHostsEntry("", "[1.1.1.1]:2222", key)},
+			hostname:   "1.1.1.1:2222",
+			key:        key,
+		},
+		{
+			name:       "non default port of a host known on port 22",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:2222",
+			key:        key,
+			err:        "is unknown",
+		},
+		{
+			name:       "mismatch",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", otherKey)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+			err:        "does not match the key in",
+		},
+		{
+			name:            "mismatch is not trusted on first use",
+			knownHosts:      []string{knownHostsEntry("", "1.1.1.1", otherKey)},
+			trustOnFirstUse: true,
+			hostname:        "1.1.1.1:22",
+			key:             key,
+			err:             "does not match the key in",
+		},
+		{
+			name:       "mismatch of a negated host is unknown",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.*,!1.1.1.1", otherKey)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+			err:        "is unknown",
+		},
+		{
+			name:       "other key type is unknown",
+			knownHosts: []string{knownHostsEntry("", "1.1.1.1", otherTypeKey)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+			err:        "is unknown",
+		},
+		{
+			name:       "revoked",
+			knownHosts: []string{knownHostsEntry(knownHostsRevokedMarker, "*", key), knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+			err:        "is marked as revoked",
+		},
+		{
+			name:       "other key revoked",
+			knownHosts: []string{knownHostsEntry(knownHostsRevokedMarker, "*", otherKey), knownHostsEntry("", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+		},
+		{
+			name:       "cert authority is not a host key",
+			knownHosts: []string{knownHostsEntry("cert-authority", "1.1.1.1", key)},
+			hostname:   "1.1.1.1:22",
+			key:        key,
+			err:        "is unknown",
+		},
+		{
+			name:     "unknown",
+			hostname: "1.1.1.1:22",
+			key:      key,
+			err:      "is unknown",
+		},
+		{
+			name:            "unknown trusted on first use",
+			trustOnFirstUse: true,
+			hostname:        "1.1.1.1:22",
+			key:             key,
+			trusted:         true,
+		},
+		{
+			name:        "trusted before",
+			trustedKeys: map[string]string{"1.1.1.1:22": authorizedKey},
+			hostname:    "1.1.1.1:22",
+			key:         key,
+		},
+		{
+			name:            "trusted before with another key",
+			trustedKeys:     map[string]string{"1.1.1.1:22": otherAuthorizedKey},
+			trustOnFirstUse: true,
+			hostname:        "1.1.1.1:22",
+			key:             key,
+			err:             "does not match the key trusted on first use",
+		},
+		{
+			name:        "ssh_host_key",
+			fingerprint: ssh.FingerprintSHA256(key),
+			hostname:    "1.1.1.1:22",
+			key:         key,
+		},
+		{
+			name:        "ssh_host_key takes precedence over known_hosts",
+			knownHosts:  []string{knownHostsEntry("", "1.1.1.1", otherKey)},
+			fingerprint: ssh.FingerprintSHA256(key),
+			hostname:    "1.1.1.1:22",
+			key:         key,
+		},
+		{
+			name:        "ssh_host_key mismatch",
+			knownHosts:  []string{knownHostsEntry("", "1.1.1.1", key)},
+			fingerprint: ssh.FingerprintSHA256(otherKey),
+			hostname:    "1.1.1.1:22",
+			key:         key,
+			err:         "but ssh_host_key is",
+		},
+	}
+	for _, test := range tests {
+		v := &HostKeyVerifier{
+			knownHostsPath:  DefaultKnownHostsPath,
+			knownHosts:      parseKnownHosts([]byte(strings.Join(test.knownHosts, "\n"))),
+			trustOnFirstUse: test.trustOnFirstUse,
+			trustedKeys:     map[string]string{},
+		}
+		for address, key := range test.trustedKeys {
+			v.trustedKeys[address] = key
+		}
+		err := v.verify(test.hostname, test.remote, test.key, test.fingerprint)
+		switch {
+		case err == nil && len(test.err) > 0:
+			t.Errorf("%s: verified, want an error containing %q", test.name, test.err)
+		case err != nil && len(test.err) == 0:
+			t.Errorf("%s: %v", test.name, err)
+		case err != nil && !strings.Contains(err.Error(), HostKeyVerificationFailed):
+			t.Errorf("%s: error %q is not a host key verification failure", test.name, err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		}
+		if v.Changed() != test.trusted {
+			t.Errorf("%s: changed = %v, want %v", test.name, v.Changed(), test.trusted)
+		}
+		if test.trusted && v.TrustedKeys()[test.hostname] != authorizedKey {
+			t.Errorf("%s: key of [%s] was not trusted on first use", test.name, test.hostname)
+		}
+	}
+}
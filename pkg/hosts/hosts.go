@@ -36,7 +36,10 @@ type Host struct {
 	DockerInfo          dtypes.Info
 	UpdateWorker        bool
 	PrefixPath          string
-	BastionHost         types.BastionHost
+	HostKeyVerifier     *HostKeyVerifier
+	// used for the encrypted SSH keys of the host and its bastion hosts
+	// without ssh_key_passphrase
+	FallbackSSHKeyPassphrase string
 }
 
 const (
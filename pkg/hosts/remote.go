@@ -6,20 +6,16 @@ import (
 	"github.com/cosiner/socker"
 )
 
+// SSH returns a client sharing the cached ssh connection of the host, closing
+// it leaves the connection open for the other users.
 func (h *Host) SSH() (*socker.SSH, error) {
-	var pkey string = h.SSHKey
-	var err error
-	if len(pkey) == 0 {
-		pkey, err = privateKeyPath(h.SSHKeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("Get PrivateKey: %v", err)
-		}
+	dialer, err := newDialer(h, "network")
+	if err != nil {
+		return nil, err
 	}
-	config := &socker.Auth{User: h.User, PrivateKey: pkey}
-	addr := fmt.Sprintf("%s:%s", h.Address, h.Port)
-	gate, err := socker.Dial(addr, config)
+	gate, err := dialer.getSocker()
 	if err != nil {
-		return nil, fmt.Errorf("Dial %s use private key %#v: %v", addr, config, err)
+		return nil, fmt.Errorf("Failed to dial ssh using address [%s]: %v", dialer.sshAddress, err)
 	}
 	return gate, nil
 }
@@ -29,6 +25,7 @@ func (h *Host) Rcmd(cmd string, env ...string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer a.Close()
 	ret, err := a.Rcmd(cmd, env...)
 	return string(ret), err
 }
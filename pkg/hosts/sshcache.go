@@ -0,0 +1,179 @@
+package hosts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cosiner/socker"
+	"golang.org/x/crypto/ssh"
+
+	"yunion.io/x/log"
+)
+
+const (
+	SSHKeepAliveInterval = 30
+	SSHKeepAliveTimeout  = 15
+)
+
+// sshClientEntry holds the ssh client of one host, it's shared by all the
+// dialers of the host for the whole run.
+type sshClientEntry struct {
+	lock   sync.Mutex
+	client *ssh.Client
+	socker *socker.SSH
+}
+
+var sshClients = struct {
+	sync.Mutex
+	entries map[string]*sshClientEntry
+}{entries: map[string]*sshClientEntry{}}
+
+func getSSHClientEntry(key string) *sshClientEntry {
+	sshClients.Lock()
+	defer sshClients.Unlock()
+	entry, ok := sshClients.entries[key]
+	if !ok {
+		entry = &sshClientEntry{}
+		sshClients.entries[key] = entry
+	}
+	return entry
+}
+
+// CloseSSHClients closes the ssh connections of all hosts, it's called once
+// the run is over.
+func CloseSSHClients() {
+	sshClients.Lock()
+	entries := map[string]*sshClientEntry{}
+	for key, entry := range sshClients.entries {
+		entries[key] = entry
+	}
+	sshClients.Unlock()
+	for key, entry := range entries {
+		entry.lock.Lock()
+		if entry.client != nil {
+			log.Debugf("[dialer] Closing SSH connection [%s]", key)
+			entry.close()
+		}
+		entry.lock.Unlock()
+	}
+}
+
+func (d *dialer) cacheKey() string {
+	key := fmt.Sprintf("%s@%s", d.username, d.sshAddress)
+	if d.bastionDialer != nil {
+		key = fmt.Sprintf("%s via %s", key, d.bastionDialer.cacheKey())
+	}
+	return key
+}
+
+// getSSHClient returns the cached ssh client of the host, the connection is
+// only established when there is none or the previous one broke.
+func (d *dialer) getSSHClient() (*ssh.Client, error) {
+	entry := getSSHClientEntry(d.cacheKey())
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	if entry.client != nil {
+		return entry.client, nil
+	}
+	var client *ssh.Client
+	var err error
+	if d.bastionDialer != nil {
+		client, err = d.getBastionHostTunnelConn()
+	} else {
+		client, err = d.getSSHTunnelConnection()
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.client = client
+	go func() {
+		client.Wait()
+		entry.evict(client)
+	}()
+	go entry.keepAlive(client, d.sshAddress)
+	return client, nil
+}
+
+// getSocker returns a socker client sharing the cached ssh connection of the
+// host, closing it leaves the connection open.
+func (d *dialer) getSocker() (*socker.SSH, error) {
+	client, err := d.getSSHClient()
+	if err != nil {
+		return nil, err
+	}
+	entry := getSSHClientEntry(d.cacheKey())
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	if entry.client != client {
+		return nil, fmt.Errorf("SSH connection to [%s] was closed", d.sshAddress)
+	}
+	if entry.socker == nil {
+		entry.socker, err = socker.NewSSH(client, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entry.socker.NopClose(), nil
+}
+
+// isBrokenConnection tells a broken ssh connection apart from the remote
+// side rejecting the channel, which the ssh client reports as
+// OpenChannelError.
+func isBrokenConnection(err error) bool {
+	_, ok := err.(*ssh.OpenChannelError)
+	return !ok
+}
+
+// evictSSHClient closes a broken client so that the next dial reconnects.
+func (d *dialer) evictSSHClient(client *ssh.Client) {
+	getSSHClientEntry(d.cacheKey()).evict(client)
+}
+
+func (e *sshClientEntry) evict(client *ssh.Client) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.client == client {
+		e.close()
+	}
+}
+
+func (e *sshClientEntry) close() {
+	if e.socker != nil {
+		// closes the ssh client as well
+		e.socker.Close()
+	} else {
+		e.client.Close()
+	}
+	e.client = nil
+	e.socker = nil
+}
+
+func (e *sshClientEntry) keepAlive(client *ssh.Client, address string) {
+	ticker := time.NewTicker(time.Second * SSHKeepAliveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		e.lock.Lock()
+		current := e.client
+		e.lock.Unlock()
+		if current != client {
+			return
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errCh <- err
+		}()
+		var err error
+		select {
+		case err = <-errCh:
+		case <-time.After(time.Second * SSHKeepAliveTimeout):
+			err = fmt.Errorf("timeout after %d seconds", SSHKeepAliveTimeout)
+		}
+		if err != nil {
+			log.Warningf("[dialer] SSH keepalive to [%s] failed, reconnecting on next use: %v", address, err)
+			e.evict(client)
+			return
+		}
+	}
+}
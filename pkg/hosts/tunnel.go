@@ -1,12 +1,17 @@
 package hosts
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/docker/docker/client"
 	"golang.org/x/crypto/ssh"
@@ -83,14 +88,65 @@ func checkDockerVersion(ctx context.Context, h *Host, clusterVersion string) err
 	return nil
 }
 
-func parsePrivateKey(keyBuff string) (ssh.Signer, error) {
-	return ssh.ParsePrivateKey([]byte(keyBuff))
+func parsePrivateKey(keyBuff, passphrase string) (ssh.Signer, error) {
+	if isEncryptedOpenSSHKey(keyBuff) {
+		// the OpenSSH key format is encrypted with bcrypt which isn't supported
+		return nil, fmt.Errorf("The private key is an encrypted key in OpenSSH format which can't be decrypted, convert it to PEM format with `ssh-keygen -p -m PEM -f <key>` or use ssh-agent")
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(keyBuff))
+	if err == nil || len(passphrase) == 0 || !strings.Contains(err.Error(), "cannot decode encrypted private keys") {
+		return signer, err
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(keyBuff), []byte(passphrase))
+	if err == x509.IncorrectPasswordError {
+		return nil, fmt.Errorf("Incorrect SSH key passphrase: %v", err)
+	}
+	return signer, err
+}
+
+// isEncryptedOpenSSHKey reports whether the key is in the OpenSSH format, the
+// default of ssh-keygen since OpenSSH 7.8, and encrypted with a passphrase.
+func isEncryptedOpenSSHKey(keyBuff string) bool {
+	const magic = "openssh-key-v1\x00"
+	block, _ := pem.Decode([]byte(keyBuff))
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" || !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return false
+	}
+	rest := block.Bytes[len(magic):]
+	if len(rest) < 4 {
+		return false
+	}
+	length := binary.BigEndian.Uint32(rest)
+	if uint64(len(rest)-4) < uint64(length) {
+		return false
+	}
+	return string(rest[4:4+length]) != "none"
+}
+
+// parseCertSigner returns a signer presenting the OpenSSH certificate,
+// certString is in authorized_keys format as written by ssh-keygen -s.
+func parseCertSigner(signer ssh.Signer, certString string) (ssh.Signer, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certString))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse SSH certificate: %v", err)
+	}
+	cert, ok := pubKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("SSH certificate is a plain %s public key", pubKey.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("SSH certificate is not a user certificate")
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("SSH certificate doesn't match the private key: %v", err)
+	}
+	return certSigner, nil
 }
 
-func getSSHConfig(username, sshPrivateKeyString string, useAgentAuth bool) (*ssh.ClientConfig, error) {
+func getSSHConfig(username, sshPrivateKeyString, sshKeyPassphrase, sshCertString string, useAgentAuth bool) (*ssh.ClientConfig, error) {
 	config := &ssh.ClientConfig{
-		User:            username,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User: username,
 	}
 
 	// Kind of a double check now
@@ -107,11 +163,21 @@ func getSSHConfig(username, sshPrivateKeyString string, useAgentAuth bool) (*ssh
 		}
 	}
 
-	signer, err := parsePrivateKey(sshPrivateKeyString)
+	signer, err := parsePrivateKey(sshPrivateKeyString, sshKeyPassphrase)
 	if err != nil {
 		return config, err
 	}
-	config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	signers := []ssh.Signer{signer}
+	if len(sshCertString) > 0 {
+		certSigner, err := parseCertSigner(signer, sshCertString)
+		if err != nil {
+			return config, err
+		}
+		// the certificate is offered first, the plain key is kept for hosts
+		// that don't trust the certificate authority
+		signers = []ssh.Signer{certSigner, signer}
+	}
+	config.Auth = append(config.Auth, ssh.PublicKeys(signers...))
 	return config, nil
 }
 
@@ -130,6 +196,17 @@ func privateKeyPath(sshKeyPath string) (string, error) {
 	return string(buff), nil
 }
 
+func certificatePath(sshCertPath string) (string, error) {
+	if strings.HasPrefix(sshCertPath, "~/") {
+		sshCertPath = filepath.Join(userHome(), sshCertPath[2:])
+	}
+	buff, err := ioutil.ReadFile(sshCertPath)
+	if err != nil {
+		return "", fmt.Errorf("Error while reading SSH certificate file: %v", err)
+	}
+	return string(buff), nil
+}
+
 func userHome() string {
 	if home := os.Getenv("HOME"); home != "" {
 		return home
@@ -0,0 +1,209 @@
+package hosts
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestECKey(t *testing.T) (*ecdsa.PrivateKey, *pem.Block) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+}
+
+// newOpenSSHKey builds the header of an OpenSSH format key, it's all that
+// isEncryptedOpenSSHKey reads.
+func newOpenSSHKey(magic, cipher string) string {
+	buff := bytes.NewBufferString(magic)
+	binary.Write(buff, binary.BigEndian, uint32(len(cipher)))
+	buff.WriteString(cipher)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: buff.Bytes()}))
+}
+
+// sshKeygen generates a key in OpenSSH format with ssh-keygen, ed25519 keys
+// are always written in that format.
+func sshKeygen(t *testing.T, passphrase string) string {
+	sshKeygenPath, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen is not available")
+	}
+	dir, err := ioutil.TempDir("", "yke-ssh-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "id_ed25519")
+	if out, err := exec.Command(sshKeygenPath, "-q", "-t", "ed25519", "-N", passphrase, "-f", keyPath).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen failed: %v: %s", err, out)
+	}
+	buff, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buff)
+}
+
+func TestIsEncryptedOpenSSHKey(t *testing.T) {
+	_, ecBlock := newTestECKey(t)
+	tests := []struct {
+		name      string
+		key       string
+		encrypted bool
+	}{
+		{"aes256-ctr", newOpenSSHKey("openssh-key-v1\x00", "aes256-ctr"), true},
+		{"not encrypted", newOpenSSHKey("openssh-key-v1\x00", "none"), false},
+		{"bad magic", newOpenSSHKey("openssh-key-v2\x00", "aes256-ctr"), false},
+		{"truncated cipher", string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("openssh-key-v1\x00\x00\x00\x00\x10aes")})), false},
+		{"truncated length", string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: []byte("openssh-key-v1\x00\x00")})), false},
+		{"pem key", string(pem.EncodeToMemory(ecBlock)), false},
+		{"not a key", "ssh-ed25519 AAAA", false},
+		{"empty", "", false},
+	}
+	for _, test := range tests {
+		if encrypted := isEncryptedOpenSSHKey(test.key); encrypted != test.encrypted {
+			t.Errorf("%s: isEncryptedOpenSSHKey = %v, want %v", test.name, encrypted, test.encrypted)
+		}
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, block := newTestECKey(t)
+	plain := string(pem.EncodeToMemory(block))
+	encryptedBlock, err := x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := string(pem.EncodeToMemory(encryptedBlock))
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		passphrase string
+		err        string
+	}{
+		{name: "plain", key: plain},
+		{name: "plain with passphrase", key: plain, passphrase: "secret"},
+		{name: "encrypted", key: encrypted, passphrase: "secret"},
+		{name: "encrypted without passphrase", key: encrypted, err: "cannot decode encrypted private keys"},
+		{name: "encrypted with a wrong passphrase", key: encrypted, passphrase: "wrong", err: "Incorrect SSH key passphrase"},
+		{name: "encrypted openssh", key: newOpenSSHKey("openssh-key-v1\x00", "aes256-ctr"), passphrase: "secret", err: "ssh-keygen -p -m PEM"},
+		{name: "not a key", key: "not a key", err: "no key found"},
+	}
+	for _, test := range tests {
+		signer, err := parsePrivateKey(test.key, test.passphrase)
+		switch {
+		case err != nil && len(test.err) == 0:
+			t.Errorf("%s: %v", test.name, err)
+		case err == nil && len(test.err) > 0:
+			t.Errorf("%s: parsed, want an error containing %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		case err == nil && !bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()):
+			t.Errorf("%s: parsed the wrong key", test.name)
+		}
+	}
+}
+
+func TestParsePrivateKeyGeneratedBySSHKeygen(t *testing.T) {
+	if _, err := parsePrivateKey(sshKeygen(t, ""), ""); err != nil {
+		t.Errorf("OpenSSH key without passphrase: %v", err)
+	}
+	encrypted := sshKeygen(t, "secret")
+	if !isEncryptedOpenSSHKey(encrypted) {
+		t.Errorf("OpenSSH key with passphrase is not seen as encrypted")
+	}
+	if _, err := parsePrivateKey(encrypted, "secret"); err == nil || !strings.Contains(err.Error(), "ssh-keygen -p -m PEM") {
+		t.Errorf("OpenSSH key with passphrase: got %v, want the conversion hint", err)
+	}
+}
+
+func TestParseCertSigner(t *testing.T) {
+	newSigner := func() ssh.Signer {
+		key, _ := newTestECKey(t)
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	caSigner, signer, otherSigner := newSigner(), newSigner(), newSigner()
+	newCert := func(key ssh.PublicKey, certType uint32) string {
+		cert := &ssh.Certificate{
+			Key:             key,
+			CertType:        certType,
+			KeyId:           "yke",
+			ValidPrincipals: []string{"root"},
+			ValidBefore:     ssh.CertTimeInfinity,
+		}
+		if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+			t.Fatal(err)
+		}
+		return string(ssh.MarshalAuthorizedKey(cert))
+	}
+
+	tests := []struct {
+		name string
+		cert string
+		err  string
+	}{
+		{name: "user certificate", cert: newCert(signer.PublicKey(), ssh.UserCert)},
+		{name: "certificate of another key", cert: newCert(otherSigner.PublicKey(), ssh.UserCert), err: "doesn't match the private key"},
+		{name: "host certificate", cert: newCert(signer.PublicKey(), ssh.HostCert), err: "is not a user certificate"},
+		{name: "plain public key", cert: string(ssh.MarshalAuthorizedKey(signer.PublicKey())), err: "is a plain"},
+		{name: "not a certificate", cert: "not a certificate", err: "Failed to parse SSH certificate"},
+	}
+	for _, test := range tests {
+		certSigner, err := parseCertSigner(signer, test.cert)
+		switch {
+		case err != nil && len(test.err) == 0:
+			t.Errorf("%s: %v", test.name, err)
+		case err == nil && len(test.err) > 0:
+			t.Errorf("%s: parsed, want an error containing %q", test.name, test.err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q, want it to contain %q", test.name, err, test.err)
+		case err == nil:
+			if _, ok := certSigner.PublicKey().(*ssh.Certificate); !ok {
+				t.Errorf("%s: the signer doesn't present the certificate", test.name)
+			}
+		}
+	}
+}
+
+func TestGetSSHKeyPassphrase(t *testing.T) {
+	tests := []struct {
+		passphrase, fallback, want string
+	}{
+		{"", "", ""},
+		{"node", "", "node"},
+		{"", "cli", "cli"},
+		{"node", "cli", "node"},
+	}
+	for _, test := range tests {
+		if got := getSSHKeyPassphrase(test.passphrase, test.fallback); got != test.want {
+			t.Errorf("getSSHKeyPassphrase(%q, %q) = %q, want %q", test.passphrase, test.fallback, got, test.want)
+		}
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 
@@ -87,6 +89,120 @@ func IsNodeReady(node v1.Node) bool {
 	return false
 }
 
+// WaitForNodeReady polls the node until it reports the Ready condition or
+// the timeout in seconds passes.
+func WaitForNodeReady(k8sClient *kubernetes.Clientset, nodeName string, timeout int) error {
+	var err error
+	var node *v1.Node
+	for timePassed := 0; timePassed < timeout; timePassed += DefaultSleepSeconds {
+		node, err = GetNode(k8sClient, nodeName)
+		if err == nil && IsNodeReady(*node) {
+			return nil
+		}
+		time.Sleep(time.Second * time.Duration(DefaultSleepSeconds))
+	}
+	if err != nil {
+		return fmt.Errorf("Timeout waiting for node [%s] to be ready: %v", nodeName, err)
+	}
+	return fmt.Errorf("Timeout waiting for node [%s] to be ready", nodeName)
+}
+
+// DrainNode evicts every pod running on the node except mirror pods, pods
+// managed by a DaemonSet and running pods without a controller, which would be
+// lost, then waits until the evicted pods are gone.
+func DrainNode(k8sClient *kubernetes.Clientset, nodeName string, gracePeriod, timeout int) error {
+	node, err := GetNode(k8sClient, nodeName)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Debugf("[hosts] Can't find node by name [%s], skipping drain", nodeName)
+			return nil
+		}
+		return err
+	}
+	podList, err := k8sClient.CoreV1().Pods("").List(metav1.ListOptions{
+		FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.Name}).String(),
+	})
+	if err != nil {
+		return err
+	}
+	var deleteOptions *metav1.DeleteOptions
+	if gracePeriod > 0 {
+		seconds := int64(gracePeriod)
+		deleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &seconds}
+	}
+	deadline := time.Now().Add(time.Second * time.Duration(timeout))
+	pods := []v1.Pod{}
+	for _, pod := range podList.Items {
+		if !isDrainablePod(pod) {
+			continue
+		}
+		if isUnmanagedPod(pod) {
+			log.Warningf("[hosts] Pod [%s/%s] on node [%s] isn't managed by a controller, skipping its eviction", pod.Namespace, pod.Name, nodeName)
+			continue
+		}
+		if err := evictPod(k8sClient, pod, deleteOptions, deadline); err != nil {
+			return fmt.Errorf("Failed to evict pod [%s/%s] from node [%s]: %v", pod.Namespace, pod.Name, nodeName, err)
+		}
+		pods = append(pods, pod)
+	}
+	for _, pod := range pods {
+		for {
+			p, err := k8sClient.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && p.UID != pod.UID) {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Timeout waiting for pod [%s/%s] to be evicted from node [%s]", pod.Namespace, pod.Name, nodeName)
+			}
+			time.Sleep(time.Second)
+		}
+	}
+	return nil
+}
+
+func isDrainablePod(pod v1.Pod) bool {
+	if _, ok := pod.Annotations[v1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	if ref := metav1.GetControllerOf(&pod); ref != nil && ref.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+// isUnmanagedPod reports whether the pod is still running and has no
+// controller to recreate it on another node.
+func isUnmanagedPod(pod v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+	return metav1.GetControllerOf(&pod) == nil
+}
+
+func evictPod(k8sClient *kubernetes.Clientset, pod v1.Pod, deleteOptions *metav1.DeleteOptions, deadline time.Time) error {
+	eviction := &policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+		DeleteOptions: deleteOptions,
+	}
+	for {
+		err := k8sClient.CoreV1().Pods(pod.Namespace).Evict(eviction)
+		if err == nil || apierrors.IsNotFound(err) {
+			return nil
+		}
+		// a pod disruption budget is blocking the eviction, retry later
+		if !apierrors.IsTooManyRequests(err) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second * 5)
+	}
+}
+
 func RemoveTaintFromNodeByKey(k8sClient *kubernetes.Clientset, nodeName, taintKey string) error {
 	updated := false
 	var err error
@@ -1,12 +1,20 @@
 package k8s
 
 import (
+	"fmt"
+	"time"
+
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	BootstrapTokenSecretType   = "bootstrap.kubernetes.io/token"
+	BootstrapTokenSecretPrefix = "bootstrap-token-"
+)
+
 func GetSecret(k8sClient *kubernetes.Clientset, secretName string) (*v1.Secret, error) {
 	return k8sClient.CoreV1().Secrets(metav1.NamespaceSystem).Get(secretName, metav1.GetOptions{})
 }
@@ -30,3 +38,62 @@ func UpdateSecret(k8sClient *kubernetes.Clientset, secretDataMap map[string][]by
 	}
 	return nil
 }
+
+// UpdateBootstrapTokenSecret creates the bootstrap token <tokenID>.<tokenSecret>
+// valid until expiration,
+// kube-apiserver authenticates it as a member of system:bootstrappers.
+func UpdateBootstrapTokenSecret(k8sClient *kubernetes.Clientset, tokenID, tokenSecret, description string, expiration time.Time) error {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      BootstrapTokenSecretPrefix + tokenID,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Type: BootstrapTokenSecretType,
+		StringData: map[string]string{
+			"description":                    description,
+			"token-id":                       tokenID,
+			"token-secret":                   tokenSecret,
+			"expiration":                     expiration.UTC().Format(time.RFC3339),
+			"usage-bootstrap-authentication": "true",
+		},
+	}
+	if _, err := k8sClient.CoreV1().Secrets(metav1.NamespaceSystem).Create(secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		if _, err := k8sClient.CoreV1().Secrets(metav1.NamespaceSystem).Update(secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBootstrapTokenSecret deletes the bootstrap token tokenID, it's
+// already gone when kube-controller-manager cleaned it up after it expired.
+func DeleteBootstrapTokenSecret(k8sClient *kubernetes.Clientset, tokenID string) error {
+	err := k8sClient.CoreV1().Secrets(metav1.NamespaceSystem).Delete(BootstrapTokenSecretPrefix+tokenID, &metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// RewriteSecrets updates every Secret of the cluster unchanged, kube-apiserver
+// stores them again with its current encryption provider.
+func RewriteSecrets(k8sClient *kubernetes.Clientset) error {
+	secrets, err := k8sClient.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if _, err := k8sClient.CoreV1().Secrets(secret.Namespace).Update(secret); err != nil {
+			// a Secret updated or deleted meanwhile doesn't need to be rewritten
+			if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("Failed to rewrite secret [%s/%s]: %v", secret.Namespace, secret.Name, err)
+		}
+	}
+	return nil
+}
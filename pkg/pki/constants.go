@@ -21,6 +21,7 @@ const (
 	KubeSchedulerCertName      = "kube-scheduler"
 	KubeProxyCertName          = "kube-proxy"
 	KubeNodeCertName           = "kube-node"
+	KubeletServingCertName     = "kube-kubelet"
 	EtcdCertName               = "kube-etcd"
 	EtcdClientCACertName       = "kube-etcd-client-ca"
 	EtcdClientCertName         = "kube-etcd-client"
@@ -30,8 +31,14 @@ const (
 	KubeNodeCommonName       = "system:node"
 	KubeNodeOrganizationName = "system:nodes"
 
+	// kubelets use a client certificate of their own issued by yke, or
+	// request it with a bootstrap token
+	KubeletNodeCertMode      = "node"
+	KubeletBootstrapCertMode = "bootstrap"
+
 	KubeAdminCertName         = "kube-admin"
 	KubeAdminOrganizationName = "system:masters"
 	KubeAdminConfigPrefix     = "kube_config_"
+	KubeAPIPort               = "6443"
 	duration365d              = time.Hour * 24 * 365
 )
@@ -154,7 +154,7 @@ func DeployCertificatesOnHost(ctx context.Context, host *hosts.Host, crtMap map[
 	return doRunDeployer(ctx, host, env, certDownloaderImage, prsMap)
 }
 
-func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, host *hosts.Host, image, localConfigPath string, prsMap map[string]ytypes.PrivateRegistry) (map[string]CertificatePKI, error) {
+func FetchCertificatesFromHost(ctx context.Context, extraHosts, kubeletHosts []*hosts.Host, host *hosts.Host, image, localConfigPath string, prsMap map[string]ytypes.PrivateRegistry) (map[string]CertificatePKI, error) {
 	// rebuilding the certificates. This should look better after refactoring pki
 	tmpCerts := make(map[string]CertificatePKI)
 
@@ -176,11 +176,19 @@ func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, ho
 		crtList[GetEtcdCrtName(etcdHost.InternalAddress)] = false
 	}
 
+	for _, kubeletHost := range kubeletHosts {
+		// Fetch kubelet certificates
+		crtList[GetKubeletCrtName(GetNodeName(kubeletHost.ConfigNode))] = true
+		crtList[GetKubeletServingCrtName(GetNodeName(kubeletHost.ConfigNode))] = false
+	}
+
 	for certName, config := range crtList {
 		certificate := CertificatePKI{}
 		crt, err := FetchFileFromHost(ctx, GetCertTempPath(certName), image, host, prsMap, CertFetcherContainer, "certificates")
 		// I will only exit with an error if it's not a not-found-error and this is not an etcd certificate
 		if err != nil && (!strings.HasPrefix(certName, "kube-etcd") &&
+			!IsKubeletCrtName(certName) &&
+			!IsKubeletServingCrtName(certName) &&
 			!strings.Contains(certName, APIProxyClientCertName) &&
 			!strings.Contains(certName, RequestHeaderCACertName) &&
 			!strings.Contains(certName, ServiceAccountTokenKeyName)) {
@@ -190,8 +198,10 @@ func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, ho
 			}
 			return nil, err
 		}
-		// If I can't find an etcd or api aggregator cert, I will not fail and will create it later
+		// If I can't find an etcd, kubelet or api aggregator cert, I will not fail and will create it later
 		if crt == "" && (strings.HasPrefix(certName, "kube-etcd") ||
+			IsKubeletCrtName(certName) ||
+			IsKubeletServingCrtName(certName) ||
 			strings.Contains(certName, APIProxyClientCertName) ||
 			strings.Contains(certName, RequestHeaderCACertName) ||
 			strings.Contains(certName, ServiceAccountTokenKeyName)) {
@@ -224,7 +234,7 @@ func FetchCertificatesFromHost(ctx context.Context, extraHosts []*hosts.Host, ho
 	if err := docker.RemoveContainer(ctx, host.DClient, host.Address, CertFetcherContainer); err != nil {
 		return nil, err
 	}
-	return populateCertMap(tmpCerts, localConfigPath, extraHosts), nil
+	return populateCertMap(tmpCerts, localConfigPath, extraHosts, kubeletHosts), nil
 }
 
 func FetchFileFromHost(ctx context.Context, filePath, image string, host *hosts.Host, prsMap map[string]ytypes.PrivateRegistry, containerName, state string) (string, error) {
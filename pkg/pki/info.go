@@ -0,0 +1,67 @@
+package pki
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type CertificateInfo struct {
+	Name         string    `json:"name"`
+	CommonName   string    `json:"commonName"`
+	Organization []string  `json:"organization"`
+	DNSNames     []string  `json:"dnsNames"`
+	IPAddresses  []string  `json:"ipAddresses"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	DaysLeft     int       `json:"daysLeft"`
+}
+
+// GetCertificatesInfo returns the details of every certificate in the bundle
+// sorted by name, entries without a certificate (e.g. the service account
+// token key) are skipped.
+func GetCertificatesInfo(certs map[string]CertificatePKI, now time.Time) []CertificateInfo {
+	infos := []CertificateInfo{}
+	for name, certPKI := range certs {
+		if certPKI.Certificate == nil {
+			continue
+		}
+		infos = append(infos, GetCertificateInfo(name, certPKI, now))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func GetCertificateInfo(name string, certPKI CertificatePKI, now time.Time) CertificateInfo {
+	crt := certPKI.Certificate
+	ips := []string{}
+	for _, ip := range crt.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	return CertificateInfo{
+		Name:         name,
+		CommonName:   crt.Subject.CommonName,
+		Organization: crt.Subject.Organization,
+		DNSNames:     crt.DNSNames,
+		IPAddresses:  ips,
+		Issuer:       crt.Issuer.CommonName,
+		SerialNumber: fmt.Sprintf("%x", crt.SerialNumber),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		DaysLeft:     getDaysLeft(crt.NotAfter, now),
+	}
+}
+
+func getDaysLeft(notAfter, now time.Time) int {
+	left := notAfter.Sub(now)
+	days := int(left / (24 * time.Hour))
+	if left < 0 && left%(24*time.Hour) != 0 {
+		// round towards the past for expired certificates
+		days--
+	}
+	return days
+}
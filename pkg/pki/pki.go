@@ -60,14 +60,19 @@ func GenerateNodeCerts(ctx context.Context, keConfig types.KubernetesEngineConfi
 	crtMap := make(map[string]CertificatePKI)
 	crtKeys := []string{}
 	removeCAKey := true
+	isControl := false
+	kubeletCrtName, kubeletServingCrtName := "", ""
 	for _, node := range keConfig.Nodes {
 		if node.Address == nodeAddress {
+			kubeletCrtName = GetKubeletCrtName(GetNodeName(node))
+			kubeletServingCrtName = GetKubeletServingCrtName(GetNodeName(node))
 			for _, role := range node.Role {
 				switch role {
 				case controlRole:
 					keys := getControlCertKeys()
 					crtKeys = append(crtKeys, keys...)
 					removeCAKey = false
+					isControl = true
 				case workerRole:
 					keys := getWorkerCertKeys()
 					crtKeys = append(crtKeys, keys...)
@@ -82,6 +87,22 @@ func GenerateNodeCerts(ctx context.Context, keConfig types.KubernetesEngineConfi
 	for _, key := range crtKeys {
 		crtMap[key] = certBundle[key]
 	}
+	for _, name := range []string{kubeletCrtName, kubeletServingCrtName} {
+		if crt, ok := certBundle[name]; ok && crt.Certificate != nil {
+			// the kubelet certificates are only deployed on their own node
+			crtMap[name] = crt
+		}
+	}
+	if !isControl && len(keConfig.ControlPlaneEndpoint.Address) > 0 {
+		// nodes without a local kube-apiserver go through the control plane endpoint
+		kubeAPIURL := GetKubeAPIURL(keConfig.ControlPlaneEndpoint, nil)
+		for _, name := range []string{KubeNodeCertName, KubeProxyCertName, kubeletCrtName} {
+			if crt, ok := crtMap[name]; ok && len(crt.Config) > 0 {
+				crt.Config = getKubeConfigX509(kubeAPIURL, "local", name, GetCertPath(CACertName), crt.Path, crt.KeyPath)
+				crtMap[name] = crt
+			}
+		}
+	}
 	if removeCAKey {
 		caCert := crtMap[CACertName]
 		caCert.Key = nil
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	"yunion.io/x/yke/pkg/types"
 )
@@ -121,3 +122,155 @@ func assertEqual(t *testing.T, a interface{}, b interface{}, message string) {
 	}
 	t.Fatal(message)
 }
+
+func TestCertificatesInfo(t *testing.T) {
+	keConfig := types.KubernetesEngineConfig{
+		Nodes: []types.ConfigNode{
+			types.ConfigNode{
+				Address:          "1.1.1.1",
+				InternalAddress:  "192.168.1.5",
+				Role:             []string{"controlplane"},
+				HostnameOverride: "server1",
+			},
+		},
+		Services: types.ConfigServices{
+			KubeAPI: types.KubeAPIService{
+				ServiceClusterIPRange: FakeClusterCidr,
+			},
+			Kubelet: types.KubeletService{
+				ClusterDomain: FakeClusterDomain,
+			},
+		},
+	}
+	certificateMap, err := GenerateKECerts(context.Background(), keConfig, "", "")
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	kubeAPICert := certificateMap[KubeAPICertName].Certificate
+	infos := GetCertificatesInfo(certificateMap, kubeAPICert.NotAfter.Add(-36*time.Hour))
+	for _, info := range infos {
+		if info.Name != KubeAPICertName {
+			continue
+		}
+		assertEqual(t, info.CommonName, kubeAPICert.Subject.CommonName, "")
+		assertEqual(t, info.Issuer, certificateMap[CACertName].Certificate.Subject.CommonName, "")
+		assertEqual(t, info.DaysLeft, 1, "")
+		assertEqual(t, isStringInSlice("192.168.1.5", info.IPAddresses), true, "Internal address is not found in kube API certificate info")
+		return
+	}
+	t.Fatalf("Certificate %s is not found in certificates info", KubeAPICertName)
+}
+
+func TestKubeletCertificates(t *testing.T) {
+	keConfig := types.KubernetesEngineConfig{
+		Nodes: []types.ConfigNode{
+			types.ConfigNode{
+				Address:          "1.1.1.1",
+				InternalAddress:  "192.168.1.5",
+				Role:             []string{"controlplane", "etcd"},
+				HostnameOverride: "server1",
+			},
+			types.ConfigNode{
+				Address:          "1.1.1.2",
+				InternalAddress:  "192.168.1.6",
+				Role:             []string{"worker"},
+				HostnameOverride: "worker1.cluster.test",
+			},
+		},
+		Services: types.ConfigServices{
+			KubeAPI: types.KubeAPIService{
+				ServiceClusterIPRange: FakeClusterCidr,
+			},
+			Kubelet: types.KubeletService{
+				ClusterDomain: FakeClusterDomain,
+			},
+		},
+	}
+	certificateMap, err := GenerateKECerts(context.Background(), keConfig, "", "")
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certificateMap[CACertName].Certificate)
+	opts := x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, node := range keConfig.Nodes {
+		kubeletCert := certificateMap[GetKubeletCrtName(node.HostnameOverride)].Certificate
+		if kubeletCert == nil {
+			t.Fatalf("Kubelet certificate of node %s is not generated", node.HostnameOverride)
+		}
+		if _, err := kubeletCert.Verify(opts); err != nil {
+			t.Fatalf("Failed to verify kubelet certificate of node %s: %v", node.HostnameOverride, err)
+		}
+		assertEqual(t, kubeletCert.Subject.CommonName, "system:node:"+node.HostnameOverride, "")
+		assertEqual(t, isStringInSlice(KubeNodeOrganizationName, kubeletCert.Subject.Organization), true, "Kubelet certificate is not in the nodes group")
+	}
+
+	servingOpts := x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, node := range keConfig.Nodes {
+		servingCert := certificateMap[GetKubeletServingCrtName(node.HostnameOverride)].Certificate
+		if servingCert == nil {
+			t.Fatalf("Kubelet serving certificate of node %s is not generated", node.HostnameOverride)
+		}
+		for _, name := range []string{node.HostnameOverride, node.Address, node.InternalAddress} {
+			servingOpts.DNSName = name
+			if _, err := servingCert.Verify(servingOpts); err != nil {
+				t.Fatalf("Failed to verify kubelet serving certificate of node %s for %s: %v", node.HostnameOverride, name, err)
+			}
+		}
+		assertEqual(t, IsKubeletServingCertUpToDate(servingCert, node), true, "Kubelet serving certificate is not up to date")
+		node.InternalAddress = "192.168.1.10"
+		assertEqual(t, IsKubeletServingCertUpToDate(servingCert, node), false, "Kubelet serving certificate is up to date after an address change")
+	}
+
+	// a node only gets its own kubelet certificates
+	workerCerts := GenerateNodeCerts(context.Background(), keConfig, "1.1.1.2", certificateMap)
+	for name := range workerCerts {
+		if name == KubeNodeCertName ||
+			(IsKubeletCrtName(name) && name != GetKubeletCrtName("worker1.cluster.test")) ||
+			(IsKubeletServingCrtName(name) && name != GetKubeletServingCrtName("worker1.cluster.test")) {
+			t.Fatalf("Certificate %s is deployed on worker node", name)
+		}
+	}
+	for _, name := range []string{GetKubeletCrtName("worker1.cluster.test"), GetKubeletServingCrtName("worker1.cluster.test")} {
+		if _, ok := workerCerts[name]; !ok {
+			t.Fatalf("Certificate %s is not deployed on worker node", name)
+		}
+	}
+	if len(workerCerts[GetKubeletServingCrtName("worker1.cluster.test")].Config) > 0 {
+		t.Fatalf("Kubelet serving certificate has a kubeconfig")
+	}
+
+	keConfig.Services.Kubelet.ClientCertMode = KubeletBootstrapCertMode
+	certificateMap, err = GenerateKECerts(context.Background(), keConfig, "", "")
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	for name := range certificateMap {
+		if IsKubeletCrtName(name) {
+			t.Fatalf("Kubelet certificate %s is generated in %s mode", name, KubeletBootstrapCertMode)
+		}
+	}
+}
+
+func TestGetKubernetesServiceIP(t *testing.T) {
+	tests := map[string]string{
+		"10.43.0.0/16":   "10.43.0.1",
+		"fd00:43::/112":  "fd00:43::1",
+		"fd00:43::10/64": "fd00:43::1",
+	}
+	for serviceRange, want := range tests {
+		ip, err := GetKubernetesServiceIP(serviceRange)
+		if err != nil {
+			t.Fatalf("GetKubernetesServiceIP(%s): %v", serviceRange, err)
+		}
+		if ip.String() != want {
+			t.Errorf("GetKubernetesServiceIP(%s) = %s, want %s", serviceRange, ip, want)
+		}
+	}
+}
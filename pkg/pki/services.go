@@ -24,7 +24,7 @@ func GenerateKubeAPICertificate(ctx context.Context, certs map[string]Certificat
 	}
 	clusterDomain := keConfig.Services.Kubelet.ClusterDomain
 	cpHosts := hosts.NodesToHosts(keConfig.Nodes, controlRole)
-	kubeAPIAltNames := GetAltNames(cpHosts, clusterDomain, kubernetesServiceIP, keConfig.Authentication.SANs)
+	kubeAPIAltNames := GetAltNames(cpHosts, clusterDomain, kubernetesServiceIP, GetKubeAPISANs(keConfig))
 	kubeAPICert := certs[KubeAPICertName].Certificate
 	if kubeAPICert != nil &&
 		reflect.DeepEqual(kubeAPIAltNames.DNSNames, kubeAPICert.DNSNames) &&
@@ -98,6 +98,61 @@ func GenerateKubeNodeCertificate(ctx context.Context, certs map[string]Certifica
 	return nil
 }
 
+// GenerateKubeletCertificates issues the client certificate of every node, the
+// kubelets authenticate as system:node:<hostname_override> so that the Node
+// authorizer and the NodeRestriction admission plugin can tell them apart.
+func GenerateKubeletCertificates(ctx context.Context, certs map[string]CertificatePKI, keConfig types.KubernetesEngineConfig, configPath, configDir string) error {
+	if keConfig.Services.Kubelet.ClientCertMode == KubeletBootstrapCertMode {
+		// the kubelets request their certificates themselves
+		return nil
+	}
+	for _, node := range keConfig.Nodes {
+		if err := GenerateKubeletCertificate(certs, GetNodeName(node)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GenerateKubeletCertificate(certs map[string]CertificatePKI, hostname string) error {
+	log.Infof("[certificates] Generating kubelet certificate of node [%s]", hostname)
+	caCrt := certs[CACertName].Certificate
+	caKey := certs[CACertName].Key
+	commonName := GetKubeletCommonName(hostname)
+	kubeletCrt, kubeletKey, err := GenerateSignedCertAndKey(caCrt, caKey, false, commonName, nil, nil, []string{KubeNodeOrganizationName})
+	if err != nil {
+		return err
+	}
+	kubeletName := GetKubeletCrtName(hostname)
+	certs[kubeletName] = ToCertObject(kubeletName, commonName, KubeNodeOrganizationName, kubeletCrt, kubeletKey)
+	return nil
+}
+
+// GenerateKubeletServingCertificates issues the certificate every kubelet
+// serves its API with, so that its clients can verify it with the cluster CA.
+func GenerateKubeletServingCertificates(ctx context.Context, certs map[string]CertificatePKI, keConfig types.KubernetesEngineConfig, configPath, configDir string) error {
+	for _, node := range keConfig.Nodes {
+		if err := GenerateKubeletServingCertificate(certs, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GenerateKubeletServingCertificate(certs map[string]CertificatePKI, node types.ConfigNode) error {
+	hostname := GetNodeName(node)
+	log.Infof("[certificates] Generating kubelet serving certificate of node [%s]", hostname)
+	caCrt := certs[CACertName].Certificate
+	caKey := certs[CACertName].Key
+	servingCrt, servingKey, err := GenerateSignedCertAndKey(caCrt, caKey, true, hostname, GetKubeletServingAltNames(node), nil, nil)
+	if err != nil {
+		return err
+	}
+	servingName := GetKubeletServingCrtName(hostname)
+	certs[servingName] = ToCertObject(servingName, hostname, "", servingCrt, servingKey)
+	return nil
+}
+
 func GenerateKubeAdminCertificate(ctx context.Context, certs map[string]CertificatePKI, keConfig types.KubernetesEngineConfig, configPath, configDir string) error {
 	// generate Admin certificate and key
 	log.Infof("[certificates] Generating admin certificates and kubeconfig")
@@ -115,7 +170,7 @@ func GenerateKubeAdminCertificate(ctx context.Context, certs map[string]Certific
 	kubeAdminCertObj := ToCertObject(KubeAdminCertName, KubeAdminCertName, KubeAdminOrganizationName, kubeAdminCrt, kubeAdminKey)
 	if len(cpHosts) > 0 {
 		kubeAdminConfig := GetKubeConfigX509WithData(
-			"https://"+cpHosts[0].Address+":6443",
+			GetKubeAPIURL(keConfig.ControlPlaneEndpoint, cpHosts),
 			keConfig.ClusterName,
 			KubeAdminCertName,
 			string(cert.EncodeCertPEM(caCrt)),
@@ -228,6 +283,8 @@ func GenerateKEServicesCerts(ctx context.Context, certs map[string]CertificatePK
 		GenerateKubeSchedulerCertificate,
 		GenerateKubeProxyCertificate,
 		GenerateKubeNodeCertificate,
+		GenerateKubeletCertificates,
+		GenerateKubeletServingCertificates,
 		GenerateKubeAdminCertificate,
 		GenerateAPIProxyClientCertificate,
 		GenerateEtcdCertificates,
@@ -174,6 +174,91 @@ func GetEtcdCrtName(address string) string {
 	return fmt.Sprintf("%s-%s", EtcdCertName, newAddress)
 }
 
+// GetKubeletCrtName returns the name of the client certificate of the kubelet
+// running on the node called hostname.
+func GetKubeletCrtName(hostname string) string {
+	newHostname := strings.Replace(hostname, ".", "-", -1)
+	return fmt.Sprintf("%s-%s", KubeNodeCertName, newHostname)
+}
+
+func IsKubeletCrtName(name string) bool {
+	return strings.HasPrefix(name, KubeNodeCertName+"-")
+}
+
+// GetKubeletServingCrtName returns the name of the certificate the kubelet
+// running on the node called hostname serves its API with.
+func GetKubeletServingCrtName(hostname string) string {
+	newHostname := strings.Replace(hostname, ".", "-", -1)
+	return fmt.Sprintf("%s-%s", KubeletServingCertName, newHostname)
+}
+
+func IsKubeletServingCrtName(name string) bool {
+	return strings.HasPrefix(name, KubeletServingCertName+"-")
+}
+
+// GetKubeletServingAltNames returns the SANs of the kubelet serving
+// certificate, the addresses and the name kube-apiserver and metrics-server
+// reach the node with.
+func GetKubeletServingAltNames(node types.ConfigNode) *cert.AltNames {
+	altNames := &cert.AltNames{}
+	for _, address := range []string{node.Address, node.InternalAddress, GetNodeName(node)} {
+		if len(address) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(address); ip != nil {
+			if !isIPInSlice(ip, altNames.IPs) {
+				altNames.IPs = append(altNames.IPs, ip)
+			}
+		} else if !isStringInList(address, altNames.DNSNames) {
+			altNames.DNSNames = append(altNames.DNSNames, address)
+		}
+	}
+	return altNames
+}
+
+// IsKubeletServingCertUpToDate tells whether the kubelet serving certificate
+// was issued for the current addresses of node.
+func IsKubeletServingCertUpToDate(crt *x509.Certificate, node types.ConfigNode) bool {
+	if crt == nil {
+		return false
+	}
+	altNames := GetKubeletServingAltNames(node)
+	return reflect.DeepEqual(altNames.DNSNames, crt.DNSNames) && deepEqualIPsAltNames(altNames.IPs, crt.IPAddresses)
+}
+
+func isIPInSlice(ip net.IP, list []net.IP) bool {
+	for _, i := range list {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isStringInList(s string, list []string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetKubeletCommonName returns the user of the kubelet running on the node
+// called hostname, as the Node authorizer expects it.
+func GetKubeletCommonName(hostname string) string {
+	return fmt.Sprintf("%s:%s", KubeNodeCommonName, hostname)
+}
+
+// GetNodeName returns the name the node registers with, the per node
+// certificates are named after it.
+func GetNodeName(node types.ConfigNode) string {
+	if len(node.HostnameOverride) > 0 {
+		return node.HostnameOverride
+	}
+	return node.Address
+}
+
 func GetCertPath(name string) string {
 	return fmt.Sprintf("%s%s.pem", CertPathPrefix, name)
 }
@@ -210,7 +295,7 @@ func ToCertObject(componentName, commonName, ouName string, cert *x509.Certifica
 	path := GetCertPath(componentName)
 	keyPath := GetKeyPath(componentName)
 
-	if componentName != CACertName && componentName != KubeAPICertName && !strings.Contains(componentName, EtcdCertName) && componentName != ServiceAccountTokenKeyName {
+	if componentName != CACertName && componentName != KubeAPICertName && !strings.Contains(componentName, EtcdCertName) && componentName != ServiceAccountTokenKeyName && !IsKubeletServingCrtName(componentName) {
 		config = getKubeConfigX509("https://127.0.0.1:6443", "local", componentName, caCertPath, path, keyPath)
 		configPath = GetConfigPath(componentName)
 		configEnvName = getConfigEnvFromEnv(envName)
@@ -253,10 +338,11 @@ func getControlCertKeys() []string {
 }
 
 func getWorkerCertKeys() []string {
+	// the shared node certificate is only the etcd client certificate of
+	// the etcd and controlplane hosts, kubelets use a certificate of their own
 	return []string{
 		CACertName,
 		KubeProxyCertName,
-		KubeNodeCertName,
 	}
 }
 
@@ -274,6 +360,33 @@ func getEtcdCertKeys(keNodes []types.ConfigNode, etcdRole string) []string {
 
 }
 
+// GetKubeAPIURL returns the URL of the kubernetes API used by kubeconfigs
+// outside of the control plane hosts, the control plane endpoint when it's
+// set and the first control plane host otherwise.
+func GetKubeAPIURL(endpoint types.ControlPlaneEndpoint, cpHosts []*hosts.Host) string {
+	if len(endpoint.Address) > 0 {
+		port := endpoint.Port
+		if len(port) == 0 {
+			port = KubeAPIPort
+		}
+		return "https://" + net.JoinHostPort(endpoint.Address, port)
+	}
+	if len(cpHosts) == 0 {
+		return ""
+	}
+	return "https://" + net.JoinHostPort(cpHosts[0].Address, KubeAPIPort)
+}
+
+// GetKubeAPISANs returns the extra SANs of the kube API certificate, the
+// control plane endpoint address is added to the configured ones.
+func GetKubeAPISANs(keConfig types.KubernetesEngineConfig) []string {
+	sans := append([]string{}, keConfig.Authentication.SANs...)
+	if len(keConfig.ControlPlaneEndpoint.Address) > 0 {
+		sans = append(sans, keConfig.ControlPlaneEndpoint.Address)
+	}
+	return sans
+}
+
 func GetKubernetesServiceIP(serviceClusterRange string) (net.IP, error) {
 	ip, ipnet, err := net.ParseCIDR(serviceClusterRange)
 	if err != nil {
@@ -312,7 +425,7 @@ func getTempPath(s string) string {
 	return TempCertPath + path.Base(s)
 }
 
-func populateCertMap(tmpCerts map[string]CertificatePKI, localConfigPath string, extraHosts []*hosts.Host) map[string]CertificatePKI {
+func populateCertMap(tmpCerts map[string]CertificatePKI, localConfigPath string, extraHosts, kubeletHosts []*hosts.Host) map[string]CertificatePKI {
 	certs := make(map[string]CertificatePKI)
 	// CACert
 	certs[CACertName] = ToCertObject(CACertName, "", "", tmpCerts[CACertName].Certificate, tmpCerts[CACertName].Key)
@@ -337,6 +450,24 @@ func populateCertMap(tmpCerts map[string]CertificatePKI, localConfigPath string,
 		etcdCrt, etcdKey := tmpCerts[etcdName].Certificate, tmpCerts[etcdName].Key
 		certs[etcdName] = ToCertObject(etcdName, "", "", etcdCrt, etcdKey)
 	}
+	// kubelet, the missing ones are generated again
+	for _, host := range kubeletHosts {
+		kubeletName := GetKubeletCrtName(GetNodeName(host.ConfigNode))
+		kubeletCrt, kubeletKey := tmpCerts[kubeletName].Certificate, tmpCerts[kubeletName].Key
+		if kubeletCrt == nil {
+			continue
+		}
+		certs[kubeletName] = ToCertObject(kubeletName, GetKubeletCommonName(GetNodeName(host.ConfigNode)), KubeNodeOrganizationName, kubeletCrt, kubeletKey)
+	}
+	// kubelet serving, the missing ones are generated again
+	for _, host := range kubeletHosts {
+		servingName := GetKubeletServingCrtName(GetNodeName(host.ConfigNode))
+		servingCrt, servingKey := tmpCerts[servingName].Certificate, tmpCerts[servingName].Key
+		if servingCrt == nil {
+			continue
+		}
+		certs[servingName] = ToCertObject(servingName, GetNodeName(host.ConfigNode), "", servingCrt, servingKey)
+	}
 
 	return certs
 }
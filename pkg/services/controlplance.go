@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 
 	"golang.org/x/sync/errgroup"
 
@@ -48,6 +49,31 @@ func RunControlPlane(
 	return nil
 }
 
+// UpgradeControlPlane redeploys the control plane hosts one at a time, every
+// host has to pass its health checks before the next one is touched.
+func UpgradeControlPlane(
+	ctx context.Context,
+	controlHosts []*hosts.Host,
+	localConnDialerFactory hosts.DialerFactory,
+	prsMap map[string]types.PrivateRegistry,
+	cpNodePlanMap map[string]types.ConfigNodePlan,
+	updateWorkersOnly bool,
+	alpineImage string,
+	certMap map[string]pki.CertificatePKI) error {
+	if updateWorkersOnly {
+		return nil
+	}
+	log.Infof("[%s] Upgrading Controller Plane..", ControlRole)
+	for _, host := range controlHosts {
+		log.Infof("[%s] Upgrading host [%s]", ControlRole, host.Address)
+		if err := doDeployControlHost(ctx, host, localConnDialerFactory, prsMap, cpNodePlanMap[host.Address].Processes, alpineImage, certMap); err != nil {
+			return fmt.Errorf("Failed to upgrade host [%s]: %v", host.Address, err)
+		}
+	}
+	log.Infof("[%s] Successfully upgraded Controller Plane..", ControlRole)
+	return nil
+}
+
 func RemoveControlPlane(ctx context.Context, controlHosts []*hosts.Host, force bool) error {
 	log.Infof("[%s] Tearing down the Controller Plane..", ControlRole)
 	var errgrp errgroup.Group
@@ -66,6 +92,9 @@ func RemoveControlPlane(ctx context.Context, controlHosts []*hosts.Host, force b
 				if err := removeScheduler(ctx, runHost); err != nil {
 					errList = append(errList, err)
 				}
+				if err := removeControlPlaneVIP(ctx, runHost); err != nil {
+					errList = append(errList, err)
+				}
 				// force is true in remove, false in reconcile
 				if force {
 					if err := removeKubelet(ctx, runHost); err != nil {
@@ -157,5 +186,6 @@ func doDeployControlHost(
 	if err := runScheduler(ctx, host, localConnDialerFactory, prsMap, processMap[SchedulerContainerName], alpineImage); err != nil {
 		return err
 	}
-	return nil
+	// run the control plane endpoint virtual IP
+	return runControlPlaneVIP(ctx, host, prsMap, processMap, alpineImage)
 }
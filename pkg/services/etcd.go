@@ -2,8 +2,11 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +29,9 @@ const (
 	EtcdRestorePath  = "/opt/yke/etcd-snapshots-restore/"
 	EtcdDataDir      = "/var/lib/yunion/etcd/"
 	EtcdInitWaitTime = 10
+
+	EtcdSnapshotS3AccessKeyEnv = "S3_ACCESS_KEY"
+	EtcdSnapshotS3SecretKeyEnv = "S3_SECRET_KEY"
 )
 
 type EtcdSnapshot struct {
@@ -35,6 +41,8 @@ type EtcdSnapshot struct {
 	Creation string
 	// Retention period of the etcd snapshots
 	Retention string
+	// S3 compatible object storage to upload the etcd snapshots
+	S3BackupConfig *types.S3BackupConfig
 }
 
 func RunEtcdPlane(
@@ -58,7 +66,7 @@ func RunEtcdPlane(
 			return err
 		}
 		if etcdSnapshot.Snapshot {
-			if err := RunEtcdSnapshotSave(ctx, host, prsMap, alpineImage, etcdSnapshot.Creation, etcdSnapshot.Retention, EtcdSnapshotContainerName, false); err != nil {
+			if err := RunEtcdSnapshotSave(ctx, host, prsMap, alpineImage, etcdSnapshot.Creation, etcdSnapshot.Retention, EtcdSnapshotContainerName, false, etcdSnapshot.S3BackupConfig); err != nil {
 				return err
 			}
 			if err := pki.SaveBackupBundleOnHost(ctx, host, alpineImage, EtcdSnapshotPath, prsMap); err != nil {
@@ -211,7 +219,7 @@ func ReloadEtcdCluster(ctx context.Context, readyEtcdHosts []*hosts.Host, newHos
 	var healthy bool
 	for _, host := range readyEtcdHosts {
 		_, _, healthCheckURL := GetProcessConfig(etcdNodePlanMap[host.Address].Processes[EtcdContainerName])
-		if healthy = isEtcdHealthy(ctx, localConnDialerFactory, host, cert, key, healthCheckURL); healthy {
+		if healthy = IsEtcdHealthy(ctx, localConnDialerFactory, host, cert, key, healthCheckURL); healthy {
 			break
 		}
 	}
@@ -257,7 +265,7 @@ func IsEtcdMember(ctx context.Context, etcdHost *hosts.Host, etcdHosts []*hosts.
 	return false, nil
 }
 
-func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, etcdSnapshotImage string, creation, retention, name string, once bool) error {
+func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, etcdSnapshotImage string, creation, retention, name string, once bool, s3Config *types.S3BackupConfig) error {
 	log.Infof("[etcd] Saving snapshot [%s] on host [%s]", name, etcdHost.Address)
 	imageCfg := &container.Config{
 		Cmd: []string{
@@ -278,6 +286,10 @@ func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 		imageCfg.Cmd = append(imageCfg.Cmd, "--retention="+retention)
 		imageCfg.Cmd = append(imageCfg.Cmd, "--creation="+creation)
 	}
+	if s3Config != nil {
+		imageCfg.Cmd = append(imageCfg.Cmd, getEtcdSnapshotS3Args(s3Config)...)
+		imageCfg.Env = getEtcdSnapshotS3Env(s3Config)
+	}
 	hostCfg := &container.HostConfig{
 		Binds: []string{
 			fmt.Sprintf("%s:/backup", EtcdSnapshotPath),
@@ -298,6 +310,72 @@ func RunEtcdSnapshotSave(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 	return docker.DoRunContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, EtcdSnapshotContainerName, etcdHost.Address, ETCDRole, prsMap)
 }
 
+func DownloadEtcdSnapshotFromS3(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, etcdSnapshotImage, name string, s3Config *types.S3BackupConfig) error {
+	log.Infof("[etcd] Downloading snapshot [%s] from S3 bucket [%s] on host [%s]", name, s3Config.BucketName, etcdHost.Address)
+	imageCfg := &container.Config{
+		Cmd: append([]string{
+			"/opt/yke-tools/yke-etcd-backup",
+			"download",
+			"--name", name,
+		}, getEtcdSnapshotS3Args(s3Config)...),
+		Env:   getEtcdSnapshotS3Env(s3Config),
+		Image: etcdSnapshotImage,
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/backup:z", EtcdSnapshotPath),
+		},
+		NetworkMode: container.NetworkMode("host"),
+	}
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdDownloadContainerName, etcdHost.Address); err != nil {
+		return err
+	}
+	if err := docker.DoRunContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, EtcdDownloadContainerName, etcdHost.Address, ETCDRole, prsMap); err != nil {
+		return err
+	}
+	status, err := docker.WaitForContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdDownloadContainerName)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		containerLog, err := docker.GetContainerLogsStdoutStderr(ctx, etcdHost.DClient, EtcdDownloadContainerName, "5", false)
+		if err != nil {
+			return err
+		}
+		if err := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdDownloadContainerName); err != nil {
+			return err
+		}
+		return fmt.Errorf("Failed to download etcd snapshot from S3, exit status is: %d, container logs: %s", status, containerLog)
+	}
+	return docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdDownloadContainerName)
+}
+
+func getEtcdSnapshotS3Args(s3Config *types.S3BackupConfig) []string {
+	args := []string{
+		"--s3-backup=true",
+		"--s3-endpoint=" + s3Config.Endpoint,
+		"--s3-bucketName=" + s3Config.BucketName,
+		"--s3-region=" + s3Config.Region,
+	}
+	if len(s3Config.Folder) > 0 {
+		args = append(args, "--s3-folder="+s3Config.Folder)
+	}
+	if len(s3Config.CustomCA) > 0 {
+		// the CA is passed base64 encoded to keep it on a single argument
+		args = append(args, "--s3-endpoint-ca="+base64.StdEncoding.EncodeToString([]byte(s3Config.CustomCA)))
+	}
+	return args
+}
+
+// getEtcdSnapshotS3Env passes the S3 credentials in the environment of the
+// backup tool, its command line is visible to every user of the host.
+func getEtcdSnapshotS3Env(s3Config *types.S3BackupConfig) []string {
+	return []string{
+		EtcdSnapshotS3AccessKeyEnv + "=" + s3Config.AccessKey,
+		EtcdSnapshotS3SecretKeyEnv + "=" + s3Config.SecretKey,
+	}
+}
+
 func RestoreEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, etcdRestoreImage, snapshotName, initCluster string) error {
 	log.Infof("[etcd] Restoring [%s] snapshot on etcd host [%s]", snapshotName, etcdHost.Address)
 	nodeName := pki.GetEtcdCrtName(etcdHost.InternalAddress)
@@ -353,3 +431,127 @@ func RestoreEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[s
 	}
 	return docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdRestoreContainerName)
 }
+
+type EtcdSnapshotFile struct {
+	Name      string
+	Size      int64
+	Timestamp time.Time
+}
+
+type EtcdSnapshotStatus struct {
+	Hash      uint32 `json:"hash"`
+	Revision  int64  `json:"revision"`
+	TotalKey  int    `json:"totalKey"`
+	TotalSize int64  `json:"totalSize"`
+}
+
+func ListEtcdSnapshots(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, alpineImage string) ([]EtcdSnapshotFile, error) {
+	log.Debugf("[etcd] Listing snapshots on host [%s]", etcdHost.Address)
+	imageCfg := &container.Config{
+		Cmd: []string{
+			"sh", "-c",
+			"cd /backup && for f in *; do if [ -f \"$f\" ]; then stat -c '%n|%s|%Y' \"$f\"; fi; done",
+		},
+		Image: alpineImage,
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/backup:z", EtcdSnapshotPath),
+		},
+	}
+	out, err := runEtcdSnapshotTool(ctx, etcdHost, imageCfg, hostCfg, prsMap)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []EtcdSnapshotFile{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) != 3 || fields[0] == path.Base(pki.BundleCertPath) {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse size of snapshot [%s] on host [%s]: %v", fields[0], etcdHost.Address, err)
+		}
+		mtime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse timestamp of snapshot [%s] on host [%s]: %v", fields[0], etcdHost.Address, err)
+		}
+		snapshots = append(snapshots, EtcdSnapshotFile{
+			Name:      fields[0],
+			Size:      size,
+			Timestamp: time.Unix(mtime, 0),
+		})
+	}
+	return snapshots, nil
+}
+
+func RemoveEtcdSnapshot(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, alpineImage, snapshotName string) error {
+	log.Infof("[etcd] Removing snapshot [%s] on host [%s]", snapshotName, etcdHost.Address)
+	imageCfg := &container.Config{
+		Cmd: []string{
+			"rm", "-f", path.Join("/backup", snapshotName),
+		},
+		Image: alpineImage,
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/backup:z", EtcdSnapshotPath),
+		},
+	}
+	_, err := runEtcdSnapshotTool(ctx, etcdHost, imageCfg, hostCfg, prsMap)
+	return err
+}
+
+func GetEtcdSnapshotStatus(ctx context.Context, etcdHost *hosts.Host, prsMap map[string]types.PrivateRegistry, etcdImage, snapshotName string) (EtcdSnapshotStatus, error) {
+	log.Debugf("[etcd] Inspecting snapshot [%s] on host [%s]", snapshotName, etcdHost.Address)
+	status := EtcdSnapshotStatus{}
+	imageCfg := &container.Config{
+		Cmd: []string{
+			"/usr/local/bin/etcdctl", "snapshot", "status", path.Join("/backup", snapshotName), "--write-out=json",
+		},
+		Env:   []string{"ETCDCTL_API=3"},
+		Image: etcdImage,
+	}
+	hostCfg := &container.HostConfig{
+		Binds: []string{
+			fmt.Sprintf("%s:/backup:z", EtcdSnapshotPath),
+		},
+	}
+	out, err := runEtcdSnapshotTool(ctx, etcdHost, imageCfg, hostCfg, prsMap)
+	if err != nil {
+		return status, err
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &status); err != nil {
+		return status, fmt.Errorf("Failed to parse status of snapshot [%s] on host [%s]: %v", snapshotName, etcdHost.Address, err)
+	}
+	return status, nil
+}
+
+func runEtcdSnapshotTool(ctx context.Context, etcdHost *hosts.Host, imageCfg *container.Config, hostCfg *container.HostConfig, prsMap map[string]types.PrivateRegistry) (string, error) {
+	if err := docker.DoRemoveContainer(ctx, etcdHost.DClient, EtcdSnapshotToolContainerName, etcdHost.Address); err != nil {
+		return "", err
+	}
+	if err := docker.DoRunContainer(ctx, etcdHost.DClient, imageCfg, hostCfg, EtcdSnapshotToolContainerName, etcdHost.Address, ETCDRole, prsMap); err != nil {
+		return "", err
+	}
+	status, err := docker.WaitForContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotToolContainerName)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		containerLog, err := docker.GetContainerLogsStdoutStderr(ctx, etcdHost.DClient, EtcdSnapshotToolContainerName, "5", false)
+		if err != nil {
+			return "", err
+		}
+		if err := docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotToolContainerName); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("Failed to run etcd snapshot container on host [%s], exit status is: %d, container logs: %s", etcdHost.Address, status, containerLog)
+	}
+	out, err := docker.GetContainerLogsStdout(ctx, etcdHost.DClient, EtcdSnapshotToolContainerName, "all", false)
+	if err != nil {
+		return "", err
+	}
+	return out, docker.RemoveContainer(ctx, etcdHost.DClient, etcdHost.Address, EtcdSnapshotToolContainerName)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"yunion.io/x/yke/pkg/types"
+)
+
+func TestEtcdSnapshotS3Args(t *testing.T) {
+	s3Config := &types.S3BackupConfig{
+		Endpoint:   "minio.local:9000",
+		BucketName: "backups",
+		Region:     "us-east-1",
+		AccessKey:  "access-key",
+		SecretKey:  "secret-key",
+	}
+	want := []string{
+		"--s3-backup=true",
+		"--s3-endpoint=minio.local:9000",
+		"--s3-bucketName=backups",
+		"--s3-region=us-east-1",
+	}
+	args := getEtcdSnapshotS3Args(s3Config)
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("getEtcdSnapshotS3Args() = %v, want %v", args, want)
+	}
+
+	s3Config.Folder = "cluster1"
+	s3Config.CustomCA = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	want = append(want,
+		"--s3-folder=cluster1",
+		"--s3-endpoint-ca="+base64.StdEncoding.EncodeToString([]byte(s3Config.CustomCA)),
+	)
+	args = getEtcdSnapshotS3Args(s3Config)
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("getEtcdSnapshotS3Args() = %v, want %v", args, want)
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, s3Config.AccessKey) || strings.Contains(arg, s3Config.SecretKey) {
+			t.Fatalf("S3 credentials are passed on the command line: %s", arg)
+		}
+	}
+
+	env := getEtcdSnapshotS3Env(s3Config)
+	wantEnv := []string{
+		EtcdSnapshotS3AccessKeyEnv + "=access-key",
+		EtcdSnapshotS3SecretKeyEnv + "=secret-key",
+	}
+	if !reflect.DeepEqual(env, wantEnv) {
+		t.Fatalf("getEtcdSnapshotS3Env() = %v, want %v", env, wantEnv)
+	}
+}
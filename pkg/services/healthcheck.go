@@ -27,18 +27,51 @@ const (
 
 func runHealthcheck(ctx context.Context, host *hosts.Host, serviceName string, localConnDialerFactory hosts.DialerFactory, url string, certMap map[string]pki.CertificatePKI) error {
 	log.Infof("[healthcheck] Start Healthcheck on service [%s] on host [%s]", serviceName, host.Address)
+	client, err := getServiceHealthCheckHTTPClient(host, serviceName, localConnDialerFactory, url, certMap)
+	if err != nil {
+		return err
+	}
+	for retries := 0; retries < 10; retries++ {
+		if err = getHealthz(client, serviceName, host.Address, url); err != nil {
+			log.Debugf("[healthcheck] %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		log.Infof("[healthcheck] service [%s] on host [%s] is healthy", serviceName, host.Address)
+		return nil
+	}
+	log.Debugf("Checking container logs")
+	containerLog, logserr := docker.GetContainerLogsStdoutStderr(ctx, host.DClient, serviceName, "1", false)
+	containerLog = strings.TrimSuffix(containerLog, "\n")
+	if logserr != nil {
+		return fmt.Errorf("Failed to verify healthcheck for service [%s]: %v", serviceName, logserr)
+	}
+	return fmt.Errorf("Failed to verify healthcheck: %v, log: %v", err, containerLog)
+}
+
+// CheckServiceHealth runs a single healthz check of the service on the host,
+// unlike runHealthcheck it neither retries nor collects the container logs.
+func CheckServiceHealth(ctx context.Context, host *hosts.Host, serviceName string, localConnDialerFactory hosts.DialerFactory, url string, certMap map[string]pki.CertificatePKI) error {
+	client, err := getServiceHealthCheckHTTPClient(host, serviceName, localConnDialerFactory, url, certMap)
+	if err != nil {
+		return err
+	}
+	return getHealthz(client, serviceName, host.Address, url)
+}
+
+func getServiceHealthCheckHTTPClient(host *hosts.Host, serviceName string, localConnDialerFactory hosts.DialerFactory, url string, certMap map[string]pki.CertificatePKI) (*http.Client, error) {
 	var x509Pair tls.Certificate
 
 	port, err := getPortFromURL(url)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if serviceName == KubeletContainerName {
 		certificate := cert.EncodeCertPEM(certMap[pki.KubeNodeCertName].Certificate)
 		key := cert.EncodePrivateKeyPEM(certMap[pki.KubeNodeCertName].Key)
 		x509Pair, err = tls.X509KeyPair(certificate, key)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	if serviceName == KubeAPIContainerName {
@@ -46,29 +79,14 @@ func runHealthcheck(ctx context.Context, host *hosts.Host, serviceName string, l
 		key := cert.EncodePrivateKeyPEM(certMap[pki.KubeAPICertName].Key)
 		x509Pair, err = tls.X509KeyPair(certificate, key)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	client, err := getHealthCheckHTTPClient(host, port, localConnDialerFactory, &x509Pair)
 	if err != nil {
-		return fmt.Errorf("Failed to initiate new HTTP client for service [%s] for host [%s]", serviceName, host.Address)
+		return nil, fmt.Errorf("Failed to initiate new HTTP client for service [%s] for host [%s]", serviceName, host.Address)
 	}
-	for retries := 0; retries < 10; retries++ {
-		if err = getHealthz(client, serviceName, host.Address, url); err != nil {
-			log.Debugf("[healthcheck] %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		log.Infof("[healthcheck] service [%s] on host [%s] is healthy", serviceName, host.Address)
-		return nil
-	}
-	log.Debugf("Checking container logs")
-	containerLog, logserr := docker.GetContainerLogsStdoutStderr(ctx, host.DClient, serviceName, "1", false)
-	containerLog = strings.TrimSuffix(containerLog, "\n")
-	if logserr != nil {
-		return fmt.Errorf("Failed to verify healthcheck for service [%s]: %v", serviceName, logserr)
-	}
-	return fmt.Errorf("Failed to verify healthcheck: %v, log: %v", err, containerLog)
+	return client, nil
 }
 
 func getHealthCheckHTTPClient(host *hosts.Host, port int, localConnDialerFactory hosts.DialerFactory, x509KeyPair *tls.Certificate) (*http.Client, error) {
@@ -32,7 +32,11 @@ const (
 	EtcdSnapshotContainerName     = "etcd-rolling-snapshots"
 	EtcdSnapshotOnceContainerName = "etcd-snapshot-once"
 	EtcdRestoreContainerName      = "etcd-restore"
+	EtcdSnapshotToolContainerName = "etcd-snapshot-tool"
+	EtcdDownloadContainerName     = "etcd-download-backup"
 	NginxProxyContainerName       = "nginx-proxy"
+	KeepalivedContainerName       = "keepalived"
+	HAProxyContainerName          = "haproxy"
 	SidekickContainerName         = "service-sidekick"
 	LogLinkContainerName          = "log-linker"
 	LogCleanerContainerName       = "log-cleaner"
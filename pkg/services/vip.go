@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+
+	"yunion.io/x/yke/pkg/docker"
+	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/types"
+)
+
+// runControlPlaneVIP runs haproxy balancing the kube-apiservers and
+// keepalived holding the virtual IP of the control plane endpoint. Hosts
+// without them in their plan get the containers removed.
+func runControlPlaneVIP(ctx context.Context, host *hosts.Host, prsMap map[string]types.PrivateRegistry, processMap map[string]types.Process, alpineImage string) error {
+	for _, name := range []string{HAProxyContainerName, KeepalivedContainerName} {
+		process, ok := processMap[name]
+		if !ok {
+			if err := docker.DoRemoveContainer(ctx, host.DClient, name, host.Address); err != nil {
+				return err
+			}
+			continue
+		}
+		imageCfg, hostCfg, _ := GetProcessConfig(process)
+		if err := docker.DoRunContainer(ctx, host.DClient, imageCfg, hostCfg, name, host.Address, ControlRole, prsMap); err != nil {
+			return err
+		}
+		if err := createLogLink(ctx, host, name, ControlRole, alpineImage, prsMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeControlPlaneVIP(ctx context.Context, host *hosts.Host) error {
+	if err := docker.DoRemoveContainer(ctx, host.DClient, KeepalivedContainerName, host.Address); err != nil {
+		return err
+	}
+	return docker.DoRemoveContainer(ctx, host.DClient, HAProxyContainerName, host.Address)
+}
@@ -2,12 +2,16 @@ package services
 
 import (
 	"context"
+	"fmt"
 
 	"golang.org/x/sync/errgroup"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
 
 	"yunion.io/x/log"
 
 	"yunion.io/x/yke/pkg/hosts"
+	"yunion.io/x/yke/pkg/k8s"
 	"yunion.io/x/yke/pkg/pki"
 	"yunion.io/x/yke/pkg/types"
 	"yunion.io/x/yke/pkg/util"
@@ -52,6 +56,78 @@ func RunWorkerPlane(
 	return nil
 }
 
+// UpgradeWorkerPlane replaces kubelet and kube-proxy on the given hosts in
+// batches of at most maxUnavailable hosts. Every node is cordoned and drained
+// before the upgrade and uncordoned once it is ready again, the upgrade stops
+// at the first failed batch.
+func UpgradeWorkerPlane(
+	ctx context.Context,
+	upgradeHosts []*hosts.Host,
+	k8sClient *kubernetes.Clientset,
+	localConnDialerFactory hosts.DialerFactory,
+	prsMap map[string]types.PrivateRegistry,
+	workerNodePlanMap map[string]types.ConfigNodePlan,
+	certMap map[string]pki.CertificatePKI,
+	alpineImage string,
+	upgradeStrategy types.UpgradeStrategy,
+	maxUnavailable int,
+) error {
+	log.Infof("[%s] Upgrading Worker Plane, max unavailable hosts: %d", WorkerRole, maxUnavailable)
+	for start := 0; start < len(upgradeHosts); start += maxUnavailable {
+		end := start + maxUnavailable
+		if end > len(upgradeHosts) {
+			end = len(upgradeHosts)
+		}
+		var errgrp errgroup.Group
+		for _, host := range upgradeHosts[start:end] {
+			runHost := host
+			errgrp.Go(func() error {
+				return doUpgradeWorkerPlaneHost(ctx, runHost, k8sClient, localConnDialerFactory, prsMap, workerNodePlanMap[runHost.Address].Processes, certMap, alpineImage, upgradeStrategy)
+			})
+		}
+		if err := errgrp.Wait(); err != nil {
+			return fmt.Errorf("Failed to upgrade worker hosts, stopping upgrade: %v", err)
+		}
+	}
+	log.Infof("[%s] Successfully upgraded Worker Plane..", WorkerRole)
+	return nil
+}
+
+func doUpgradeWorkerPlaneHost(ctx context.Context, host *hosts.Host, k8sClient *kubernetes.Clientset, localConnDialerFactory hosts.DialerFactory, prsMap map[string]types.PrivateRegistry, processMap map[string]types.Process, certMap map[string]pki.CertificatePKI, alpineImage string, upgradeStrategy types.UpgradeStrategy) error {
+	nodeName := host.HostnameOverride
+	node, err := k8s.GetNode(k8sClient, nodeName)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Failed to get node [%s]: %v", nodeName, err)
+		}
+		// not registered yet, nothing to drain
+		log.Infof("[%s] Node [%s] not found in kubernetes, upgrading host [%s] without draining", WorkerRole, nodeName, host.Address)
+		return doDeployWorkerPlaneHost(ctx, host, localConnDialerFactory, prsMap, processMap, certMap, false, alpineImage)
+	}
+	// keep nodes cordoned by the user cordoned after the upgrade
+	wasCordoned := node.Spec.Unschedulable
+
+	log.Infof("[%s] Cordoning and draining node [%s]", WorkerRole, nodeName)
+	if err := k8s.CordonUncordon(k8sClient, nodeName, true); err != nil {
+		return err
+	}
+	if err := k8s.DrainNode(k8sClient, nodeName, upgradeStrategy.GracePeriod, upgradeStrategy.DrainTimeout); err != nil {
+		return fmt.Errorf("Failed to drain node [%s]: %v", nodeName, err)
+	}
+	log.Infof("[%s] Upgrading host [%s]", WorkerRole, host.Address)
+	if err := doDeployWorkerPlaneHost(ctx, host, localConnDialerFactory, prsMap, processMap, certMap, false, alpineImage); err != nil {
+		return err
+	}
+	if err := k8s.WaitForNodeReady(k8sClient, nodeName, upgradeStrategy.NodeReadyTimeout); err != nil {
+		return err
+	}
+	if wasCordoned {
+		return nil
+	}
+	log.Infof("[%s] Uncordoning node [%s]", WorkerRole, nodeName)
+	return k8s.CordonUncordon(k8sClient, nodeName, false)
+}
+
 func doDeployWorkerPlaneHost(ctx context.Context, host *hosts.Host, localConnDialerFactory hosts.DialerFactory, prsMap map[string]types.PrivateRegistry, processMap map[string]types.Process, certMap map[string]pki.CertificatePKI, updateWorkersOnly bool, alpineImage string) error {
 	if updateWorkersOnly {
 		if !host.UpdateWorker {
@@ -115,9 +191,13 @@ func RemoveWorkerPlane(ctx context.Context, workerHosts []*hosts.Host, force boo
 func doDeployWorkerPlane(ctx context.Context, host *hosts.Host,
 	localConnDialerFactory hosts.DialerFactory,
 	prsMap map[string]types.PrivateRegistry, processMap map[string]types.Process, certMap map[string]pki.CertificatePKI, alpineImage string) error {
-	// run nginx proxy
+	// run nginx proxy, not needed when the node goes through the control plane endpoint
 	if !host.IsControl {
-		if err := runNginxProxy(ctx, host, prsMap, processMap[NginxProxyContainerName], alpineImage); err != nil {
+		if proxyProcess, ok := processMap[NginxProxyContainerName]; ok {
+			if err := runNginxProxy(ctx, host, prsMap, proxyProcess, alpineImage); err != nil {
+				return err
+			}
+		} else if err := removeNginxProxy(ctx, host); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,11 @@
+package templates
+
+// DefaultAuditPolicy logs the metadata of every request, request and response
+// bodies are left out as they may carry secrets.
+const DefaultAuditPolicy = `apiVersion: audit.k8s.io/v1beta1
+kind: Policy
+omitStages:
+  - RequestReceived
+rules:
+  - level: Metadata
+`
@@ -15,6 +15,50 @@ roleRef:
   kind: ClusterRole
   name: system:node
 subjects:
+- kind: Group
+  name: system:nodes
+  apiGroup: rbac.authorization.k8s.io`
+
+	// bootstrapping kubelets may request a client certificate, the requests
+	// of their first certificate and of the renewals are approved
+	KubeletBootstrapClusterRoleBinding = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: yke-kubelet-bootstrap
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:node-bootstrapper
+subjects:
+- kind: Group
+  name: system:bootstrappers
+  apiGroup: rbac.authorization.k8s.io`
+
+	KubeletBootstrapApproveClusterRoleBinding = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: yke-kubelet-bootstrap-approve
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:certificates.k8s.io:certificatesigningrequests:nodeclient
+subjects:
+- kind: Group
+  name: system:bootstrappers
+  apiGroup: rbac.authorization.k8s.io`
+
+	KubeletRenewalApproveClusterRoleBinding = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: yke-kubelet-renewal-approve
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: system:certificates.k8s.io:certificatesigningrequests:selfnodeclient
+subjects:
 - kind: Group
   name: system:nodes
   apiGroup: rbac.authorization.k8s.io`
@@ -9,4 +9,14 @@ const (
 	YunionAdminProject = "YunionAdminProject"
 	YunionRegion       = "YunionRegion"
 	YunionKubeCluster  = "YunionKubeCluster"
+
+	// Flannel, calico and canal names
+	FlannelInterface   = "FlannelInterface"
+	FlannelBackendType = "FlannelBackendType"
+	FlannelBackendVNI  = "FlannelBackendVNI"
+	FlannelBackendPort = "FlannelBackendPort"
+	CalicoInterface    = "CalicoInterface"
+	CalicoIPIPMode     = "CalicoIPIPMode"
+	CanalInterface     = "CanalInterface"
+	ServiceAccount     = "ServiceAccount"
 )
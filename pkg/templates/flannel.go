@@ -0,0 +1,177 @@
+package templates
+
+const FlannelTemplate = `
+{{- if eq .RBACConfig "rbac"}}
+---
+kind: ClusterRoleBinding
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: flannel
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: flannel
+subjects:
+- kind: ServiceAccount
+  name: flannel
+  namespace: kube-system
+---
+kind: ClusterRole
+apiVersion: rbac.authorization.k8s.io/v1
+metadata:
+  name: flannel
+rules:
+  - apiGroups:
+      - ""
+    resources:
+      - pods
+    verbs:
+      - get
+  - apiGroups:
+      - ""
+    resources:
+      - nodes
+    verbs:
+      - list
+      - watch
+  - apiGroups:
+      - ""
+    resources:
+      - nodes/status
+    verbs:
+      - patch
+{{- end}}
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: kube-flannel-cfg
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: flannel
+data:
+  cni-conf.json: |
+    {
+      "name": "cbr0",
+      "cniVersion": "0.3.1",
+      "plugins": [
+        {
+          "type": "flannel",
+          "delegate": {
+            "hairpinMode": true,
+            "isDefaultGateway": true
+          }
+        },
+        {
+          "type": "portmap",
+          "capabilities": {
+            "portMappings": true
+          },
+          "snat": true
+        }
+      ]
+    }
+  net-conf.json: |
+    {
+      "Network": "{{.ClusterCIDR}}",
+      "Backend": {
+        "Type": "{{.FlannelBackendType}}"{{if eq .FlannelBackendType "vxlan"}},
+        "VNI": {{.FlannelBackendVNI}},
+        "Port": {{.FlannelBackendPort}}{{end}}
+      }
+    }
+---
+kind: DaemonSet
+apiVersion: extensions/v1beta1
+metadata:
+  name: kube-flannel
+  namespace: kube-system
+  labels:
+    tier: node
+    k8s-app: flannel
+spec:
+  template:
+    metadata:
+      labels:
+        tier: node
+        k8s-app: flannel
+    spec:
+      serviceAccountName: flannel
+      hostNetwork: true
+      nodeSelector:
+        beta.kubernetes.io/os: linux
+      tolerations:
+      - operator: Exists
+        effect: NoSchedule
+      - operator: Exists
+        effect: NoExecute
+      containers:
+        - name: kube-flannel
+          image: {{.Image}}
+          command:
+          - /opt/bin/flanneld
+          args:
+          - --ip-masq
+          - --kube-subnet-mgr
+          {{- if .FlannelInterface}}
+          - --iface={{.FlannelInterface}}
+          {{- end}}
+          securityContext:
+            privileged: true
+          env:
+          - name: POD_NAME
+            valueFrom:
+              fieldRef:
+                fieldPath: metadata.name
+          - name: POD_NAMESPACE
+            valueFrom:
+              fieldRef:
+                fieldPath: metadata.namespace
+          volumeMounts:
+          - name: run
+            mountPath: /run
+          - name: flannel-cfg
+            mountPath: /etc/kube-flannel/
+        # Installs the flannel CNI binaries and network config file on
+        # each node.
+        - name: install-cni
+          image: {{.CNIImage}}
+          command: ["/install-cni.sh"]
+          env:
+          # The CNI network config to install on each node.
+          - name: CNI_NETWORK_CONFIG
+            valueFrom:
+              configMapKeyRef:
+                name: kube-flannel-cfg
+                key: cni-conf.json
+          - name: CNI_CONF_NAME
+            value: "10-flannel.conflist"
+          volumeMounts:
+          - mountPath: /host/opt/cni/bin
+            name: host-cni-bin
+          - mountPath: /host/etc/cni/net.d
+            name: host-cni-net
+      volumes:
+        - name: run
+          hostPath:
+            path: /run
+        - name: host-cni-net
+          hostPath:
+            path: /etc/cni/net.d
+        - name: flannel-cfg
+          configMap:
+            name: kube-flannel-cfg
+        - name: host-cni-bin
+          hostPath:
+            path: /opt/cni/bin
+  updateStrategy:
+    rollingUpdate:
+      maxUnavailable: 20%
+    type: RollingUpdate
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: flannel
+  namespace: kube-system`
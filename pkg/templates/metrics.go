@@ -116,7 +116,6 @@ spec:
         command:
         - /metrics-server
         {{- if eq .Version "v0.3" }}
-        - --kubelet-insecure-tls
         - --kubelet-preferred-address-types=InternalIP
         - --logtostderr
         {{- else }}
@@ -4,7 +4,11 @@ const WebhookAuthTemplate = `
 apiVersion: v1
 clusters:
 - cluster:
+{{- if .CAData}}
+    certificate-authority-data: {{.CAData}}
+{{- else}}
     insecure-skip-tls-verify: true
+{{- end}}
     server: {{.URL}}
   name: webhook
 contexts:
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"encoding/json"
+)
+
+// AuthnStrategies lists the authentication strategies of the cluster, a
+// single strategy is accepted as well for compatibility.
+type AuthnStrategies []string
+
+func (s *AuthnStrategies) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	strategies := []string{}
+	if err := unmarshal(&strategies); err == nil {
+		*s = strategies
+		return nil
+	}
+	strategy := ""
+	if err := unmarshal(&strategy); err != nil {
+		return err
+	}
+	*s = newAuthnStrategies(strategy)
+	return nil
+}
+
+func (s *AuthnStrategies) UnmarshalJSON(data []byte) error {
+	strategies := []string{}
+	if err := json.Unmarshal(data, &strategies); err == nil {
+		*s = strategies
+		return nil
+	}
+	strategy := ""
+	if err := json.Unmarshal(data, &strategy); err != nil {
+		return err
+	}
+	*s = newAuthnStrategies(strategy)
+	return nil
+}
+
+func newAuthnStrategies(strategy string) AuthnStrategies {
+	if len(strategy) == 0 {
+		return nil
+	}
+	return AuthnStrategies{strategy}
+}
+
+// Has tells whether strategy is one of the authentication strategies.
+func (s AuthnStrategies) Has(strategy string) bool {
+	for _, name := range s {
+		if name == strategy {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"encoding/json"
+)
+
+// BastionHosts is an ordered chain of jump hosts, the first hop is dialed
+// directly and every following hop through the previous one. A single
+// bastion host is accepted as well for compatibility.
+type BastionHosts []BastionHost
+
+func (b *BastionHosts) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	hops := []BastionHost{}
+	if err := unmarshal(&hops); err == nil {
+		*b = hops
+		return nil
+	}
+	hop := BastionHost{}
+	if err := unmarshal(&hop); err != nil {
+		return err
+	}
+	*b = newBastionHosts(hop)
+	return nil
+}
+
+func (b *BastionHosts) UnmarshalJSON(data []byte) error {
+	hops := []BastionHost{}
+	if err := json.Unmarshal(data, &hops); err == nil {
+		*b = hops
+		return nil
+	}
+	hop := BastionHost{}
+	if err := json.Unmarshal(data, &hop); err != nil {
+		return err
+	}
+	*b = newBastionHosts(hop)
+	return nil
+}
+
+func newBastionHosts(hop BastionHost) BastionHosts {
+	// an empty bastion_host section means no bastion host
+	if hop == (BastionHost{}) {
+		return nil
+	}
+	return BastionHosts{hop}
+}
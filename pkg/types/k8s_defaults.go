@@ -63,6 +63,8 @@ var (
 			Kubernetes:                m("rancher/hyperkube:v1.10.5-rancher1"),
 			Alpine:                    m("yunion/yke-tools:v0.1.13"),
 			NginxProxy:                m("yunion/yke-tools:v0.1.13"),
+			Keepalived:                m("osixia/keepalived:2.0.17"),
+			HAProxy:                   m("haproxy:1.8.19-alpine"),
 			CertDownloader:            m("yunion/yke-tools:v0.1.13"),
 			KubernetesServicesSidecar: m("yunion/yke-tools:v0.1.13"),
 			KubeDNS:                   m("gcr.io/google_containers/k8s-dns-kube-dns-amd64:1.14.8"),
@@ -71,6 +73,13 @@ var (
 			KubeDNSAutoscaler:         m("gcr.io/google_containers/cluster-proportional-autoscaler-amd64:1.0.0"),
 			CoreDNS:                   m("yunion/coredns:1.2.6"),
 			YunionCNI:                 m("yunion/cni:v2.3.1"),
+			Flannel:                   m("quay.io/coreos/flannel:v0.10.0"),
+			FlannelCNI:                m("quay.io/coreos/flannel-cni:v0.3.0"),
+			CalicoNode:                m("quay.io/calico/node:v3.1.3"),
+			CalicoCNI:                 m("quay.io/calico/cni:v3.1.3"),
+			CanalNode:                 m("quay.io/calico/node:v3.1.3"),
+			CanalCNI:                  m("quay.io/calico/cni:v3.1.3"),
+			CanalFlannel:              m("quay.io/coreos/flannel:v0.10.0"),
 			CSIAttacher:               m("quay.io/k8scsi/csi-attacher:v0.4.0"),
 			CSIProvisioner:            m("quay.io/k8scsi/csi-provisioner:v0.4.0"),
 			CSIRegistrar:              m("quay.io/k8scsi/driver-registrar:v0.4.0"),
@@ -90,6 +99,8 @@ var (
 			Kubernetes:                m("rancher/hyperkube:v1.11.3-rancher1"),
 			Alpine:                    m("yunion/yke-tools:v0.1.13"),
 			NginxProxy:                m("yunion/yke-tools:v0.1.13"),
+			Keepalived:                m("osixia/keepalived:2.0.17"),
+			HAProxy:                   m("haproxy:1.8.19-alpine"),
 			CertDownloader:            m("yunion/yke-tools:v0.1.13"),
 			KubernetesServicesSidecar: m("yunion/yke-tools:v0.1.13"),
 			KubeDNS:                   m("gcr.io/google_containers/k8s-dns-kube-dns-amd64:1.14.10"),
@@ -98,6 +109,13 @@ var (
 			KubeDNSAutoscaler:         m("gcr.io/google_containers/cluster-proportional-autoscaler-amd64:1.0.0"),
 			CoreDNS:                   m("yunion/coredns:1.2.6"),
 			YunionCNI:                 m("yunion/cni:v2.3.1"),
+			Flannel:                   m("quay.io/coreos/flannel:v0.10.0"),
+			FlannelCNI:                m("quay.io/coreos/flannel-cni:v0.3.0"),
+			CalicoNode:                m("quay.io/calico/node:v3.1.3"),
+			CalicoCNI:                 m("quay.io/calico/cni:v3.1.3"),
+			CanalNode:                 m("quay.io/calico/node:v3.1.3"),
+			CanalCNI:                  m("quay.io/calico/cni:v3.1.3"),
+			CanalFlannel:              m("quay.io/coreos/flannel:v0.10.0"),
 			CSIAttacher:               m("quay.io/k8scsi/csi-attacher:v0.4.0"),
 			CSIProvisioner:            m("quay.io/k8scsi/csi-provisioner:v0.4.0"),
 			CSIRegistrar:              m("quay.io/k8scsi/driver-registrar:v0.4.0"),
@@ -117,6 +135,8 @@ var (
 			Kubernetes:                m("rancher/hyperkube:v1.12.3-rancher1"),
 			Alpine:                    m("yunion/yke-tools:v0.1.13"),
 			NginxProxy:                m("yunion/yke-tools:v0.1.13"),
+			Keepalived:                m("osixia/keepalived:2.0.17"),
+			HAProxy:                   m("haproxy:1.8.19-alpine"),
 			CertDownloader:            m("yunion/yke-tools:v0.1.13"),
 			KubernetesServicesSidecar: m("yunion/yke-tools:v0.1.13"),
 			KubeDNS:                   m("gcr.io/google_containers/k8s-dns-kube-dns-amd64:1.14.13"),
@@ -125,6 +145,13 @@ var (
 			KubeDNSAutoscaler:         m("gcr.io/google_containers/cluster-proportional-autoscaler-amd64:1.0.0"),
 			CoreDNS:                   m("yunion/coredns:1.2.6"),
 			YunionCNI:                 m("yunion/cni:v2.4.0"),
+			Flannel:                   m("quay.io/coreos/flannel:v0.10.0"),
+			FlannelCNI:                m("quay.io/coreos/flannel-cni:v0.3.0"),
+			CalicoNode:                m("quay.io/calico/node:v3.1.3"),
+			CalicoCNI:                 m("quay.io/calico/cni:v3.1.3"),
+			CanalNode:                 m("quay.io/calico/node:v3.1.3"),
+			CanalCNI:                  m("quay.io/calico/cni:v3.1.3"),
+			CanalFlannel:              m("quay.io/coreos/flannel:v0.10.0"),
 			CSIAttacher:               m("quay.io/k8scsi/csi-attacher:v0.4.0"),
 			CSIProvisioner:            m("quay.io/k8scsi/csi-provisioner:v0.4.0"),
 			CSIRegistrar:              m("quay.io/k8scsi/driver-registrar:v0.4.0"),
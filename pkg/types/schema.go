@@ -0,0 +1,94 @@
+package types
+
+import (
+	"reflect"
+	"strings"
+)
+
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// GetConfigJSONSchema returns the JSON Schema of the cluster file, generated
+// from KubernetesEngineConfig using the yaml keys of its fields.
+func GetConfigJSONSchema() map[string]interface{} {
+	schema := getTypeSchema(reflect.TypeOf(KubernetesEngineConfig{}), map[reflect.Type]bool{})
+	schema["$schema"] = JSONSchemaDraft
+	schema["title"] = "YKE cluster configuration"
+	return schema
+}
+
+func getTypeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return getTypeSchema(t.Elem(), visiting)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		items := getTypeSchema(t.Elem(), visiting)
+		schema := map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		}
+		if t == reflect.TypeOf(BastionHosts{}) || t == reflect.TypeOf(AuthnStrategies{}) {
+			// a single bastion host or strategy is accepted as well
+			return map[string]interface{}{"oneOf": []interface{}{items, schema}}
+		}
+		return schema
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": getTypeSchema(t.Elem(), visiting),
+		}
+	case reflect.Struct:
+		// recursive types are left open instead of looping forever
+		if visiting[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		properties := map[string]interface{}{}
+		addStructProperties(t, properties, visiting)
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	}
+	return map[string]interface{}{}
+}
+
+func addStructProperties(t reflect.Type, properties map[string]interface{}, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("yaml"), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		inline := false
+		for _, flag := range tag[1:] {
+			if flag == "inline" {
+				inline = true
+			}
+		}
+		if inline {
+			addStructProperties(field.Type, properties, visiting)
+			continue
+		}
+		if len(name) == 0 {
+			// same default key as the yaml decoder
+			name = strings.ToLower(field.Name)
+		}
+		properties[name] = getTypeSchema(field.Type, visiting)
+	}
+}
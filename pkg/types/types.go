@@ -17,8 +17,19 @@ type KubernetesEngineConfig struct {
 	SystemImages SystemImages `yaml:"system_images" json:"systemImages"`
 	// SSH Private Key Path
 	SSHKeyPath string `yaml:"ssh_key_path" json:"sshKeyPath"`
+	// Passphrase of encrypted SSH Private Keys
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Passphrase of encrypted SSH Private Keys without ssh_key_passphrase, it's
+	// given on the command line and never saved in the cluster state
+	FallbackSSHKeyPassphrase string `yaml:"-" json:"-"`
+	// SSH Certificate Path
+	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
 	// SSH Agent Auth enable
 	SSHAgentAuth bool `yaml:"ssh_agent_auth" json:"sshAgentAuth"`
+	// SSH known hosts file used to verify host keys (default: ~/.ssh/known_hosts)
+	SSHKnownHostsPath string `yaml:"ssh_known_hosts_path" json:"sshKnownHostsPath,omitempty"`
+	// Trust unknown host keys on first use and record them in the cluster state file
+	SSHTrustOnFirstUse bool `yaml:"ssh_trust_on_first_use" json:"sshTrustOnFirstUse,omitempty"`
 	// Authorization mode configuration used in the cluster
 	Authorization AuthzConfig `yaml:"authorization" json:"authorization"`
 	// Enable/disable strict docker version checking
@@ -39,14 +50,49 @@ type KubernetesEngineConfig struct {
 	PrefixPath string `yaml:"prefix_path" json:"prefixPath,omitempty"`
 	// Timeout in seconds for status check on addon deployment jobs
 	AddonJobTimeout int `yaml:"addon_job_timeout" json:"addonJobTimeout,omitempty"`
-	// Bastion/Jump Host configuration
-	BastionHost BastionHost `yaml:"bastion_host" json:"bastionHost,omitempty"`
+	// Bastion/Jump Host configuration, a single host or an ordered list of hops
+	BastionHost BastionHosts `yaml:"bastion_host" json:"bastionHost,omitempty"`
 	// Monitoring Config
 	Monitoring MonitoringConfig `yaml:"monitoring" json:"monitoring,omitempty"`
 	// WebhookConfig options
 	WebhookAuth WebhookAuth `yaml:"webhook_auth" json:"webhookAuth"`
 	// Yunion related options
 	YunionConfig YunionConfig `yaml:"yunion_config" json:"yunionConfig"`
+	// Certificates management options
+	CertificatesConfig CertificatesConfig `yaml:"certificates" json:"certificates,omitempty"`
+	// Rolling upgrade options
+	UpgradeStrategy UpgradeStrategy `yaml:"upgrade_strategy" json:"upgradeStrategy,omitempty"`
+	// Highly available endpoint of the kubernetes API
+	ControlPlaneEndpoint ControlPlaneEndpoint `yaml:"control_plane_endpoint" json:"controlPlaneEndpoint,omitempty"`
+}
+
+type ControlPlaneEndpoint struct {
+	// vip runs keepalived and haproxy on the control plane hosts, external uses a load balancer managed outside of the cluster
+	Mode string `yaml:"mode" json:"mode,omitempty"`
+	// Virtual IP in vip mode, IP or DNS name of the load balancer in external mode
+	Address string `yaml:"address" json:"address,omitempty"`
+	// Port of the endpoint (default: 8443 in vip mode, 6443 in external mode)
+	Port string `yaml:"port" json:"port,omitempty"`
+	// Network interface keepalived adds the virtual IP to, vip mode only
+	Interface string `yaml:"interface" json:"interface,omitempty"`
+	// VRRP virtual router id shared by the control plane hosts, vip mode only (default: 51)
+	VirtualRouterID int `yaml:"virtual_router_id" json:"virtualRouterId,omitempty"`
+}
+
+type UpgradeStrategy struct {
+	// Max number or percentage of worker nodes upgraded at the same time, e.g. 1 or 10%
+	MaxUnavailable string `yaml:"max_unavailable" json:"maxUnavailable,omitempty"`
+	// Timeout in seconds for draining a node before upgrading it
+	DrainTimeout int `yaml:"drain_timeout" json:"drainTimeout,omitempty"`
+	// Grace period in seconds given to evicted pods, 0 uses the pod's own value
+	GracePeriod int `yaml:"grace_period" json:"gracePeriod,omitempty"`
+	// Timeout in seconds for an upgraded node to become ready
+	NodeReadyTimeout int `yaml:"node_ready_timeout" json:"nodeReadyTimeout,omitempty"`
+}
+
+type CertificatesConfig struct {
+	// Renew leaf certificates expiring within this period on up, e.g. 720h or 30d
+	AutoRenewBefore string `yaml:"auto_renew_before" json:"autoRenewBefore,omitempty"`
 }
 
 type BastionHost struct {
@@ -62,6 +108,14 @@ type BastionHost struct {
 	SSHKey string `yaml:"ssh_key" json:"sshKey,omitempty" norman:"type=password"`
 	// SSH Private Key Path
 	SSHKeyPath string `yaml:"ssh_key_path" json:"sshKeyPath,omitempty"`
+	// Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// SSH Certificate
+	SSHCert string `yaml:"ssh_cert" json:"sshCert,omitempty"`
+	// SSH Certificate Path
+	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
+	// SHA256 fingerprint of the SSH host key
+	SSHHostKey string `yaml:"ssh_host_key" json:"sshHostKey,omitempty"`
 }
 
 type PrivateRegistry struct {
@@ -82,6 +136,10 @@ type SystemImages struct {
 	Alpine string `yaml:"alpine" json:"alpine"`
 	// rke-nginx-proxy image
 	NginxProxy string `yaml:"nginx_proxy" json:"nginxProxy"`
+	// keepalived image holding the control plane virtual IP
+	Keepalived string `yaml:"keepalived" json:"keepalived,omitempty"`
+	// haproxy image balancing the control plane virtual IP
+	HAProxy string `yaml:"haproxy" json:"haproxy,omitempty"`
 	// rke-cert-deployer image
 	CertDownloader string `yaml:"cert_downloader" json:"certDownloader"`
 	// rke-service-sidekick image
@@ -101,6 +159,20 @@ type SystemImages struct {
 	Kubernetes string `yaml:"kubernetes" json:"kubernetes"`
 	// Yunion CNI image
 	YunionCNI string `yaml:"yunion_cni" json:"yunionCni"`
+	// Flannel image
+	Flannel string `yaml:"flannel" json:"flannel"`
+	// Flannel CNI image
+	FlannelCNI string `yaml:"flannel_cni" json:"flannelCni"`
+	// Calico Node image
+	CalicoNode string `yaml:"calico_node" json:"calicoNode"`
+	// Calico CNI image
+	CalicoCNI string `yaml:"calico_cni" json:"calicoCni"`
+	// Canal Node Image
+	CanalNode string `yaml:"canal_node" json:"canalNode"`
+	// Canal CNI image
+	CanalCNI string `yaml:"canal_cni" json:"canalCni"`
+	// Canal Flannel image
+	CanalFlannel string `yaml:"canal_flannel" json:"canalFlannel"`
 	// Yunion CSI image
 	CSIAttacher    string `yaml:"csi_attacher" json:"csiAttacher"`
 	CSIProvisioner string `yaml:"csi_provisioner" json:"csiProvisioner"`
@@ -153,6 +225,16 @@ type ConfigNode struct {
 	SSHKey string `yaml:"ssh_key" json:"sshKey"`
 	// SSH Private Key Path
 	SSHKeyPath string `yaml:"ssh_key_path" json:"sshKeyPath"`
+	// Optional - Passphrase of the SSH Private Key
+	SSHKeyPassphrase string `yaml:"ssh_key_passphrase" json:"sshKeyPassphrase,omitempty" norman:"type=password"`
+	// Optional - SSH Certificate
+	SSHCert string `yaml:"ssh_cert" json:"sshCert,omitempty"`
+	// Optional - SSH Certificate Path
+	SSHCertPath string `yaml:"ssh_cert_path" json:"sshCertPath,omitempty"`
+	// Optional - SHA256 fingerprint of the SSH host key
+	SSHHostKey string `yaml:"ssh_host_key" json:"sshHostKey,omitempty"`
+	// Optional - Bastion/Jump Host chain used instead of the cluster one
+	BastionHost BastionHosts `yaml:"bastion_host,omitempty" json:"bastionHost,omitempty"`
 	// Node Labels
 	Labels map[string]string `yaml:"labels" json:"labels"`
 }
@@ -201,23 +283,85 @@ type ETCDService struct {
 	Retention string `yaml:"retention" json:"retention,omitempty"`
 	// Etcd snapshot Creation period
 	Creation string `yaml:"creation" json:"creation,omitempty"`
+	// Etcd snapshot S3 compatible object storage backup config
+	S3BackupConfig *S3BackupConfig `yaml:"s3_backup_config" json:"s3BackupConfig,omitempty"`
+}
+
+type S3BackupConfig struct {
+	// S3 compatible endpoint, e.g. s3.amazonaws.com or minio.local:9000
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// Bucket name to store the snapshots
+	BucketName string `yaml:"bucket_name" json:"bucketName"`
+	// Folder inside the bucket to store the snapshots
+	Folder string `yaml:"folder" json:"folder,omitempty"`
+	// Bucket region
+	Region string `yaml:"region" json:"region,omitempty"`
+	// Access key
+	AccessKey string `yaml:"access_key" json:"accessKey"`
+	// Secret key
+	SecretKey string `yaml:"secret_key" json:"secretKey"`
+	// Custom CA certificate of the endpoint in PEM format
+	CustomCA string `yaml:"custom_ca" json:"customCa,omitempty"`
 }
 
 type KubeAPIService struct {
 	// Base service properties
 	BaseService `yaml:",inline" json:",inline"`
-	// Virtual IP range that will be used by Kubernetes services
+	// Virtual IP range that will be used by Kubernetes services, either IPv4 or IPv6
 	ServiceClusterIPRange string `yaml:"service_cluster_ip_range" json:"serviceClusterIpRange"`
 	// Port range for services defined NodePort type
 	ServiceNodePortRange string `yaml:"service_node_port_range" json:"serviceNodePortRange,omitempty"`
 	// Enabled/Disable PodSecurityPolicy
 	PodSecurityPolicy bool `yaml:"pod_security_policy" json:"podSecurityPolicy"`
+	// Audit logging of the API server
+	AuditLog AuditLog `yaml:"audit_log" json:"auditLog,omitempty"`
+	// Encryption of Secrets stored in etcd
+	SecretsEncryption SecretsEncryption `yaml:"secrets_encryption" json:"secretsEncryption,omitempty"`
+}
+
+type SecretsEncryption struct {
+	// Encrypt Secrets before they are stored in etcd
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty"`
+	// Encryption provider, aescbc, secretbox or kms (default: aescbc)
+	Provider string `yaml:"provider" json:"provider,omitempty"`
+	// KMS plugin used by the kms provider
+	KMS KMSConfig `yaml:"kms" json:"kms,omitempty"`
+}
+
+type KMSConfig struct {
+	// Name of the KMS plugin
+	Name string `yaml:"name" json:"name,omitempty"`
+	// Unix socket of the KMS plugin on the control plane hosts, e.g. unix:///var/run/kms-plugin.sock
+	Endpoint string `yaml:"endpoint" json:"endpoint,omitempty"`
+	// Number of data encryption keys cached in memory (default: 1000)
+	CacheSize int `yaml:"cache_size" json:"cacheSize,omitempty"`
+	// Timeout of the calls to the KMS plugin (default: 3s)
+	Timeout string `yaml:"timeout" json:"timeout,omitempty"`
+}
+
+type AuditLog struct {
+	// Enable audit logging on the control plane hosts
+	Enabled bool `yaml:"enabled" json:"enabled,omitempty"`
+	// Path of the audit log on the control plane hosts (default: /var/log/kube-audit/audit-log.json)
+	Path string `yaml:"path" json:"path,omitempty"`
+	// Days to keep rotated audit logs (default: 30)
+	MaxAge int `yaml:"max_age" json:"maxAge,omitempty"`
+	// Number of rotated audit logs to keep (default: 10)
+	MaxBackup int `yaml:"max_backup" json:"maxBackup,omitempty"`
+	// Size in megabytes of the audit log before it's rotated (default: 100)
+	MaxSize int `yaml:"max_size" json:"maxSize,omitempty"`
+	// Audit log format, json or legacy (default: json)
+	Format string `yaml:"format" json:"format,omitempty"`
+	// Inline audit policy in YAML, all requests are logged at the Metadata level when neither policy nor policy_file is set
+	Policy string `yaml:"policy" json:"policy,omitempty"`
+	// Path of a local audit policy file, used when policy is empty
+	PolicyFile string `yaml:"policy_file" json:"policyFile,omitempty"`
 }
 
 type KubeControllerService struct {
 	// Base service properties
 	BaseService `yaml:",inline" json:",inline"`
-	// CIDR Range for Pods in cluster
+	// CIDR Range for Pods in cluster, either IPv4 or IPv6
 	ClusterCIDR string `yaml:"cluster_cidr" json:"clusterCidr"`
 	// Virtual IP range that will be used by Kubernetes services
 	ServiceClusterIPRange string `yaml:"service_cluster_ip_range" json:"serviceClusterIpRange"`
@@ -234,6 +378,8 @@ type KubeletService struct {
 	ClusterDNSServer string `yaml:"cluster_dns_server" json:"clusterDnsServer"`
 	// Fail if swap is enabled
 	FailSwapOn bool `yaml:"fail_swap_on" json:"failSwapOn"`
+	// How the kubelets get their client certificates, node for a certificate per node issued by yke or bootstrap for TLS bootstrapping with a bootstrap token (default: node)
+	ClientCertMode string `yaml:"client_cert_mode" json:"clientCertMode,omitempty"`
 }
 
 type KubeproxyService struct {
@@ -265,12 +411,42 @@ type NetworkConfig struct {
 }
 
 type AuthnConfig struct {
-	// Authentication strategy that will be used in kubernetes cluster
-	Strategy string `yaml:"strategy" json:"strategy"`
+	// Authentication strategies that will be used in kubernetes cluster, x509, webhook and oidc (default: x509)
+	Strategy AuthnStrategies `yaml:"strategy" json:"strategy"`
 	// Authentication options
 	Options map[string]string `yaml:"options" json:"options"`
 	// List of additional hostnames and IPs to include in the api server PKI cert
 	SANs []string `yaml:"sans" json:"sans"`
+	// Token webhook of the webhook strategy
+	Webhook AuthnWebhookConfig `yaml:"webhook" json:"webhook,omitempty"`
+	// OpenID Connect provider of the oidc strategy
+	OIDC OIDCConfig `yaml:"oidc" json:"oidc,omitempty"`
+}
+
+type AuthnWebhookConfig struct {
+	// URL of the token review webhook (default: webhook_auth.url)
+	URL string `yaml:"url" json:"url,omitempty"`
+	// CA certificate of the webhook in PEM format, TLS verification is skipped when empty
+	CACert string `yaml:"ca_cert" json:"caCert,omitempty"`
+	// Duration to cache the webhook responses, e.g. 2m
+	CacheTTL string `yaml:"cache_ttl" json:"cacheTtl,omitempty"`
+}
+
+type OIDCConfig struct {
+	// URL of the OpenID issuer, only https is accepted
+	IssuerURL string `yaml:"issuer_url" json:"issuerUrl,omitempty"`
+	// Client ID the ID tokens are issued for
+	ClientID string `yaml:"client_id" json:"clientId,omitempty"`
+	// Claim used as the user name (default: sub)
+	UsernameClaim string `yaml:"username_claim" json:"usernameClaim,omitempty"`
+	// Prefix of the user names, to avoid clashes with other users
+	UsernamePrefix string `yaml:"username_prefix" json:"usernamePrefix,omitempty"`
+	// Claim used as the user groups
+	GroupsClaim string `yaml:"groups_claim" json:"groupsClaim,omitempty"`
+	// Prefix of the group names
+	GroupsPrefix string `yaml:"groups_prefix" json:"groupsPrefix,omitempty"`
+	// CA certificate of the issuer in PEM format, the host's root CAs are used when empty
+	CACert string `yaml:"ca_cert" json:"caCert,omitempty"`
 }
 
 type AuthzConfig struct {